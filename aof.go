@@ -0,0 +1,364 @@
+package cache
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"io/fs"
+	"os"
+	"sync"
+	"time"
+)
+
+// SyncPolicy Defines how often the append-only log is flushed to stable
+// storage. Records are always handed to the operating system immediately, so
+// the policy only matters for power failures and kernel crashes, not for
+// crashes of the process itself.
+type SyncPolicy uint8
+
+const (
+	// SyncEverySecond flushes the log once a second. At most about a second
+	// of mutations may be lost.
+	SyncEverySecond SyncPolicy = iota
+	// SyncAlways flushes the log after every mutation.
+	SyncAlways
+	// SyncNever leaves flushing to the operating system.
+	SyncNever
+)
+
+// LogConfig Configuration of the append-only mutation log, see OpenLog.
+type LogConfig struct {
+	// Path of the log file, required.
+	Path string
+	// SnapshotPath of the snapshot the log is compacted into. If set, the
+	// snapshot is loaded before the log is replayed. CompactLog requires it.
+	SnapshotPath string
+	// Sync policy of the log, SyncEverySecond by default.
+	Sync SyncPolicy
+	// OnError is called with errors which happen while appending to or
+	// syncing the log. Such errors are dropped if it is nil.
+	OnError func(error)
+}
+
+var (
+	ErrLogOpened      = errors.New("log already opened")
+	ErrLogNotOpened   = errors.New("log not opened")
+	ErrNoSnapshotPath = errors.New("log snapshot path not set")
+	// ErrCorruptLog Returned by OpenLog if a record of the log, other than a
+	// torn one at its end, is invalid.
+	ErrCorruptLog = errors.New("corrupt log")
+)
+
+// maxLogRecordSize is the upper bound of a single record, anything larger is
+// a corrupted length.
+const maxLogRecordSize = 1 << 30
+
+type logRecord struct {
+	Op   mutationOp
+	Time int64
+	Key  string
+	Item Item
+}
+
+type appendLog struct {
+	c     *cache
+	mu    sync.Mutex
+	cfg   LogConfig
+	fp    *os.File
+	dirty bool
+	obs   *observer
+	stop  chan any
+	done  chan any
+	// compacting serializes CompactLog calls.
+	compacting sync.Mutex
+}
+
+// OpenLog Enables the append-only log. Set, Add, Replace, Delete, Increment*,
+// Decrement* and Flush calls are recorded to the log (with timestamps), so the
+// cache can be restored after restart by calling OpenLog with the same config.
+//
+// On open, the snapshot at cfg.SnapshotPath is loaded (if set and exists),
+// and then the log is replayed on top of it. A torn record at the end of the
+// log, left by a crash in the middle of a write, is discarded. Any other
+// invalid record makes OpenLog return ErrCorruptLog, leaving the file as it
+// is, since the records after it would be lost otherwise. The log grows
+// with every mutation, call CompactLog periodically to fold it into the
+// snapshot.
+//
+// OpenLog should be called before the cache is used: mutations made before
+// it are neither in the log nor in the snapshot until the next compaction.
+// Values are encoded with codecs the same way as by Save, so codecs and Gob
+// types must be registered before the log is replayed, the same as for Load.
+func (c *cache) OpenLog(cfg LogConfig) error {
+	if cfg.Path == "" {
+		return errors.New("log path is empty")
+	}
+	l := &appendLog{c: c, cfg: cfg}
+	if !c.log.CompareAndSwap(nil, l) {
+		return ErrLogOpened
+	}
+	if err := c.openLog(l); err != nil {
+		c.log.Store(nil)
+		return err
+	}
+	return nil
+}
+
+func (c *cache) openLog(l *appendLog) error {
+	if l.cfg.SnapshotPath != "" {
+		if err := c.LoadFile(l.cfg.SnapshotPath); err != nil && !errors.Is(err, fs.ErrNotExist) {
+			return err
+		}
+	}
+	fp, err := os.OpenFile(l.cfg.Path, os.O_RDWR|os.O_CREATE, 0o600)
+	if err != nil {
+		return err
+	}
+	n, err := c.replayLog(fp)
+	if err == nil {
+		// Appends continue right after the last complete record.
+		err = fp.Truncate(n)
+	}
+	if err == nil {
+		_, err = fp.Seek(n, io.SeekStart)
+	}
+	if err != nil {
+		_ = fp.Close()
+		return err
+	}
+	l.fp = fp
+	c.lockAll()
+	l.obs = c.addObserver(l.append)
+	c.unlockAll()
+	if l.cfg.Sync == SyncEverySecond {
+		l.stop, l.done = make(chan any), make(chan any)
+		go l.syncLoop(time.Second)
+	}
+	return nil
+}
+
+// replayLog applies records from r and returns the offset of the end of the
+// last complete record. Only a record cut short by the end of r is torn, an
+// invalid length or checksum is an error.
+func (c *cache) replayLog(r io.Reader) (int64, error) {
+	var off int64
+	br := bufio.NewReader(r)
+	hdr := make([]byte, 8)
+	for {
+		if _, err := io.ReadFull(br, hdr); err != nil {
+			if errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) {
+				return off, nil
+			}
+			return off, err
+		}
+		size := binary.LittleEndian.Uint32(hdr)
+		if size > maxLogRecordSize {
+			return off, fmt.Errorf("%w: record of %d bytes at offset %d", ErrCorruptLog, size, off)
+		}
+		payload := make([]byte, size)
+		if _, err := io.ReadFull(br, payload); err != nil {
+			if errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) {
+				return off, nil
+			}
+			return off, err
+		}
+		if crc32.ChecksumIEEE(payload) != binary.LittleEndian.Uint32(hdr[4:]) {
+			return off, fmt.Errorf("%w: checksum mismatch at offset %d", ErrCorruptLog, off)
+		}
+		rec, err := c.readLogRecord(bytes.NewReader(payload))
+		if err != nil {
+			return off, err
+		}
+		c.applyRecord(rec)
+		off += int64(len(hdr)) + int64(size)
+	}
+}
+
+// applyRecord applies a record of the log or of a replication stream, even
+// if the cache is read-only.
+func (c *cache) applyRecord(rec logRecord) {
+	switch rec.Op {
+	case opSet, opIncrement, opLoad:
+		mu := c.lockKey(rec.Key)
+		if rec.Item.expired(c.timeCache.Load()) {
+			if tmp, found := c.items.LoadAndDelete(rec.Key); found {
+				c.emit(mutation{op: opExpire, key: rec.Key, item: tmp.(Item), silent: true})
+			}
+		} else {
+			c.store(rec.Op, rec.Key, rec.Item)
+		}
+		mu.Unlock()
+	case opDelete:
+		mu := c.lockKey(rec.Key)
+		if tmp, found := c.items.LoadAndDelete(rec.Key); found {
+			c.stats.deletes.Add(1)
+			c.emit(mutation{op: opDelete, key: rec.Key, item: tmp.(Item)})
+		}
+		mu.Unlock()
+	case opFlush:
+		c.flush()
+	}
+}
+
+// encodeLogRecord returns the frame of rec: uint32 length and uint32 CRC32
+// of the payload (both little endian), followed by the payload.
+func (c *cache) encodeLogRecord(rec logRecord) ([]byte, error) {
+	b, err := c.appendLogRecord(make([]byte, 8, 64), rec)
+	if err != nil {
+		return nil, err
+	}
+	binary.LittleEndian.PutUint32(b, uint32(len(b)-8))
+	binary.LittleEndian.PutUint32(b[4:], crc32.ChecksumIEEE(b[8:]))
+	return b, nil
+}
+
+func (l *appendLog) append(m mutation) {
+	if m.op == opExpire {
+		// Expiration times are part of the logged items already.
+		return
+	}
+	b, err := l.c.encodeLogRecord(logRecord{
+		Op:   m.op,
+		Time: time.Now().UnixNano(),
+		Key:  m.key,
+		Item: m.item,
+	})
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if err == nil {
+		if l.fp == nil {
+			err = ErrLogNotOpened
+		} else if _, err = l.fp.Write(b); err == nil {
+			if l.cfg.Sync == SyncAlways {
+				err = l.fp.Sync()
+			} else {
+				l.dirty = true
+			}
+		}
+	}
+	if err != nil {
+		l.report(err)
+	}
+}
+
+func (l *appendLog) report(err error) {
+	if l.cfg.OnError != nil {
+		l.cfg.OnError(err)
+	}
+}
+
+func (l *appendLog) syncLoop(interval time.Duration) {
+	defer close(l.done)
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			l.mu.Lock()
+			if l.dirty && l.fp != nil {
+				if err := l.fp.Sync(); err != nil {
+					l.report(err)
+				}
+				l.dirty = false
+			}
+			l.mu.Unlock()
+		case <-l.stop:
+			return
+		}
+	}
+}
+
+// CompactLog Writes a snapshot of the cache to the configured SnapshotPath
+// and removes the records it holds from the log. Mutations are logged as
+// usual while the snapshot is written. Mutations are not lost if the process
+// crashes during compaction: the log is replaced only after the new snapshot
+// has been written, and replaying the old log on top of the new snapshot
+// yields the same state.
+func (c *cache) CompactLog() error {
+	l := c.log.Load()
+	if l == nil {
+		return ErrLogNotOpened
+	}
+	if l.cfg.SnapshotPath == "" {
+		return ErrNoSnapshotPath
+	}
+	l.compacting.Lock()
+	defer l.compacting.Unlock()
+	// Items are stored before their mutations are logged, so the snapshot
+	// holds the mutations logged before off. The ones logged after off are
+	// kept, they may end up both in the snapshot and in the new log, which
+	// is harmless, since records hold resulting items, not deltas.
+	l.mu.Lock()
+	off, err := l.offset()
+	l.mu.Unlock()
+	if err != nil {
+		return err
+	}
+	if err = c.SaveFile(l.cfg.SnapshotPath); err != nil {
+		return err
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.rotate(off)
+}
+
+// offset returns the offset of the end of the log. l.mu must be held.
+func (l *appendLog) offset() (int64, error) {
+	if l.fp == nil {
+		return 0, ErrLogNotOpened
+	}
+	return l.fp.Seek(0, io.SeekCurrent)
+}
+
+// rotate replaces the log file with a new one holding the records after off.
+// l.mu must be held.
+func (l *appendLog) rotate(off int64) error {
+	end, err := l.offset()
+	if err != nil {
+		return err
+	}
+	tmp := l.cfg.Path + ".tmp"
+	fp, err := os.OpenFile(tmp, os.O_RDWR|os.O_CREATE|os.O_TRUNC, 0o600)
+	if err != nil {
+		return err
+	}
+	if _, err = io.Copy(fp, io.NewSectionReader(l.fp, off, end-off)); err == nil {
+		err = fp.Sync()
+	}
+	if err == nil {
+		err = os.Rename(tmp, l.cfg.Path)
+	}
+	if err != nil {
+		_ = fp.Close()
+		_ = os.Remove(tmp)
+		return err
+	}
+	_ = l.fp.Close()
+	l.fp = fp
+	l.dirty = false
+	return nil
+}
+
+func (c *cache) closeLog() error {
+	l := c.log.Swap(nil)
+	if l == nil {
+		return nil
+	}
+	c.removeObserver(l.obs)
+	if l.stop != nil {
+		close(l.stop)
+		<-l.done
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	err := l.fp.Sync()
+	if cerr := l.fp.Close(); err == nil {
+		err = cerr
+	}
+	l.fp = nil
+	return err
+}
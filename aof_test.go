@@ -0,0 +1,213 @@
+package cache
+
+import (
+	"encoding/gob"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestLogReplay(t *testing.T) {
+	dir := t.TempDir()
+	cfg := LogConfig{
+		Path:         filepath.Join(dir, "cache.log"),
+		SnapshotPath: filepath.Join(dir, "cache.dat"),
+		Sync:         SyncAlways,
+	}
+	tc := New(DefaultExpiration, 0)
+	if err := tc.OpenLog(cfg); err != nil {
+		t.Fatal("Couldn't open log:", err)
+	}
+	tc.Set("a", 1, DefaultExpiration)
+	tc.Set("b", "b", DefaultExpiration)
+	tc.Set("c", "c", DefaultExpiration)
+	if _, err := tc.IncrementInt("a", 2); err != nil {
+		t.Fatal(err)
+	}
+	tc.Delete("b")
+	if err := tc.Close(); err != nil {
+		t.Fatal("Couldn't close log:", err)
+	}
+
+	oc := New(DefaultExpiration, 0)
+	if err := oc.OpenLog(cfg); err != nil {
+		t.Fatal("Couldn't replay log:", err)
+	}
+	defer oc.Close()
+	if a, _ := oc.Get("a"); a != 3 {
+		t.Error("a is not 3:", a)
+	}
+	if _, found := oc.Get("b"); found {
+		t.Error("b was found after delete")
+	}
+	if c, _ := oc.Get("c"); c != "c" {
+		t.Error("c is not c:", c)
+	}
+	oc.Flush()
+	oc.Set("d", "d", DefaultExpiration)
+	if err := oc.OpenLog(cfg); err != ErrLogOpened {
+		t.Error("log opened twice:", err)
+	}
+}
+
+func TestLogCompaction(t *testing.T) {
+	dir := t.TempDir()
+	cfg := LogConfig{
+		Path:         filepath.Join(dir, "cache.log"),
+		SnapshotPath: filepath.Join(dir, "cache.dat"),
+		Sync:         SyncNever,
+	}
+	tc := New(DefaultExpiration, 0)
+	if err := tc.OpenLog(cfg); err != nil {
+		t.Fatal("Couldn't open log:", err)
+	}
+	tc.Set("a", "a", DefaultExpiration)
+	tc.Set("b", "b", DefaultExpiration)
+	if err := tc.CompactLog(); err != nil {
+		t.Fatal("Couldn't compact log:", err)
+	}
+	if fi, err := os.Stat(cfg.Path); err != nil || fi.Size() != 0 {
+		t.Fatal("log was not truncated:", err)
+	}
+	tc.Set("a", "aa", DefaultExpiration)
+	_ = tc.Close()
+
+	oc := New(DefaultExpiration, 0)
+	if err := oc.OpenLog(cfg); err != nil {
+		t.Fatal("Couldn't replay log:", err)
+	}
+	defer oc.Close()
+	if a, _ := oc.Get("a"); a != "aa" {
+		t.Error("a is not aa:", a)
+	}
+	if b, _ := oc.Get("b"); b != "b" {
+		t.Error("b is not b:", b)
+	}
+}
+
+// setOnEncode sets the key "late" of c when it is encoded.
+type setOnEncode struct {
+	c *Cache
+}
+
+func (v *setOnEncode) GobEncode() ([]byte, error) {
+	if v.c != nil {
+		v.c.Set("late", "late", DefaultExpiration)
+	}
+	return nil, nil
+}
+
+func (v *setOnEncode) GobDecode([]byte) error {
+	return nil
+}
+
+func TestLogCompactionAppends(t *testing.T) {
+	gob.Register(&setOnEncode{})
+	dir := t.TempDir()
+	cfg := LogConfig{
+		Path:         filepath.Join(dir, "cache.log"),
+		SnapshotPath: filepath.Join(dir, "cache.dat"),
+		Sync:         SyncAlways,
+	}
+	tc := New(DefaultExpiration, 0)
+	if err := tc.OpenLog(cfg); err != nil {
+		t.Fatal("Couldn't open log:", err)
+	}
+	// The mutation is logged while the snapshot is written.
+	tc.Set("v", &setOnEncode{c: tc}, DefaultExpiration)
+	if err := tc.CompactLog(); err != nil {
+		t.Fatal("Couldn't compact log:", err)
+	}
+	tc.Set("after", "after", DefaultExpiration)
+	_ = tc.Close()
+
+	oc := New(DefaultExpiration, 0)
+	if err := oc.OpenLog(cfg); err != nil {
+		t.Fatal("Couldn't replay log:", err)
+	}
+	defer oc.Close()
+	for _, k := range []string{"v", "late", "after"} {
+		if _, found := oc.Get(k); !found {
+			t.Error(k, "was lost")
+		}
+	}
+}
+
+func TestLogTornRecord(t *testing.T) {
+	cfg := LogConfig{
+		Path: filepath.Join(t.TempDir(), "cache.log"),
+		Sync: SyncAlways,
+	}
+	tc := New(DefaultExpiration, 0)
+	if err := tc.OpenLog(cfg); err != nil {
+		t.Fatal("Couldn't open log:", err)
+	}
+	tc.Set("a", "a", DefaultExpiration)
+	tc.Set("b", "b", DefaultExpiration)
+	_ = tc.Close()
+
+	fi, err := os.Stat(cfg.Path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = os.Truncate(cfg.Path, fi.Size()-3); err != nil {
+		t.Fatal(err)
+	}
+
+	oc := New(DefaultExpiration, 0)
+	if err = oc.OpenLog(cfg); err != nil {
+		t.Fatal("Couldn't replay log:", err)
+	}
+	if _, found := oc.Get("a"); !found {
+		t.Error("a was not found")
+	}
+	if _, found := oc.Get("b"); found {
+		t.Error("b was found in torn record")
+	}
+	oc.Set("c", "c", DefaultExpiration)
+	_ = oc.Close()
+
+	oc = New(DefaultExpiration, 0)
+	if err = oc.OpenLog(cfg); err != nil {
+		t.Fatal("Couldn't replay log:", err)
+	}
+	defer oc.Close()
+	if _, found := oc.Get("c"); !found {
+		t.Error("c appended after torn record was not found")
+	}
+}
+
+func TestLogCorruptRecord(t *testing.T) {
+	cfg := LogConfig{
+		Path: filepath.Join(t.TempDir(), "cache.log"),
+		Sync: SyncAlways,
+	}
+	tc := New(DefaultExpiration, 0)
+	if err := tc.OpenLog(cfg); err != nil {
+		t.Fatal("Couldn't open log:", err)
+	}
+	tc.Set("a", "a", DefaultExpiration)
+	tc.Set("b", "b", DefaultExpiration)
+	tc.Set("c", "c", DefaultExpiration)
+	_ = tc.Close()
+
+	data, err := os.ReadFile(cfg.Path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Corrupt the payload of a record in the middle of the log.
+	data[len(data)/2] ^= 0xff
+	if err = os.WriteFile(cfg.Path, data, 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	oc := New(DefaultExpiration, 0)
+	defer oc.Close()
+	if err = oc.OpenLog(cfg); !errors.Is(err, ErrCorruptLog) {
+		t.Fatal("unexpected error of a corrupt log:", err)
+	}
+	if fi, err := os.Stat(cfg.Path); err != nil || fi.Size() != int64(len(data)) {
+		t.Error("corrupt log was modified:", err)
+	}
+}
@@ -7,6 +7,7 @@ import (
 	"io"
 	"math"
 	"os"
+	"reflect"
 	"runtime"
 	"runtime/debug"
 	"sync"
@@ -17,6 +18,10 @@ import (
 type Item struct {
 	Object     any
 	Expiration int64
+	// tags are the tags of the item set by SetWithTags, nil if it has none.
+	// They are kept by operations changing the value or expiration of the
+	// existing item, and aren't saved by Save.
+	tags *[]string
 }
 
 // Expired Returns true if the item has expired.
@@ -47,8 +52,101 @@ type cache struct {
 	defaultExpiration time.Duration
 	items             sync.Map
 	onEvicted         func(string, any)
+	onMemberEvicted   func(string, string)
 	timeCache         atomic.Int64
-	stopped           chan any
+	// clockTick is the interval timeCache is updated at.
+	clockTick time.Duration
+	stopped   chan any
+	closeOnce sync.Once
+	// locks serialize writers of the same key, so read-modify-write
+	// operations are atomic and observers see mutations in the order
+	// they were applied. Readers never take them.
+	locks [keyLockStripes]sync.Mutex
+	// versions are incremented by every mutation of a key guarded by the
+	// lock with the same index, to detect conflicting transactions.
+	versions  [keyLockStripes]atomic.Uint64
+	observers atomic.Pointer[[]*observer]
+	log       atomic.Pointer[appendLog]
+	snapshots *snapshotter
+	codec     Codec
+	onEvent   *observer
+	stats     stats
+	index     *prefixIndex
+	tags      atomic.Pointer[tagIndex]
+	// namespaces are the namespaces created by Namespace, guarded by
+	// namespacesMu for writing.
+	namespaces   atomic.Pointer[[]*Namespace]
+	namespacesMu sync.Mutex
+	keyObservers atomic.Pointer[keyObservers]
+	// readOnly is set while the cache follows a leader.
+	readOnly atomic.Bool
+}
+
+// keyLockStripes is the number of mutexes keys are spread over.
+const keyLockStripes = 64
+
+// lock acquires and returns the mutex guarding writes to k. It panics with
+// ErrReadOnly if the cache follows a leader, see Follow, so it is only used
+// by the methods which can't return an error.
+func (c *cache) lock(k string) *sync.Mutex {
+	c.checkWritable()
+	return c.lockKey(k)
+}
+
+// lockWritable same as lock, but returns ErrReadOnly instead of panicking.
+func (c *cache) lockWritable(k string) (*sync.Mutex, error) {
+	if err := c.writable(); err != nil {
+		return nil, err
+	}
+	return c.lockKey(k), nil
+}
+
+// lockKey same as lock, for the writers which may change a read-only cache:
+// the janitor and replication.
+func (c *cache) lockKey(k string) *sync.Mutex {
+	mu := &c.locks[stripe(k)]
+	mu.Lock()
+	return mu
+}
+
+// writable returns ErrReadOnly if the cache follows a leader.
+func (c *cache) writable() error {
+	if c.readOnly.Load() {
+		return ErrReadOnly
+	}
+	return nil
+}
+
+// checkWritable panics with ErrReadOnly if the cache follows a leader.
+func (c *cache) checkWritable() {
+	if err := c.writable(); err != nil {
+		panic(err)
+	}
+}
+
+// stripe returns the index of the mutex guarding writes to k.
+func stripe(k string) uint32 {
+	return djb33(0, k) % keyLockStripes
+}
+
+func (c *cache) lockAll() {
+	for i := range c.locks {
+		c.locks[i].Lock()
+	}
+}
+
+func (c *cache) unlockAll() {
+	for i := range c.locks {
+		c.locks[i].Unlock()
+	}
+}
+
+// store saves item under k and notifies observers. Must be called with the
+// lock of k held.
+func (c *cache) store(op mutationOp, k string, item Item) {
+	c.items.Store(k, item)
+	c.stats.sets.Add(1)
+	c.emit(mutation{op: op, key: k, item: item})
 }
 
 // Set Adds an item to the cache, replacing any existing item. If the duration is 0
@@ -59,6 +157,26 @@ func (c *cache) Set(k string, x any, d time.Duration) {
 }
 
 func (c *cache) set(k string, x any, d time.Duration) {
+	item := c.newItem(x, d)
+	mu := c.lock(k)
+	c.store(opSet, k, item)
+	mu.Unlock()
+}
+
+// TrySet Same as Set, but returns ErrReadOnly instead of panicking if the
+// cache follows a leader.
+func (c *cache) TrySet(k string, x any, d time.Duration) error {
+	item := c.newItem(x, d)
+	mu, err := c.lockWritable(k)
+	if err != nil {
+		return err
+	}
+	c.store(opSet, k, item)
+	mu.Unlock()
+	return nil
+}
+
+func (c *cache) newItem(x any, d time.Duration) Item {
 	var e int64
 	if d == DefaultExpiration {
 		d = c.defaultExpiration
@@ -66,10 +184,10 @@ func (c *cache) set(k string, x any, d time.Duration) {
 	if d > 0 {
 		e = c.timeCache.Load() + d.Nanoseconds()
 	}
-	c.items.Store(k, Item{
+	return Item{
 		Object:     x,
 		Expiration: e,
-	})
+	}
 }
 
 // SetDefault Adds an item to the cache, replacing any existing item, using the default
@@ -86,29 +204,52 @@ var (
 // Add an item to the cache only if an item doesn't already exist for the given
 // key, or if the existing item has expired. Returns an error otherwise.
 func (c *cache) Add(k string, x any, d time.Duration) error {
+	mu, err := c.lockWritable(k)
+	if err != nil {
+		return err
+	}
+	defer mu.Unlock()
 	_, found := c.get(k)
 	if found {
 		return ErrAlreadyExists
 	}
-	c.set(k, x, d)
+	c.store(opSet, k, c.newItem(x, d))
 	return nil
 }
 
 // Replace Sets a new value for the cache key only if it already exists, and the existing
 // item hasn't expired. Returns an error otherwise.
 func (c *cache) Replace(k string, x any, d time.Duration) error {
+	mu, err := c.lockWritable(k)
+	if err != nil {
+		return err
+	}
+	defer mu.Unlock()
 	_, found := c.get(k)
 	if !found {
 		return ErrNotExists
 	}
-	c.set(k, x, d)
+	c.store(opSet, k, c.newItem(x, d))
 	return nil
 }
 
 // Get an item from the cache. Returns the item or nil, and a bool indicating
 // whether the key was found.
 func (c *cache) Get(k string) (any, bool) {
-	return c.get(k)
+	x, found := c.get(k)
+	c.stats.lookup(found)
+	return x, found
+}
+
+// Peek Returns the unexpired item of k, and a bool indicating whether it was
+// found. Unlike Get, it doesn't count as a hit or miss in the statistics of
+// the cache.
+func (c *cache) Peek(k string) (Item, bool) {
+	item, found := c.getItem(k)
+	if !found || item.expired(c.timeCache.Load()) {
+		return Item{}, false
+	}
+	return item, true
 }
 
 // GetWithExpiration returns an item and its expiration time from the cache.
@@ -116,16 +257,11 @@ func (c *cache) Get(k string) (any, bool) {
 // never expires a zero value for time.Time is returned), and a bool indicating
 // whether the key was found.
 func (c *cache) GetWithExpiration(k string) (any, time.Time, bool) {
-	tmp, found := c.items.Load(k)
-	if !found {
+	item, found := c.getItem(k)
+	if !c.stats.lookup(found && !item.expired(c.timeCache.Load())) {
 		return nil, time.Time{}, false
 	}
-	item := tmp.(Item)
 	if item.Expiration > 0 {
-		if c.timeCache.Load() > item.Expiration {
-			return nil, time.Time{}, false
-		}
-
 		// Return the item and the expiration time
 		return item.Object, time.Unix(0, item.Expiration), true
 	}
@@ -136,14 +272,30 @@ func (c *cache) GetWithExpiration(k string) (any, time.Time, bool) {
 }
 
 // GetWithTTL same as GetWithExpiration, but returns time.Duration before value expired.
+// The duration is negative, and zero if the item never expires, see
+// GetWithRemainingTTL for the time left.
 func (c *cache) GetWithTTL(k string) (v any, ttl time.Duration, found bool) {
 	var exp time.Time
-	if v, exp, found = c.GetWithExpiration(k); found {
+	if v, exp, found = c.GetWithExpiration(k); found && !exp.IsZero() {
 		ttl = time.Unix(0, c.timeCache.Load()).Sub(exp)
 	}
 	return
 }
 
+// GetWithRemainingTTL same as GetWithExpiration, but returns the time left
+// before the item expires, or NoExpiration if it never expires.
+func (c *cache) GetWithRemainingTTL(k string) (v any, ttl time.Duration, found bool) {
+	var exp time.Time
+	if v, exp, found = c.GetWithExpiration(k); found {
+		if exp.IsZero() {
+			ttl = NoExpiration
+		} else {
+			ttl = exp.Sub(time.Unix(0, c.timeCache.Load()))
+		}
+	}
+	return
+}
+
 func (c *cache) get(k string) (any, bool) {
 	tmp, found := c.items.Load(k)
 	if !found {
@@ -164,6 +316,52 @@ func (c *cache) getItem(k string) (Item, bool) {
 	return tmp.(Item), true
 }
 
+// Touch Sets a new expiration for the cache key only if it already exists, and the
+// existing item hasn't expired. The duration is interpreted the same as by Set.
+// Returns an error otherwise.
+func (c *cache) Touch(k string, d time.Duration) error {
+	mu, err := c.lockWritable(k)
+	if err != nil {
+		return err
+	}
+	defer mu.Unlock()
+	v, found := c.getItem(k)
+	if !found || v.expired(c.timeCache.Load()) {
+		return ErrNotExists
+	}
+	item := c.newItem(v.Object, d)
+	item.tags = v.tags
+	c.store(opSet, k, item)
+	return nil
+}
+
+// Modify Atomically replaces the value of the cache key with the result of f
+// called with the current value, keeping the item's expiration. Returns
+// ErrNotExists if the key doesn't exist or the item has expired, or the error
+// returned by f, in which case the item isn't changed.
+//
+// f is called with the lock of the key held, which is shared with other keys,
+// so it must return quickly and must not modify the cache, or it may
+// deadlock. Use Txn to modify several keys at once.
+func (c *cache) Modify(k string, f func(x any) (any, error)) error {
+	mu, err := c.lockWritable(k)
+	if err != nil {
+		return err
+	}
+	defer mu.Unlock()
+	v, found := c.getItem(k)
+	if !found || v.expired(c.timeCache.Load()) {
+		return ErrNotExists
+	}
+	x, err := f(v.Object)
+	if err != nil {
+		return err
+	}
+	v.Object = x
+	c.store(opSet, k, v)
+	return nil
+}
+
 var ErrInvalidType = errors.New("incompatible value type")
 
 // Increment an item of type int, int8, int16, int32, int64, uintptr, uint,
@@ -172,42 +370,55 @@ var ErrInvalidType = errors.New("incompatible value type")
 // possible to increment it by n. To retrieve the incremented value, use one
 // of the specialized methods, e.g. IncrementInt64.
 func (c *cache) Increment(k string, n int64) error {
+	mu, err := c.lockWritable(k)
+	if err != nil {
+		return err
+	}
+	defer mu.Unlock()
 	v, found := c.getItem(k)
 	if !found || v.expired(c.timeCache.Load()) {
 		return ErrNotExists
 	}
-	switch v.Object.(type) {
+	x, err := incrementValue(v.Object, n)
+	if err != nil {
+		return err
+	}
+	v.Object = x
+	c.store(opIncrement, k, v)
+	return nil
+}
+
+// incrementValue returns x incremented by n, see Increment.
+func incrementValue(x any, n int64) (any, error) {
+	switch v := x.(type) {
 	case int:
-		v.Object = v.Object.(int) + int(n)
+		return v + int(n), nil
 	case int8:
-		v.Object = v.Object.(int8) + int8(n)
+		return v + int8(n), nil
 	case int16:
-		v.Object = v.Object.(int16) + int16(n)
+		return v + int16(n), nil
 	case int32:
-		v.Object = v.Object.(int32) + int32(n)
+		return v + int32(n), nil
 	case int64:
-		v.Object = v.Object.(int64) + n
+		return v + n, nil
 	case uint:
-		v.Object = v.Object.(uint) + uint(n)
+		return v + uint(n), nil
 	case uintptr:
-		v.Object = v.Object.(uintptr) + uintptr(n)
+		return v + uintptr(n), nil
 	case uint8:
-		v.Object = v.Object.(uint8) + uint8(n)
+		return v + uint8(n), nil
 	case uint16:
-		v.Object = v.Object.(uint16) + uint16(n)
+		return v + uint16(n), nil
 	case uint32:
-		v.Object = v.Object.(uint32) + uint32(n)
+		return v + uint32(n), nil
 	case uint64:
-		v.Object = v.Object.(uint64) + uint64(n)
+		return v + uint64(n), nil
 	case float32:
-		v.Object = v.Object.(float32) + float32(n)
+		return v + float32(n), nil
 	case float64:
-		v.Object = v.Object.(float64) + float64(n)
-	default:
-		return ErrInvalidType
+		return v + float64(n), nil
 	}
-	c.items.Store(k, v)
-	return nil
+	return nil, ErrInvalidType
 }
 
 // IncrementFloat Increments an item of type float32 or float64 by n. Returns an error if the
@@ -216,6 +427,11 @@ func (c *cache) Increment(k string, n int64) error {
 // value. To retrieve the incremented value, use one of the specialized methods,
 // e.g. IncrementFloat64.
 func (c *cache) IncrementFloat(k string, n float64) error {
+	mu, err := c.lockWritable(k)
+	if err != nil {
+		return err
+	}
+	defer mu.Unlock()
 	v, found := c.getItem(k)
 	if !found || v.expired(c.timeCache.Load()) {
 		return ErrNotExists
@@ -228,7 +444,7 @@ func (c *cache) IncrementFloat(k string, n float64) error {
 	default:
 		return ErrInvalidType
 	}
-	c.items.Store(k, v)
+	c.store(opIncrement, k, v)
 	return nil
 }
 
@@ -236,6 +452,11 @@ func (c *cache) IncrementFloat(k string, n float64) error {
 // not an int, or if it was not found. If there is no error, the incremented
 // value is returned.
 func (c *cache) IncrementInt(k string, n int) (int, error) {
+	mu, err := c.lockWritable(k)
+	if err != nil {
+		return 0, err
+	}
+	defer mu.Unlock()
 	v, found := c.getItem(k)
 	if !found || v.expired(c.timeCache.Load()) {
 		return 0, ErrNotExists
@@ -246,7 +467,7 @@ func (c *cache) IncrementInt(k string, n int) (int, error) {
 	}
 	nv := rv + n
 	v.Object = nv
-	c.items.Store(k, v)
+	c.store(opIncrement, k, v)
 	return nv, nil
 }
 
@@ -254,6 +475,11 @@ func (c *cache) IncrementInt(k string, n int) (int, error) {
 // not an int8, or if it was not found. If there is no error, the incremented
 // value is returned.
 func (c *cache) IncrementInt8(k string, n int8) (int8, error) {
+	mu, err := c.lockWritable(k)
+	if err != nil {
+		return 0, err
+	}
+	defer mu.Unlock()
 	v, found := c.getItem(k)
 	if !found || v.expired(c.timeCache.Load()) {
 		return 0, ErrNotExists
@@ -264,7 +490,7 @@ func (c *cache) IncrementInt8(k string, n int8) (int8, error) {
 	}
 	nv := rv + n
 	v.Object = nv
-	c.items.Store(k, v)
+	c.store(opIncrement, k, v)
 	return nv, nil
 }
 
@@ -272,6 +498,11 @@ func (c *cache) IncrementInt8(k string, n int8) (int8, error) {
 // not an int16, or if it was not found. If there is no error, the incremented
 // value is returned.
 func (c *cache) IncrementInt16(k string, n int16) (int16, error) {
+	mu, err := c.lockWritable(k)
+	if err != nil {
+		return 0, err
+	}
+	defer mu.Unlock()
 	v, found := c.getItem(k)
 	if !found || v.expired(c.timeCache.Load()) {
 		return 0, ErrNotExists
@@ -282,7 +513,7 @@ func (c *cache) IncrementInt16(k string, n int16) (int16, error) {
 	}
 	nv := rv + n
 	v.Object = nv
-	c.items.Store(k, v)
+	c.store(opIncrement, k, v)
 	return nv, nil
 }
 
@@ -290,6 +521,11 @@ func (c *cache) IncrementInt16(k string, n int16) (int16, error) {
 // not an int32, or if it was not found. If there is no error, the incremented
 // value is returned.
 func (c *cache) IncrementInt32(k string, n int32) (int32, error) {
+	mu, err := c.lockWritable(k)
+	if err != nil {
+		return 0, err
+	}
+	defer mu.Unlock()
 	v, found := c.getItem(k)
 	if !found || v.expired(c.timeCache.Load()) {
 		return 0, ErrNotExists
@@ -300,7 +536,7 @@ func (c *cache) IncrementInt32(k string, n int32) (int32, error) {
 	}
 	nv := rv + n
 	v.Object = nv
-	c.items.Store(k, v)
+	c.store(opIncrement, k, v)
 	return nv, nil
 }
 
@@ -308,6 +544,11 @@ func (c *cache) IncrementInt32(k string, n int32) (int32, error) {
 // not an int64, or if it was not found. If there is no error, the incremented
 // value is returned.
 func (c *cache) IncrementInt64(k string, n int64) (int64, error) {
+	mu, err := c.lockWritable(k)
+	if err != nil {
+		return 0, err
+	}
+	defer mu.Unlock()
 	v, found := c.getItem(k)
 	if !found || v.expired(c.timeCache.Load()) {
 		return 0, ErrNotExists
@@ -318,7 +559,7 @@ func (c *cache) IncrementInt64(k string, n int64) (int64, error) {
 	}
 	nv := rv + n
 	v.Object = nv
-	c.items.Store(k, v)
+	c.store(opIncrement, k, v)
 	return nv, nil
 }
 
@@ -326,6 +567,11 @@ func (c *cache) IncrementInt64(k string, n int64) (int64, error) {
 // not an uint, or if it was not found. If there is no error, the incremented
 // value is returned.
 func (c *cache) IncrementUint(k string, n uint) (uint, error) {
+	mu, err := c.lockWritable(k)
+	if err != nil {
+		return 0, err
+	}
+	defer mu.Unlock()
 	v, found := c.getItem(k)
 	if !found || v.expired(c.timeCache.Load()) {
 		return 0, ErrNotExists
@@ -336,7 +582,7 @@ func (c *cache) IncrementUint(k string, n uint) (uint, error) {
 	}
 	nv := rv + n
 	v.Object = nv
-	c.items.Store(k, v)
+	c.store(opIncrement, k, v)
 	return nv, nil
 }
 
@@ -344,6 +590,11 @@ func (c *cache) IncrementUint(k string, n uint) (uint, error) {
 // is not an uintptr, or if it was not found. If there is no error, the
 // incremented value is returned.
 func (c *cache) IncrementUintptr(k string, n uintptr) (uintptr, error) {
+	mu, err := c.lockWritable(k)
+	if err != nil {
+		return 0, err
+	}
+	defer mu.Unlock()
 	v, found := c.getItem(k)
 	if !found || v.expired(c.timeCache.Load()) {
 		return 0, ErrNotExists
@@ -354,7 +605,7 @@ func (c *cache) IncrementUintptr(k string, n uintptr) (uintptr, error) {
 	}
 	nv := rv + n
 	v.Object = nv
-	c.items.Store(k, v)
+	c.store(opIncrement, k, v)
 	return nv, nil
 }
 
@@ -362,6 +613,11 @@ func (c *cache) IncrementUintptr(k string, n uintptr) (uintptr, error) {
 // is not an uint8, or if it was not found. If there is no error, the
 // incremented value is returned.
 func (c *cache) IncrementUint8(k string, n uint8) (uint8, error) {
+	mu, err := c.lockWritable(k)
+	if err != nil {
+		return 0, err
+	}
+	defer mu.Unlock()
 	v, found := c.getItem(k)
 	if !found || v.expired(c.timeCache.Load()) {
 		return 0, ErrNotExists
@@ -372,7 +628,7 @@ func (c *cache) IncrementUint8(k string, n uint8) (uint8, error) {
 	}
 	nv := rv + n
 	v.Object = nv
-	c.items.Store(k, v)
+	c.store(opIncrement, k, v)
 	return nv, nil
 }
 
@@ -380,6 +636,11 @@ func (c *cache) IncrementUint8(k string, n uint8) (uint8, error) {
 // is not an uint16, or if it was not found. If there is no error, the
 // incremented value is returned.
 func (c *cache) IncrementUint16(k string, n uint16) (uint16, error) {
+	mu, err := c.lockWritable(k)
+	if err != nil {
+		return 0, err
+	}
+	defer mu.Unlock()
 	v, found := c.getItem(k)
 	if !found || v.expired(c.timeCache.Load()) {
 		return 0, ErrNotExists
@@ -390,7 +651,7 @@ func (c *cache) IncrementUint16(k string, n uint16) (uint16, error) {
 	}
 	nv := rv + n
 	v.Object = nv
-	c.items.Store(k, v)
+	c.store(opIncrement, k, v)
 	return nv, nil
 }
 
@@ -398,6 +659,11 @@ func (c *cache) IncrementUint16(k string, n uint16) (uint16, error) {
 // is not an uint32, or if it was not found. If there is no error, the
 // incremented value is returned.
 func (c *cache) IncrementUint32(k string, n uint32) (uint32, error) {
+	mu, err := c.lockWritable(k)
+	if err != nil {
+		return 0, err
+	}
+	defer mu.Unlock()
 	v, found := c.getItem(k)
 	if !found || v.expired(c.timeCache.Load()) {
 		return 0, ErrNotExists
@@ -408,7 +674,7 @@ func (c *cache) IncrementUint32(k string, n uint32) (uint32, error) {
 	}
 	nv := rv + n
 	v.Object = nv
-	c.items.Store(k, v)
+	c.store(opIncrement, k, v)
 	return nv, nil
 }
 
@@ -416,6 +682,11 @@ func (c *cache) IncrementUint32(k string, n uint32) (uint32, error) {
 // is not an uint64, or if it was not found. If there is no error, the
 // incremented value is returned.
 func (c *cache) IncrementUint64(k string, n uint64) (uint64, error) {
+	mu, err := c.lockWritable(k)
+	if err != nil {
+		return 0, err
+	}
+	defer mu.Unlock()
 	v, found := c.getItem(k)
 	if !found || v.expired(c.timeCache.Load()) {
 		return 0, ErrNotExists
@@ -426,7 +697,7 @@ func (c *cache) IncrementUint64(k string, n uint64) (uint64, error) {
 	}
 	nv := rv + n
 	v.Object = nv
-	c.items.Store(k, v)
+	c.store(opIncrement, k, v)
 	return nv, nil
 }
 
@@ -434,6 +705,11 @@ func (c *cache) IncrementUint64(k string, n uint64) (uint64, error) {
 // is not an float32, or if it was not found. If there is no error, the
 // incremented value is returned.
 func (c *cache) IncrementFloat32(k string, n float32) (float32, error) {
+	mu, err := c.lockWritable(k)
+	if err != nil {
+		return 0, err
+	}
+	defer mu.Unlock()
 	v, found := c.getItem(k)
 	if !found || v.expired(c.timeCache.Load()) {
 		return 0, ErrNotExists
@@ -444,7 +720,7 @@ func (c *cache) IncrementFloat32(k string, n float32) (float32, error) {
 	}
 	nv := rv + n
 	v.Object = nv
-	c.items.Store(k, v)
+	c.store(opIncrement, k, v)
 	return nv, nil
 }
 
@@ -452,6 +728,11 @@ func (c *cache) IncrementFloat32(k string, n float32) (float32, error) {
 // is not an float64, or if it was not found. If there is no error, the
 // incremented value is returned.
 func (c *cache) IncrementFloat64(k string, n float64) (float64, error) {
+	mu, err := c.lockWritable(k)
+	if err != nil {
+		return 0, err
+	}
+	defer mu.Unlock()
 	v, found := c.getItem(k)
 	if !found || v.expired(c.timeCache.Load()) {
 		return 0, ErrNotExists
@@ -462,7 +743,7 @@ func (c *cache) IncrementFloat64(k string, n float64) (float64, error) {
 	}
 	nv := rv + n
 	v.Object = nv
-	c.items.Store(k, v)
+	c.store(opIncrement, k, v)
 	return nv, nil
 }
 
@@ -474,6 +755,11 @@ func (c *cache) IncrementFloat64(k string, n float64) (float64, error) {
 func (c *cache) Decrement(k string, n int64) error {
 	// TODO: Implement Increment and Decrement more cleanly.
 	// (Cannot do Increment(k, n*-1) for uints.)
+	mu, err := c.lockWritable(k)
+	if err != nil {
+		return err
+	}
+	defer mu.Unlock()
 	v, found := c.getItem(k)
 	if !found || v.expired(c.timeCache.Load()) {
 		return ErrNotExists
@@ -508,7 +794,7 @@ func (c *cache) Decrement(k string, n int64) error {
 	default:
 		return ErrInvalidType
 	}
-	c.items.Store(k, v)
+	c.store(opIncrement, k, v)
 	return nil
 }
 
@@ -518,6 +804,11 @@ func (c *cache) Decrement(k string, n int64) error {
 // value. To retrieve the decremented value, use one of the specialized methods,
 // e.g. DecrementFloat64.
 func (c *cache) DecrementFloat(k string, n float64) error {
+	mu, err := c.lockWritable(k)
+	if err != nil {
+		return err
+	}
+	defer mu.Unlock()
 	v, found := c.getItem(k)
 	if !found || v.expired(c.timeCache.Load()) {
 		return ErrNotExists
@@ -530,7 +821,7 @@ func (c *cache) DecrementFloat(k string, n float64) error {
 	default:
 		return ErrInvalidType
 	}
-	c.items.Store(k, v)
+	c.store(opIncrement, k, v)
 	return nil
 }
 
@@ -538,6 +829,11 @@ func (c *cache) DecrementFloat(k string, n float64) error {
 // not an int, or if it was not found. If there is no error, the decremented
 // value is returned.
 func (c *cache) DecrementInt(k string, n int) (int, error) {
+	mu, err := c.lockWritable(k)
+	if err != nil {
+		return 0, err
+	}
+	defer mu.Unlock()
 	v, found := c.getItem(k)
 	if !found || v.expired(c.timeCache.Load()) {
 		return 0, ErrNotExists
@@ -548,7 +844,7 @@ func (c *cache) DecrementInt(k string, n int) (int, error) {
 	}
 	nv := rv - n
 	v.Object = nv
-	c.items.Store(k, v)
+	c.store(opIncrement, k, v)
 	return nv, nil
 }
 
@@ -556,6 +852,11 @@ func (c *cache) DecrementInt(k string, n int) (int, error) {
 // not an int8, or if it was not found. If there is no error, the decremented
 // value is returned.
 func (c *cache) DecrementInt8(k string, n int8) (int8, error) {
+	mu, err := c.lockWritable(k)
+	if err != nil {
+		return 0, err
+	}
+	defer mu.Unlock()
 	v, found := c.getItem(k)
 	if !found || v.expired(c.timeCache.Load()) {
 		return 0, ErrNotExists
@@ -566,7 +867,7 @@ func (c *cache) DecrementInt8(k string, n int8) (int8, error) {
 	}
 	nv := rv - n
 	v.Object = nv
-	c.items.Store(k, v)
+	c.store(opIncrement, k, v)
 	return nv, nil
 }
 
@@ -574,6 +875,11 @@ func (c *cache) DecrementInt8(k string, n int8) (int8, error) {
 // not an int16, or if it was not found. If there is no error, the decremented
 // value is returned.
 func (c *cache) DecrementInt16(k string, n int16) (int16, error) {
+	mu, err := c.lockWritable(k)
+	if err != nil {
+		return 0, err
+	}
+	defer mu.Unlock()
 	v, found := c.getItem(k)
 	if !found || v.expired(c.timeCache.Load()) {
 		return 0, ErrNotExists
@@ -584,7 +890,7 @@ func (c *cache) DecrementInt16(k string, n int16) (int16, error) {
 	}
 	nv := rv - n
 	v.Object = nv
-	c.items.Store(k, v)
+	c.store(opIncrement, k, v)
 	return nv, nil
 }
 
@@ -592,6 +898,11 @@ func (c *cache) DecrementInt16(k string, n int16) (int16, error) {
 // not an int32, or if it was not found. If there is no error, the decremented
 // value is returned.
 func (c *cache) DecrementInt32(k string, n int32) (int32, error) {
+	mu, err := c.lockWritable(k)
+	if err != nil {
+		return 0, err
+	}
+	defer mu.Unlock()
 	v, found := c.getItem(k)
 	if !found || v.expired(c.timeCache.Load()) {
 		return 0, ErrNotExists
@@ -602,7 +913,7 @@ func (c *cache) DecrementInt32(k string, n int32) (int32, error) {
 	}
 	nv := rv - n
 	v.Object = nv
-	c.items.Store(k, v)
+	c.store(opIncrement, k, v)
 	return nv, nil
 }
 
@@ -610,6 +921,11 @@ func (c *cache) DecrementInt32(k string, n int32) (int32, error) {
 // not an int64, or if it was not found. If there is no error, the decremented
 // value is returned.
 func (c *cache) DecrementInt64(k string, n int64) (int64, error) {
+	mu, err := c.lockWritable(k)
+	if err != nil {
+		return 0, err
+	}
+	defer mu.Unlock()
 	v, found := c.getItem(k)
 	if !found || v.expired(c.timeCache.Load()) {
 		return 0, ErrNotExists
@@ -620,7 +936,7 @@ func (c *cache) DecrementInt64(k string, n int64) (int64, error) {
 	}
 	nv := rv - n
 	v.Object = nv
-	c.items.Store(k, v)
+	c.store(opIncrement, k, v)
 	return nv, nil
 }
 
@@ -628,6 +944,11 @@ func (c *cache) DecrementInt64(k string, n int64) (int64, error) {
 // not an uint, or if it was not found. If there is no error, the decremented
 // value is returned.
 func (c *cache) DecrementUint(k string, n uint) (uint, error) {
+	mu, err := c.lockWritable(k)
+	if err != nil {
+		return 0, err
+	}
+	defer mu.Unlock()
 	v, found := c.getItem(k)
 	if !found || v.expired(c.timeCache.Load()) {
 		return 0, ErrNotExists
@@ -638,7 +959,7 @@ func (c *cache) DecrementUint(k string, n uint) (uint, error) {
 	}
 	nv := rv - n
 	v.Object = nv
-	c.items.Store(k, v)
+	c.store(opIncrement, k, v)
 	return nv, nil
 }
 
@@ -646,6 +967,11 @@ func (c *cache) DecrementUint(k string, n uint) (uint, error) {
 // is not an uintptr, or if it was not found. If there is no error, the
 // decremented value is returned.
 func (c *cache) DecrementUintptr(k string, n uintptr) (uintptr, error) {
+	mu, err := c.lockWritable(k)
+	if err != nil {
+		return 0, err
+	}
+	defer mu.Unlock()
 	v, found := c.getItem(k)
 	if !found || v.expired(c.timeCache.Load()) {
 		return 0, ErrNotExists
@@ -656,7 +982,7 @@ func (c *cache) DecrementUintptr(k string, n uintptr) (uintptr, error) {
 	}
 	nv := rv - n
 	v.Object = nv
-	c.items.Store(k, v)
+	c.store(opIncrement, k, v)
 	return nv, nil
 }
 
@@ -664,6 +990,11 @@ func (c *cache) DecrementUintptr(k string, n uintptr) (uintptr, error) {
 // not an uint8, or if it was not found. If there is no error, the decremented
 // value is returned.
 func (c *cache) DecrementUint8(k string, n uint8) (uint8, error) {
+	mu, err := c.lockWritable(k)
+	if err != nil {
+		return 0, err
+	}
+	defer mu.Unlock()
 	v, found := c.getItem(k)
 	if !found || v.expired(c.timeCache.Load()) {
 		return 0, ErrNotExists
@@ -674,7 +1005,7 @@ func (c *cache) DecrementUint8(k string, n uint8) (uint8, error) {
 	}
 	nv := rv - n
 	v.Object = nv
-	c.items.Store(k, v)
+	c.store(opIncrement, k, v)
 	return nv, nil
 }
 
@@ -682,6 +1013,11 @@ func (c *cache) DecrementUint8(k string, n uint8) (uint8, error) {
 // is not an uint16, or if it was not found. If there is no error, the
 // decremented value is returned.
 func (c *cache) DecrementUint16(k string, n uint16) (uint16, error) {
+	mu, err := c.lockWritable(k)
+	if err != nil {
+		return 0, err
+	}
+	defer mu.Unlock()
 	v, found := c.getItem(k)
 	if !found || v.expired(c.timeCache.Load()) {
 		return 0, ErrNotExists
@@ -692,7 +1028,7 @@ func (c *cache) DecrementUint16(k string, n uint16) (uint16, error) {
 	}
 	nv := rv - n
 	v.Object = nv
-	c.items.Store(k, v)
+	c.store(opIncrement, k, v)
 	return nv, nil
 }
 
@@ -700,6 +1036,11 @@ func (c *cache) DecrementUint16(k string, n uint16) (uint16, error) {
 // is not an uint32, or if it was not found. If there is no error, the
 // decremented value is returned.
 func (c *cache) DecrementUint32(k string, n uint32) (uint32, error) {
+	mu, err := c.lockWritable(k)
+	if err != nil {
+		return 0, err
+	}
+	defer mu.Unlock()
 	v, found := c.getItem(k)
 	if !found || v.expired(c.timeCache.Load()) {
 		return 0, ErrNotExists
@@ -710,7 +1051,7 @@ func (c *cache) DecrementUint32(k string, n uint32) (uint32, error) {
 	}
 	nv := rv - n
 	v.Object = nv
-	c.items.Store(k, v)
+	c.store(opIncrement, k, v)
 	return nv, nil
 }
 
@@ -718,6 +1059,11 @@ func (c *cache) DecrementUint32(k string, n uint32) (uint32, error) {
 // is not an uint64, or if it was not found. If there is no error, the
 // decremented value is returned.
 func (c *cache) DecrementUint64(k string, n uint64) (uint64, error) {
+	mu, err := c.lockWritable(k)
+	if err != nil {
+		return 0, err
+	}
+	defer mu.Unlock()
 	v, found := c.getItem(k)
 	if !found || v.expired(c.timeCache.Load()) {
 		return 0, ErrNotExists
@@ -728,7 +1074,7 @@ func (c *cache) DecrementUint64(k string, n uint64) (uint64, error) {
 	}
 	nv := rv - n
 	v.Object = nv
-	c.items.Store(k, v)
+	c.store(opIncrement, k, v)
 	return nv, nil
 }
 
@@ -736,6 +1082,11 @@ func (c *cache) DecrementUint64(k string, n uint64) (uint64, error) {
 // is not an float32, or if it was not found. If there is no error, the
 // decremented value is returned.
 func (c *cache) DecrementFloat32(k string, n float32) (float32, error) {
+	mu, err := c.lockWritable(k)
+	if err != nil {
+		return 0, err
+	}
+	defer mu.Unlock()
 	v, found := c.getItem(k)
 	if !found || v.expired(c.timeCache.Load()) {
 		return 0, ErrNotExists
@@ -746,7 +1097,7 @@ func (c *cache) DecrementFloat32(k string, n float32) (float32, error) {
 	}
 	nv := rv - n
 	v.Object = nv
-	c.items.Store(k, v)
+	c.store(opIncrement, k, v)
 	return nv, nil
 }
 
@@ -754,6 +1105,11 @@ func (c *cache) DecrementFloat32(k string, n float32) (float32, error) {
 // is not an float64, or if it was not found. If there is no error, the
 // decremented value is returned.
 func (c *cache) DecrementFloat64(k string, n float64) (float64, error) {
+	mu, err := c.lockWritable(k)
+	if err != nil {
+		return 0, err
+	}
+	defer mu.Unlock()
 	v, found := c.getItem(k)
 	if !found || v.expired(c.timeCache.Load()) {
 		return 0, ErrNotExists
@@ -764,28 +1120,81 @@ func (c *cache) DecrementFloat64(k string, n float64) (float64, error) {
 	}
 	nv := rv - n
 	v.Object = nv
-	c.items.Store(k, v)
+	c.store(opIncrement, k, v)
 	return nv, nil
 }
 
 // Delete an item from the cache. Does nothing if the key is not in the cache.
 func (c *cache) Delete(k string) {
-	if v, evicted := c.delete(k); evicted {
-		c.onEvicted(k, v)
+	if v, found := c.delete(k); found {
+		c.evicted(k, v)
 	}
 }
 
+// TryDelete Same as Delete, but reports whether the item was found, i.e. it
+// was in the cache and hadn't expired, and returns ErrReadOnly instead of
+// panicking if the cache follows a leader.
+func (c *cache) TryDelete(k string) (bool, error) {
+	mu, err := c.lockWritable(k)
+	if err != nil {
+		return false, err
+	}
+	var found bool
+	v, deleted := c.deleteLocked(k, func(item Item) bool {
+		found = !item.expired(c.timeCache.Load())
+		return true
+	})
+	mu.Unlock()
+	if deleted {
+		c.evicted(k, v)
+	}
+	return found, nil
+}
+
+// delete removes k and returns its value, and whether it was in the cache.
 func (c *cache) delete(k string) (any, bool) {
-	if c.onEvicted != nil {
-		tmp, found := c.items.Load(k)
-		v := tmp.(Item)
-		if found {
-			c.items.Delete(k)
-			return v.Object, true
-		}
+	return c.deleteIf(k, nil)
+}
+
+// deleteIf same as delete, but removes k only if f returns true for its item,
+// unless f is nil.
+func (c *cache) deleteIf(k string, f func(Item) bool) (any, bool) {
+	mu := c.lock(k)
+	defer mu.Unlock()
+	return c.deleteLocked(k, f)
+}
+
+// deleteLocked same as deleteIf, with the lock of k held.
+func (c *cache) deleteLocked(k string, f func(Item) bool) (any, bool) {
+	tmp, found := c.items.Load(k)
+	if !found || (f != nil && !f(tmp.(Item))) {
+		return nil, false
 	}
 	c.items.Delete(k)
-	return nil, false
+	v := tmp.(Item)
+	c.stats.deletes.Add(1)
+	c.emit(mutation{op: opDelete, key: k, item: v})
+	return v.Object, true
+}
+
+// deleteIfExpired removes k if it is (still) expired at now, and returns its
+// value and whether it was removed. The check is repeated under the key lock,
+// because the item may have been replaced since it was seen expired.
+func (c *cache) deleteIfExpired(k string, now int64) (any, bool) {
+	mu := c.lockKey(k)
+	defer mu.Unlock()
+	tmp, found := c.items.Load(k)
+	if !found {
+		return nil, false
+	}
+	v := tmp.(Item)
+	if !v.expired(now) {
+		return nil, false
+	}
+	c.items.Delete(k)
+	c.stats.expirations.Add(1)
+	c.emit(mutation{op: opExpire, key: k, item: v})
+	return v.Object, true
 }
 
 type kv struct {
@@ -795,39 +1204,30 @@ type kv struct {
 
 // DeleteExpired Deletes all expired items from the cache.
 func (c *cache) DeleteExpired() {
-	var evictedItems []kv
-	now := c.timeCache.Load()
-	c.items.Range(func(key, value any) bool {
-		v := value.(Item)
-		k := key.(string)
-		if v.expired(now) {
-			if ov, evicted := c.delete(k); evicted {
-				evictedItems = append(evictedItems, kv{k, ov})
-			}
-		}
-		return true // if false, Range stops
-	})
-
-	for _, v := range evictedItems {
-		c.onEvicted(v.key, v.value)
-	}
+	c.deleteExpired(c.timeCache.Load())
 }
 
 func (c *cache) deleteExpired(now int64) {
 	var evictedItems []kv
+	var sets []string
 	c.items.Range(func(key, value any) bool {
 		v := value.(Item)
 		k := key.(string)
 		if v.expired(now) {
-			if ov, evicted := c.delete(k); evicted {
+			if ov, deleted := c.deleteIfExpired(k, now); deleted && c.notifiesEvictions() {
 				evictedItems = append(evictedItems, kv{k, ov})
 			}
+		} else if s, ok := v.Object.(*ExpiringSet); ok && s.expires(now) && !c.readOnly.Load() {
+			sets = append(sets, k)
 		}
 		return true // if false, Range stops
 	})
 
 	for _, v := range evictedItems {
-		c.onEvicted(v.key, v.value)
+		c.evicted(v.key, v.value)
+	}
+	for _, k := range sets {
+		c.pruneExpiringSet(k, now)
 	}
 }
 
@@ -838,20 +1238,45 @@ func (c *cache) OnEvicted(f func(string, any)) {
 	c.onEvicted = f
 }
 
-// Save Writes the cache's items (using Gob) to an io.Writer.
+// notifiesEvictions reports whether evicted items must be passed to evicted.
+func (c *cache) notifiesEvictions() bool {
+	return c.onEvicted != nil || c.namespaces.Load() != nil
+}
+
+// evicted calls the OnEvicted functions of the cache and of the namespace
+// of k, if any.
+func (c *cache) evicted(k string, v any) {
+	if c.onEvicted != nil {
+		c.onEvicted(k, v)
+	}
+	if ns := c.namespaceOf(k); ns != nil {
+		if f := ns.onEvicted.Load(); f != nil {
+			(*f)(k[len(ns.prefix):], v)
+		}
+	}
+}
+
+// Save Writes the cache's items to an io.Writer. Values are encoded with the
+// codecs registered for their types with RegisterCodec, or with the cache's
+// default codec (see WithCodec), which is Gob unless configured otherwise.
 //
 // NOTE: This method is deprecated in favor of c.Items() and NewFrom() (see the
 // documentation for NewFrom().)
-func (c *cache) Save(w io.Writer) (err error) {
-	m := make(map[string]Item)
-	c.items.Range(func(key, value any) bool {
-		v := value.(Item)
-		k := key.(string)
-		m[k] = v
-		return true // if false, Range stops
-	})
+func (c *cache) Save(w io.Writer) error {
+	return c.writeSnapshot(w)
+}
+
+// gobTypes are the types registered by gobRegister.
+var gobTypes sync.Map
 
-	enc := gob.NewEncoder(w)
+// gobRegister registers the type of x with Gob, converting the panic raised
+// for unsupported types into an error. Types are registered once, since
+// gob.Register is costly and serialized.
+func gobRegister(x any) (err error) {
+	t := reflect.TypeOf(x)
+	if _, found := gobTypes.Load(t); found {
+		return nil
+	}
 	defer func() {
 		if x := recover(); x != nil {
 			switch a := x.(type) {
@@ -867,49 +1292,40 @@ func (c *cache) Save(w io.Writer) (err error) {
 			}
 		}
 	}()
-	for _, v := range m {
-		gob.Register(v.Object)
-	}
-	err = enc.Encode(m)
+	gob.Register(x)
+	gobTypes.Store(t, struct{}{})
 	return
 }
 
 // SaveFile Saves the cache's items to the given filename, creating the file if it
-// doesn't exist, and overwriting it if it does.
+// doesn't exist, and overwriting it if it does. The items are written to a
+// temporary file in the same directory which is synced and then atomically
+// renamed to fname, so a crash during the save never destroys the previous
+// snapshot.
 //
 // NOTE: This method is deprecated in favor of c.Items() and NewFrom() (see the
 // documentation for NewFrom().)
 func (c *cache) SaveFile(fname string) error {
-	fp, err := os.Create(fname)
-	if err != nil {
-		return err
-	}
-	defer fp.Close()
-	err = c.Save(fp)
-	if err != nil {
-		return err
-	}
-	return nil
+	return c.SaveFileRotate(fname, 0)
 }
 
-// Load Adds (Gob-serialized) cache items from an io.Reader, excluding any items with
-// keys that already exist (and haven't expired) in the current cache.
+// SaveFileRotate same as SaveFile, but keeps up to keep previous snapshots
+// next to fname, named fname.1 (the most recent) to fname.<keep> (the oldest).
+// If keep is less than one, previous snapshots are not kept.
+func (c *cache) SaveFileRotate(fname string, keep int) error {
+	return writeFileAtomic(fname, keep, c.Save)
+}
+
+// Load Adds cache items saved by Save from an io.Reader, excluding any items
+// with keys that already exist (and haven't expired) in the current cache.
+// Data written by Save of previous versions, which is a Gob-encoded items
+// map, is loaded as well. See LoadWithOptions for other ways to merge the
+// loaded items.
 //
 // NOTE: This method is deprecated in favor of c.Items() and NewFrom() (see the
 // documentation for NewFrom().)
 func (c *cache) Load(r io.Reader) error {
-	dec := gob.NewDecoder(r)
-	items := map[string]Item{}
-	err := dec.Decode(&items)
-	if err == nil {
-		for k, v := range items {
-			ov, found := c.getItem(k)
-			if !found || ov.expired(c.timeCache.Load()) {
-				c.items.Store(k, v)
-			}
-		}
-	}
-	return err
+	return c.LoadWithOptions(r, LoadOptions{})
 }
 
 // LoadFile Loads and add cache items from the given filename, excluding any items with
@@ -932,17 +1348,7 @@ func (c *cache) LoadFile(fname string) error {
 
 // Items Copies all unexpired items in the cache into a new map and returns it.
 func (c *cache) Items() map[string]Item {
-	m := make(map[string]Item)
-	now := c.timeCache.Load()
-	c.items.Range(func(key, value any) bool {
-		v := value.(Item)
-		k := key.(string)
-		if !v.expired(now) {
-			m[k] = v
-		}
-		return true // if false, Range stops
-	})
-	return m
+	return Collect(c.All())
 }
 
 // ItemCount Returns the number of items in the cache. This may include items that have
@@ -958,11 +1364,48 @@ func (c *cache) ItemCount() int {
 
 // Flush Deletes all items from the cache.
 func (c *cache) Flush() {
+	c.checkWritable()
+	c.flush()
+}
+
+// TryFlush Same as Flush, but returns ErrReadOnly instead of panicking if the
+// cache follows a leader.
+func (c *cache) TryFlush() error {
+	if err := c.writable(); err != nil {
+		return err
+	}
+	c.flush()
+	return nil
+}
+
+func (c *cache) flush() {
+	c.lockAll()
 	c.items.Clear()
+	c.stats.flushes.Add(1)
+	c.emit(mutation{op: opFlush})
+	c.unlockAll()
+}
+
+// Close Stops the cache's background goroutines (janitor and time cache
+// updater), writes the final snapshot if the cache was created with
+// WithPersistence and closes the append-only log, if one was opened. The
+// items stay accessible, but they are no longer expired after Close, since
+// the cache's clock stops too. It is safe to call Close more than once.
+func (c *cache) Close() (err error) {
+	c.closeOnce.Do(func() {
+		if c.snapshots != nil {
+			err = c.snapshots.close()
+		}
+		if c.stopped != nil {
+			close(c.stopped)
+		}
+		err = errors.Join(err, c.closeLog())
+	})
+	return
 }
 
 func stopBackground(c *Cache) {
-	c.stopped <- true
+	_ = c.Close()
 }
 
 func startBackground(c *cache, cleanInterval time.Duration, preciseTime bool) {
@@ -981,14 +1424,12 @@ func startBackground(c *cache, cleanInterval time.Duration, preciseTime bool) {
 		}()
 	}
 
+	c.clockTick = time.Second
+	if preciseTime {
+		c.clockTick = time.Millisecond
+	}
 	go func() {
-		var timeCacheInterval time.Duration
-		if preciseTime {
-			timeCacheInterval = time.Millisecond
-		} else {
-			timeCacheInterval = time.Second
-		}
-		timeTicker := time.NewTicker(timeCacheInterval)
+		timeTicker := time.NewTicker(c.clockTick)
 		for {
 			select {
 			case now := <-timeTicker.C:
@@ -1001,14 +1442,48 @@ func startBackground(c *cache, cleanInterval time.Duration, preciseTime bool) {
 	}()
 }
 
-func newCacheWithJanitor(de time.Duration, ci time.Duration, preciseTime bool) *Cache {
+// Option Configures optional features of a cache, see NewWithOptions.
+type Option func(*options)
+
+type options struct {
+	preciseTime bool
+	persistence *Persistence
+	codec       Codec
+	prefixIndex bool
+}
+
+// WithPreciseTime Rounds entry expiration to 1ms instead of 1s.
+func WithPreciseTime() Option {
+	return func(o *options) {
+		o.preciseTime = true
+	}
+}
+
+// WithPersistence Loads the cache from the snapshot at p.Path on creation
+// and keeps the snapshot up to date, see Persistence.
+func WithPersistence(p Persistence) Option {
+	return func(o *options) {
+		o.persistence = &p
+	}
+}
+
+// WithCodec Sets the default codec of the cache, used to persist values of
+// types without a codec registered with RegisterCodec. Gob by default.
+func WithCodec(codec Codec) Option {
+	return func(o *options) {
+		o.codec = codec
+	}
+}
+
+func newCacheWithJanitor(de time.Duration, ci time.Duration, opts options) *Cache {
 	if de == 0 {
 		de = -1
 	}
 	c := &cache{
 		defaultExpiration: de,
 		items:             sync.Map{},
-		stopped:           make(chan any, 2),
+		stopped:           make(chan any),
+		codec:             opts.codec,
 	}
 	c.timeCache.Store(time.Now().UnixNano())
 	// This trick ensures that the janitor goroutine (which--granted it
@@ -1020,7 +1495,14 @@ func newCacheWithJanitor(de time.Duration, ci time.Duration, preciseTime bool) *
 	if ci == 0 {
 		ci = math.MaxInt64
 	}
-	startBackground(c, ci, preciseTime)
+	startBackground(c, ci, opts.preciseTime)
+	if opts.prefixIndex {
+		c.index = &prefixIndex{}
+		c.addObserver(c.index.observe)
+	}
+	if opts.persistence != nil {
+		c.snapshots = startSnapshots(c, *opts.persistence)
+	}
 	runtime.SetFinalizer(C, stopBackground)
 	return C
 }
@@ -1034,7 +1516,20 @@ func newCacheWithJanitor(de time.Duration, ci time.Duration, preciseTime bool) *
 // By default entry expiration is rounded to 1s to decrease time.Now() calls,
 // if preciseTime set to true, expiration will be rounded to 1ms.
 func New(defaultExpiration, cleanupInterval time.Duration, preciseTime ...bool) *Cache {
-	return newCacheWithJanitor(defaultExpiration, cleanupInterval, len(preciseTime) > 0 && preciseTime[0])
+	return newCacheWithJanitor(defaultExpiration, cleanupInterval, options{
+		preciseTime: len(preciseTime) > 0 && preciseTime[0],
+	})
+}
+
+// NewWithOptions Same as New, but optional features of the cache, such as
+// automatic snapshots (WithPersistence) and precise expiration
+// (WithPreciseTime), are enabled with options.
+func NewWithOptions(defaultExpiration, cleanupInterval time.Duration, opts ...Option) *Cache {
+	var o options
+	for _, opt := range opts {
+		opt(&o)
+	}
+	return newCacheWithJanitor(defaultExpiration, cleanupInterval, o)
 }
 
 // NewFrom Returns a new cache with a given default expiration duration and cleanup
@@ -1062,7 +1557,9 @@ func New(defaultExpiration, cleanupInterval time.Duration, preciseTime ...bool)
 // map retrieved with c.Items(), and to register those same types before
 // decoding a blob containing an items map.
 func NewFrom(defaultExpiration, cleanupInterval time.Duration, items map[string]Item, preciseTime ...bool) *Cache {
-	c := newCacheWithJanitor(defaultExpiration, cleanupInterval, len(preciseTime) > 0 && preciseTime[0])
+	c := newCacheWithJanitor(defaultExpiration, cleanupInterval, options{
+		preciseTime: len(preciseTime) > 0 && preciseTime[0],
+	})
 	for k, v := range items {
 		c.items.Store(k, v)
 	}
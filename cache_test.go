@@ -4,6 +4,7 @@ import (
 	"bytes"
 	"os"
 	"runtime"
+	"slices"
 	"strconv"
 	"sync"
 	"testing"
@@ -1150,6 +1151,32 @@ func TestDelete(t *testing.T) {
 	}
 }
 
+func TestTryDelete(t *testing.T) {
+	tc := New(DefaultExpiration, 0)
+	var evicted []string
+	tc.OnEvicted(func(k string, _ any) {
+		evicted = append(evicted, k)
+	})
+	tc.Set("foo", "bar", DefaultExpiration)
+	tc.Set("expired", "bar", time.Millisecond)
+	tc.timeCache.Add(int64(time.Second))
+	if found, err := tc.TryDelete("foo"); !found || err != nil {
+		t.Error("unexpected TryDelete of foo:", found, err)
+	}
+	if found, _ := tc.TryDelete("foo"); found {
+		t.Error("deleted foo was found")
+	}
+	if found, _ := tc.TryDelete("expired"); found {
+		t.Error("expired item was found")
+	}
+	if tc.ItemCount() != 0 {
+		t.Error("expired item was not deleted")
+	}
+	if !slices.Equal(evicted, []string{"foo", "expired"}) {
+		t.Error("unexpected evicted keys:", evicted)
+	}
+}
+
 func TestItemCount(t *testing.T) {
 	tc := New(DefaultExpiration, 0)
 	tc.Set("foo", "1", DefaultExpiration)
@@ -1677,6 +1704,26 @@ func BenchmarkDeleteExpiredLoop(b *testing.B) {
 	}
 }
 
+func TestPeek(t *testing.T) {
+	tc := New(DefaultExpiration, 0)
+	defer tc.Close()
+	tc.Set("foo", "bar", NoExpiration)
+	tc.Set("expired", "bar", time.Millisecond)
+	tc.timeCache.Add(int64(time.Second))
+	if item, found := tc.Peek("foo"); !found || item.Object != "bar" || item.Expiration != 0 {
+		t.Error("unexpected item of foo:", item, found)
+	}
+	if _, found := tc.Peek("expired"); found {
+		t.Error("expired item was found")
+	}
+	if _, found := tc.Peek("missing"); found {
+		t.Error("missing key was found")
+	}
+	if st := tc.Stats(); st.Hits != 0 || st.Misses != 0 {
+		t.Error("Peek was counted:", st.Hits, st.Misses)
+	}
+}
+
 func TestGetWithExpiration(t *testing.T) {
 	tc := New(DefaultExpiration, 0)
 
@@ -1774,3 +1821,81 @@ func TestGetWithExpiration(t *testing.T) {
 		t.Error("expiration for e is in the past, diff: ", now.Sub(expiration))
 	}
 }
+
+func TestGetWithTTL(t *testing.T) {
+	tc := New(DefaultExpiration, 0)
+	defer tc.Close()
+	if _, _, found := tc.GetWithTTL("missing"); found {
+		t.Error("missing key was found")
+	}
+	tc.Set("forever", 1, NoExpiration)
+	if _, ttl, found := tc.GetWithTTL("forever"); !found || ttl != 0 {
+		t.Error("unexpected ttl of an item which never expires:", ttl, found)
+	}
+	tc.Set("expiring", 1, time.Minute)
+	if _, ttl, found := tc.GetWithTTL("expiring"); !found || ttl >= 0 || ttl < -time.Minute {
+		t.Error("unexpected ttl of an expiring item:", ttl, found)
+	}
+}
+
+func TestGetWithRemainingTTL(t *testing.T) {
+	tc := New(DefaultExpiration, 0)
+	defer tc.Close()
+	if _, _, found := tc.GetWithRemainingTTL("missing"); found {
+		t.Error("missing key was found")
+	}
+	tc.Set("forever", 1, NoExpiration)
+	if _, ttl, found := tc.GetWithRemainingTTL("forever"); !found || ttl != NoExpiration {
+		t.Error("unexpected ttl of an item which never expires:", ttl, found)
+	}
+	tc.Set("expiring", 1, time.Minute)
+	if _, ttl, found := tc.GetWithRemainingTTL("expiring"); !found || ttl <= 0 || ttl > time.Minute {
+		t.Error("unexpected ttl of an expiring item:", ttl, found)
+	}
+}
+
+func TestTouch(t *testing.T) {
+	tc := New(DefaultExpiration, 0)
+	if err := tc.Touch("foo", time.Minute); err != ErrNotExists {
+		t.Error("Touch of missing key didn't fail:", err)
+	}
+	tc.Set("foo", "bar", NoExpiration)
+	if err := tc.Touch("foo", time.Minute); err != nil {
+		t.Fatal(err)
+	}
+	x, ttl, found := tc.GetWithRemainingTTL("foo")
+	if !found || x.(string) != "bar" {
+		t.Error("foo was changed by Touch:", x)
+	}
+	if ttl <= 0 || ttl > time.Minute {
+		t.Error("Unexpected ttl after Touch:", ttl)
+	}
+}
+
+func TestModify(t *testing.T) {
+	tc := New(DefaultExpiration, 0)
+	appendBar := func(x any) (any, error) {
+		s, ok := x.(string)
+		if !ok {
+			return nil, ErrInvalidType
+		}
+		return s + "bar", nil
+	}
+	if err := tc.Modify("foo", appendBar); err != ErrNotExists {
+		t.Error("Modify of missing key didn't fail:", err)
+	}
+	tc.Set("foo", "foo", DefaultExpiration)
+	if err := tc.Modify("foo", appendBar); err != nil {
+		t.Fatal(err)
+	}
+	if x, _ := tc.Get("foo"); x.(string) != "foobar" {
+		t.Error("foo is not foobar:", x)
+	}
+	tc.Set("num", 1, DefaultExpiration)
+	if err := tc.Modify("num", appendBar); err != ErrInvalidType {
+		t.Error("Modify didn't return error of f:", err)
+	}
+	if x, _ := tc.Get("num"); x.(int) != 1 {
+		t.Error("num was changed by failed Modify:", x)
+	}
+}
@@ -0,0 +1,232 @@
+// Package cluster spreads the values of a cache.Cache over several processes,
+// in the manner of groupcache: every key is owned by one node of the cluster,
+// chosen by a consistent hash Ring, and only the owner loads the value of the
+// key from the source of truth. Other nodes fetch the value from the owner,
+// and may keep a hot copy for a while:
+//
+//	n := cluster.New("http://10.0.0.1:8080/", c, load)
+//	n.AddPeer("http://10.0.0.2:8080/", 1, &cluster.HTTPPeer{URL: "http://10.0.0.2:8080/"})
+//	http.Handle("/", n)
+//	v, err := n.Get(ctx, "key")
+//
+// Values are byte slices which must not be modified. A node whose cache
+// follows a leader (see cache.Cache.Follow) serves the values of the cache,
+// and loads the missing ones without keeping them. If the owner can't be
+// reached, the value is loaded locally, so the cluster keeps working while
+// nodes are down, at the cost of more loads.
+package cluster
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/sot-tech/go-cache"
+)
+
+// Loader Loads the value of the key from the source of truth. Returns
+// cache.ErrNotExists, possibly wrapped, if there is no such key, which is
+// reported as such to the nodes fetching the key.
+type Loader func(ctx context.Context, key string) ([]byte, error)
+
+// Peer Another node of the cluster.
+type Peer interface {
+	// Fetch Returns the value of the key held or loaded by the peer, and
+	// the time until it expires there, cache.NoExpiration if it doesn't.
+	// Returns cache.ErrNotExists if the key doesn't exist.
+	Fetch(ctx context.Context, key string) ([]byte, time.Duration, error)
+}
+
+// Node The local node of a cluster.
+type Node struct {
+	self  string
+	c     *cache.Cache
+	load  Loader
+	ring  *Ring
+	mu    sync.RWMutex
+	peers map[string]Peer
+	// gets and loads are separate so that a node serving a peer never
+	// waits for its own fetch from another peer.
+	gets, loads flights
+	mux         *http.ServeMux
+	// Expiration is the expiration of the values loaded by the node,
+	// cache.DefaultExpiration if zero.
+	Expiration time.Duration
+	// HotExpiration, if positive, makes the node keep the values it fetched
+	// from their owners, or loaded while their owners were unreachable, for
+	// at most this long.
+	HotExpiration time.Duration
+	// OnError, if set, is called with the errors of peers which Get
+	// recovered from by loading values locally.
+	OnError func(error)
+}
+
+// New Returns the node named self, with weight 1 on its ring, which keeps
+// values in c and loads them with load. The name of a node must be the same
+// on every node of the cluster, so their rings agree on the owners of keys.
+func New(self string, c *cache.Cache, load Loader) *Node {
+	n := &Node{
+		self:  self,
+		c:     c,
+		load:  load,
+		ring:  NewRing(DefaultReplicas),
+		peers: make(map[string]Peer),
+		mux:   http.NewServeMux(),
+	}
+	n.ring.Add(self, 1)
+	n.mux.HandleFunc("GET /{$}", n.serveKey)
+	return n
+}
+
+// AddPeer Adds the peer with the name and weight to the cluster, or replaces
+// it. If name is the name of the node itself, only its weight is changed and
+// p is ignored.
+func (n *Node) AddPeer(name string, weight int, p Peer) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	if name != n.self {
+		n.peers[name] = p
+	}
+	n.ring.Add(name, weight)
+}
+
+// RemovePeer Removes the peer from the cluster, its keys are taken over by
+// the remaining nodes. The node itself can't be removed.
+func (n *Node) RemovePeer(name string) {
+	if name == n.self {
+		return
+	}
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	delete(n.peers, name)
+	n.ring.Remove(name)
+}
+
+// Ring Returns the ring of the cluster. Nodes must be added and removed
+// with AddPeer and RemovePeer.
+func (n *Node) Ring() *Ring {
+	return n.ring
+}
+
+// Get Returns the value of the key. The value is taken from the cache of the
+// node if it is there, loaded if the node owns the key, and fetched from
+// the owner otherwise. If the owner fails, except by reporting that the key
+// doesn't exist, the value is loaded by the node. Concurrent calls for the
+// same key share a single fetch or load, made with the context of the first
+// call.
+func (n *Node) Get(ctx context.Context, key string) ([]byte, error) {
+	if v, found := n.cached(key); found {
+		return v, nil
+	}
+	return n.gets.do(ctx, key, func() ([]byte, error) {
+		n.mu.RLock()
+		owner := n.ring.Owner(key)
+		p := n.peers[owner]
+		n.mu.RUnlock()
+		if owner == n.self || p == nil {
+			return n.getLocally(ctx, key)
+		}
+		v, ttl, err := p.Fetch(ctx, key)
+		switch {
+		case err == nil:
+			n.storeHot(key, v, ttl)
+			return v, nil
+		case errors.Is(err, cache.ErrNotExists) || ctx.Err() != nil:
+			return nil, err
+		}
+		if n.OnError != nil {
+			n.OnError(fmt.Errorf("fetching %q from %s: %w", key, owner, err))
+		}
+		v, err = n.loads.do(ctx, key, func() ([]byte, error) {
+			return n.load(ctx, key)
+		})
+		if err == nil {
+			n.storeHot(key, v, cache.NoExpiration)
+		}
+		return v, err
+	})
+}
+
+// cached returns the value of the key in the cache of the node.
+func (n *Node) cached(key string) ([]byte, bool) {
+	x, found := n.c.Get(key)
+	v, ok := x.([]byte)
+	return v, found && ok
+}
+
+// getLocally returns the value of the key from the cache of the node, or
+// loads and stores it.
+func (n *Node) getLocally(ctx context.Context, key string) ([]byte, error) {
+	if v, found := n.cached(key); found {
+		return v, nil
+	}
+	return n.loads.do(ctx, key, func() ([]byte, error) {
+		if v, found := n.cached(key); found {
+			return v, nil
+		}
+		v, err := n.load(ctx, key)
+		if err == nil {
+			// The value isn't kept if the cache follows a leader.
+			_ = n.c.TrySet(key, v, n.Expiration)
+		}
+		return v, err
+	})
+}
+
+// storeHot keeps a hot copy of a value owned by another node, which expires
+// at the owner after ttl.
+func (n *Node) storeHot(key string, v []byte, ttl time.Duration) {
+	if n.HotExpiration <= 0 {
+		return
+	}
+	d := n.HotExpiration
+	if ttl > 0 {
+		d = min(d, ttl)
+	}
+	// The copy isn't kept if the cache follows a leader.
+	_ = n.c.TrySet(key, v, d)
+}
+
+// flights deduplicates concurrent calls for the same key.
+type flights struct {
+	mu sync.Mutex
+	m  map[string]*flight
+}
+
+type flight struct {
+	done chan struct{}
+	v    []byte
+	err  error
+}
+
+// do calls f, unless a call for the key is in progress, in which case its
+// result is awaited instead, or until ctx is done.
+func (fs *flights) do(ctx context.Context, key string, f func() ([]byte, error)) ([]byte, error) {
+	fs.mu.Lock()
+	if fl, found := fs.m[key]; found {
+		fs.mu.Unlock()
+		select {
+		case <-fl.done:
+			return fl.v, fl.err
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+	if fs.m == nil {
+		fs.m = make(map[string]*flight)
+	}
+	fl := &flight{done: make(chan struct{})}
+	fs.m[key] = fl
+	fs.mu.Unlock()
+	defer func() {
+		fs.mu.Lock()
+		delete(fs.m, key)
+		fs.mu.Unlock()
+		close(fl.done)
+	}()
+	fl.v, fl.err = f()
+	return fl.v, fl.err
+}
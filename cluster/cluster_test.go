@@ -0,0 +1,192 @@
+package cluster
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/sot-tech/go-cache"
+)
+
+// testCluster is a cluster of nodes served on loopback.
+type testCluster struct {
+	nodes   []*Node
+	servers []*httptest.Server
+	// requests counts the requests served by each node.
+	requests []atomic.Int64
+	mu       sync.Mutex
+	// loads maps keys to the names of the nodes which loaded them.
+	loads map[string][]string
+}
+
+func newTestCluster(t *testing.T, size int) *testCluster {
+	tc := &testCluster{requests: make([]atomic.Int64, size), loads: map[string][]string{}}
+	for i := range size {
+		name := "node" + strconv.Itoa(i)
+		c := cache.New(cache.DefaultExpiration, 0)
+		t.Cleanup(func() { c.Close() })
+		n := New(name, c, func(ctx context.Context, key string) ([]byte, error) {
+			if key == "missing" {
+				return nil, cache.ErrNotExists
+			}
+			tc.mu.Lock()
+			tc.loads[key] = append(tc.loads[key], name)
+			tc.mu.Unlock()
+			return []byte("value of " + key), nil
+		})
+		s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			tc.requests[i].Add(1)
+			n.ServeHTTP(w, r)
+		}))
+		t.Cleanup(s.Close)
+		tc.nodes = append(tc.nodes, n)
+		tc.servers = append(tc.servers, s)
+	}
+	for _, n := range tc.nodes {
+		for i, s := range tc.servers {
+			n.AddPeer("node"+strconv.Itoa(i), 1, &HTTPPeer{URL: s.URL})
+		}
+	}
+	return tc
+}
+
+func TestGet(t *testing.T) {
+	tc := newTestCluster(t, 3)
+	ctx := context.Background()
+	for i := range 100 {
+		k := "k" + strconv.Itoa(i)
+		for _, n := range tc.nodes {
+			v, err := n.Get(ctx, k)
+			if err != nil || string(v) != "value of "+k {
+				t.Fatalf("unexpected value of %s: %q, %v", k, v, err)
+			}
+		}
+		owner := tc.nodes[0].Ring().Owner(k)
+		if loads := tc.loads[k]; len(loads) != 1 || loads[0] != owner {
+			t.Errorf("%s owned by %s was loaded by %v", k, owner, loads)
+		}
+	}
+	for i := range tc.nodes {
+		if n := tc.requests[i].Load(); n == 0 {
+			t.Errorf("node%d served no request", i)
+		}
+	}
+	for _, n := range tc.nodes {
+		if _, err := n.Get(ctx, "missing"); err != cache.ErrNotExists {
+			t.Error("unexpected error for a missing key:", err)
+		}
+	}
+}
+
+func TestGetHotCopies(t *testing.T) {
+	tc := newTestCluster(t, 2)
+	owner, other := tc.nodes[0], tc.nodes[1]
+	owner.Expiration = time.Minute
+	other.HotExpiration = time.Hour
+	k := "k"
+	for i := 0; owner.Ring().Owner(k) != owner.self; i++ {
+		k = "k" + strconv.Itoa(i)
+	}
+	for range 3 {
+		if _, err := other.Get(context.Background(), k); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if n := tc.requests[0].Load(); n != 1 {
+		t.Error("unexpected number of fetches from the owner:", n)
+	}
+	// The hot copy doesn't outlive the value of the owner.
+	if _, ttl, found := other.c.GetWithRemainingTTL(k); !found || ttl > time.Minute {
+		t.Error("unexpected hot copy:", found, ttl)
+	}
+
+	other.HotExpiration = 0
+	other.c.Flush()
+	other.Get(context.Background(), k)
+	other.Get(context.Background(), k)
+	if n := tc.requests[0].Load(); n != 3 {
+		t.Error("values were kept without HotExpiration:", n)
+	}
+}
+
+func TestGetOwnerDown(t *testing.T) {
+	tc := newTestCluster(t, 2)
+	var errs []error
+	tc.nodes[1].OnError = func(err error) {
+		errs = append(errs, err)
+	}
+	k := "k"
+	for i := 0; tc.nodes[0].Ring().Owner(k) != "node0"; i++ {
+		k = "k" + strconv.Itoa(i)
+	}
+	tc.servers[0].Close()
+	v, err := tc.nodes[1].Get(context.Background(), k)
+	if err != nil || string(v) != "value of "+k {
+		t.Fatalf("unexpected value: %q, %v", v, err)
+	}
+	if loads := tc.loads[k]; len(loads) != 1 || loads[0] != "node1" {
+		t.Error("value was not loaded locally:", loads)
+	}
+	if len(errs) != 1 {
+		t.Error("unexpected errors:", errs)
+	}
+
+	// Once the owner is removed, the key is owned by the remaining node.
+	tc.nodes[1].RemovePeer("node0")
+	if o := tc.nodes[1].Ring().Owner(k); o != "node1" {
+		t.Error("unexpected owner:", o)
+	}
+	tc.nodes[1].Get(context.Background(), k)
+	if loads := tc.loads[k]; len(loads) != 2 {
+		t.Error("value was not loaded by the new owner:", loads)
+	}
+	if _, found := tc.nodes[1].c.Get(k); !found {
+		t.Error("value of an owned key was not kept")
+	}
+}
+
+func TestGetDeduplicates(t *testing.T) {
+	c := cache.New(cache.DefaultExpiration, 0)
+	defer c.Close()
+	var loads atomic.Int64
+	release := make(chan struct{})
+	n := New("self", c, func(ctx context.Context, key string) ([]byte, error) {
+		loads.Add(1)
+		<-release
+		return []byte("v"), nil
+	})
+	var wg sync.WaitGroup
+	for range 10 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if v, err := n.Get(context.Background(), "k"); string(v) != "v" || err != nil {
+				t.Error("unexpected value:", v, err)
+			}
+		}()
+	}
+	time.Sleep(10 * time.Millisecond)
+	close(release)
+	wg.Wait()
+	if l := loads.Load(); l != 1 {
+		t.Error("unexpected number of loads:", l)
+	}
+
+	// A waiting call returns when its context is done.
+	release = make(chan struct{})
+	defer close(release)
+	c.Flush()
+	go n.Get(context.Background(), "k")
+	time.Sleep(10 * time.Millisecond)
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if _, err := n.Get(ctx, "k"); !errors.Is(err, context.DeadlineExceeded) {
+		t.Error("unexpected error:", err)
+	}
+}
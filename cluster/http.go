@@ -0,0 +1,111 @@
+package cluster
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/sot-tech/go-cache"
+)
+
+// TTLHeader is the name of the header with the time until a fetched value
+// expires at its owner, as a Go duration, absent if it doesn't expire.
+const TTLHeader = "TTL"
+
+// NotExistsHeader is the name of the header set, with the value "true", on
+// the 404 responses for keys which don't exist. A 404 response without it,
+// e.g. for a wrong URL, is an error of the peer.
+const NotExistsHeader = "Not-Exists"
+
+// ServeHTTP Serves the values of the node to its peers, see HTTPPeer: the
+// key is the "key" query parameter of GET requests for the root of the
+// handler, use http.StripPrefix to mount it under another path. Values are
+// taken from the cache of the node, or loaded, without being fetched from
+// other nodes, so nodes whose rings disagree never forward requests to each
+// other.
+func (n *Node) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	n.mux.ServeHTTP(w, r)
+}
+
+func (n *Node) serveKey(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	if !q.Has("key") {
+		http.Error(w, "missing key parameter", http.StatusBadRequest)
+		return
+	}
+	key := q.Get("key")
+	v, err := n.getLocally(r.Context(), key)
+	if err != nil {
+		code := http.StatusInternalServerError
+		if errors.Is(err, cache.ErrNotExists) {
+			w.Header().Set(NotExistsHeader, "true")
+			code = http.StatusNotFound
+		}
+		http.Error(w, err.Error(), code)
+		return
+	}
+	if _, ttl, found := n.c.GetWithRemainingTTL(key); found && ttl != cache.NoExpiration {
+		w.Header().Set(TTLHeader, ttl.String())
+	}
+	w.Header().Set("Content-Type", "application/octet-stream")
+	_, _ = w.Write(v)
+}
+
+// HTTPPeer Peer reached over HTTP, served by Node.ServeHTTP.
+type HTTPPeer struct {
+	// URL is the base URL of the handler of the peer.
+	URL string
+	// Client is used for requests, http.DefaultClient if nil.
+	Client *http.Client
+}
+
+// Fetch Implements Peer.
+func (p *HTTPPeer) Fetch(ctx context.Context, key string) ([]byte, time.Duration, error) {
+	u, err := url.Parse(p.URL)
+	if err != nil {
+		return nil, 0, err
+	}
+	if !strings.HasSuffix(u.Path, "/") {
+		u.Path += "/"
+	}
+	u.RawQuery = url.Values{"key": {key}}.Encode()
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u.String(), nil)
+	if err != nil {
+		return nil, 0, err
+	}
+	client := p.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, 0, err
+	}
+	switch resp.StatusCode {
+	case http.StatusOK:
+	case http.StatusNotFound:
+		if resp.Header.Get(NotExistsHeader) == "true" {
+			return nil, 0, cache.ErrNotExists
+		}
+		fallthrough
+	default:
+		return nil, 0, fmt.Errorf("%s: %s", resp.Status, strings.TrimSpace(string(body)))
+	}
+	ttl := cache.NoExpiration
+	if s := resp.Header.Get(TTLHeader); s != "" {
+		if ttl, err = time.ParseDuration(s); err != nil {
+			return nil, 0, fmt.Errorf("invalid %s header: %w", TTLHeader, err)
+		}
+	}
+	return body, ttl, nil
+}
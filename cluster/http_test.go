@@ -0,0 +1,79 @@
+package cluster
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/sot-tech/go-cache"
+)
+
+func TestHTTPPeer(t *testing.T) {
+	c := cache.New(cache.DefaultExpiration, 0)
+	defer c.Close()
+	n := New("self", c, func(ctx context.Context, key string) ([]byte, error) {
+		switch key {
+		case "missing":
+			return nil, cache.ErrNotExists
+		case "failing":
+			return nil, errors.New("load failed")
+		}
+		return []byte(key), nil
+	})
+	n.Expiration = time.Minute
+	s := httptest.NewServer(n)
+	defer s.Close()
+	p := &HTTPPeer{URL: s.URL + "/"}
+	ctx := context.Background()
+
+	k := "a/b c?d%"
+	v, ttl, err := p.Fetch(ctx, k)
+	if err != nil || string(v) != k {
+		t.Fatalf("unexpected value: %q, %v", v, err)
+	}
+	if ttl <= 0 || ttl > time.Minute {
+		t.Error("unexpected TTL:", ttl)
+	}
+	c.Set("forever", []byte("v"), cache.NoExpiration)
+	if _, ttl, _ := p.Fetch(ctx, "forever"); ttl != cache.NoExpiration {
+		t.Error("unexpected TTL of a value without expiration:", ttl)
+	}
+	if _, _, err := p.Fetch(ctx, "missing"); err != cache.ErrNotExists {
+		t.Error("unexpected error for a missing key:", err)
+	}
+	if _, _, err := p.Fetch(ctx, "failing"); err == nil || err == cache.ErrNotExists {
+		t.Error("unexpected error for a failing load:", err)
+	}
+	for _, k := range []string{"", ".", ".."} {
+		if v, _, err := p.Fetch(ctx, k); err != nil || string(v) != k {
+			t.Errorf("unexpected value of %q: %q, %v", k, v, err)
+		}
+	}
+
+	// A wrong URL is an error, not a missing key.
+	p.URL = s.URL + "/wrong/"
+	if _, _, err := p.Fetch(ctx, "a"); err == nil || err == cache.ErrNotExists {
+		t.Error("unexpected error for a wrong URL:", err)
+	}
+}
+
+func TestHTTPPeerPrefix(t *testing.T) {
+	c := cache.New(cache.DefaultExpiration, 0)
+	defer c.Close()
+	n := New("self", c, func(ctx context.Context, key string) ([]byte, error) {
+		return []byte(key), nil
+	})
+	mux := http.NewServeMux()
+	mux.Handle("/cache/", http.StripPrefix("/cache", n))
+	s := httptest.NewServer(mux)
+	defer s.Close()
+	for _, u := range []string{s.URL + "/cache", s.URL + "/cache/"} {
+		p := &HTTPPeer{URL: u}
+		if v, _, err := p.Fetch(context.Background(), "k"); err != nil || string(v) != "k" {
+			t.Errorf("unexpected value from %s: %q, %v", u, v, err)
+		}
+	}
+}
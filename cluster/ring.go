@@ -0,0 +1,127 @@
+package cluster
+
+import (
+	"cmp"
+	"hash/fnv"
+	"maps"
+	"slices"
+	"strconv"
+	"sync"
+)
+
+// DefaultReplicas is the default number of virtual nodes of a node of weight
+// 1 on a Ring.
+const DefaultReplicas = 100
+
+// Ring Consistent hash ring mapping keys to nodes. Every node is placed on
+// the ring at replicas × weight points, its virtual nodes, and a key belongs
+// to the node of the first point following the hash of the key. Adding or
+// removing a node only moves the keys between the node and its neighbours,
+// and nodes own a share of the keys proportional to their weight. Ring is
+// safe for concurrent use.
+type Ring struct {
+	replicas int
+	mu       sync.RWMutex
+	weights  map[string]int
+	points   []point // sorted by hash, then by node
+}
+
+type point struct {
+	hash uint64
+	node string
+}
+
+// NewRing Returns an empty ring with the given number of virtual nodes per
+// unit of weight, DefaultReplicas if replicas isn't positive.
+func NewRing(replicas int) *Ring {
+	if replicas <= 0 {
+		replicas = DefaultReplicas
+	}
+	return &Ring{replicas: replicas, weights: make(map[string]int)}
+}
+
+// hash returns the FNV-1a hash of s, finalized as in SplitMix64 so that
+// similar strings, like the names of virtual nodes, are spread over the ring.
+func hash(s string) uint64 {
+	h := fnv.New64a()
+	_, _ = h.Write([]byte(s))
+	x := h.Sum64()
+	x = (x ^ x>>30) * 0xbf58476d1ce4e5b9
+	x = (x ^ x>>27) * 0x94d049bb133111eb
+	return x ^ x>>31
+}
+
+// Add Adds the node with the weight, or changes the weight of the node if it
+// is already on the ring. Weights below 1 are treated as 1.
+func (r *Ring) Add(node string, weight int) {
+	weight = max(weight, 1)
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.weights[node] == weight {
+		return
+	}
+	r.weights[node] = weight
+	r.rebuild()
+}
+
+// Remove Removes the node from the ring.
+func (r *Ring) Remove(node string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if _, found := r.weights[node]; !found {
+		return
+	}
+	delete(r.weights, node)
+	r.rebuild()
+}
+
+// rebuild places the virtual nodes of every node on the ring. The point of
+// the i-th virtual node of a node doesn't depend on the weight of the node,
+// so changing the weight only adds or removes points.
+func (r *Ring) rebuild() {
+	n := 0
+	for _, w := range r.weights {
+		n += w * r.replicas
+	}
+	points := make([]point, 0, n)
+	for node, w := range r.weights {
+		for i := range w * r.replicas {
+			points = append(points, point{hash(strconv.Itoa(i) + "#" + node), node})
+		}
+	}
+	slices.SortFunc(points, func(a, b point) int {
+		return cmp.Or(cmp.Compare(a.hash, b.hash), cmp.Compare(a.node, b.node))
+	})
+	r.points = points
+}
+
+// Owner Returns the node owning the key, or "" if the ring is empty.
+func (r *Ring) Owner(key string) string {
+	h := hash(key)
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	if len(r.points) == 0 {
+		return ""
+	}
+	i, _ := slices.BinarySearchFunc(r.points, h, func(p point, h uint64) int {
+		return cmp.Compare(p.hash, h)
+	})
+	if i == len(r.points) {
+		i = 0
+	}
+	return r.points[i].node
+}
+
+// Nodes Returns the nodes on the ring, sorted.
+func (r *Ring) Nodes() []string {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return slices.Sorted(maps.Keys(r.weights))
+}
+
+// Weight Returns the weight of the node, 0 if it isn't on the ring.
+func (r *Ring) Weight(node string) int {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.weights[node]
+}
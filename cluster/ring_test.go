@@ -0,0 +1,98 @@
+package cluster
+
+import (
+	"strconv"
+	"testing"
+)
+
+func owners(r *Ring, n int) map[string]string {
+	m := make(map[string]string, n)
+	for i := range n {
+		k := "key" + strconv.Itoa(i)
+		m[k] = r.Owner(k)
+	}
+	return m
+}
+
+func TestRingOwner(t *testing.T) {
+	r := NewRing(0)
+	if o := r.Owner("k"); o != "" {
+		t.Error("unexpected owner on an empty ring:", o)
+	}
+	r.Add("a", 1)
+	r.Add("b", 1)
+	r.Add("c", 1)
+	// The order of addition doesn't matter.
+	r2 := NewRing(DefaultReplicas)
+	r2.Add("c", 1)
+	r2.Add("a", 1)
+	r2.Add("b", 1)
+	for k, o := range owners(r, 1000) {
+		if o2 := r2.Owner(k); o2 != o {
+			t.Fatalf("rings disagree on the owner of %s: %s, %s", k, o, o2)
+		}
+	}
+	if nodes := r.Nodes(); len(nodes) != 3 || nodes[0] != "a" || nodes[2] != "c" {
+		t.Error("unexpected nodes:", nodes)
+	}
+}
+
+func TestRingBalance(t *testing.T) {
+	r := NewRing(DefaultReplicas)
+	weights := map[string]int{"a": 1, "b": 1, "c": 1, "d": 2}
+	for node, w := range weights {
+		r.Add(node, w)
+	}
+	const n = 50000
+	counts := map[string]int{}
+	for _, o := range owners(r, n) {
+		counts[o]++
+	}
+	for node, w := range weights {
+		want := float64(n*w) / 5
+		if got := float64(counts[node]); got < want*0.75 || got > want*1.25 {
+			t.Errorf("node %s of weight %d owns %v keys, want about %v", node, w, got, want)
+		}
+	}
+}
+
+func TestRingMovement(t *testing.T) {
+	r := NewRing(DefaultReplicas)
+	for _, node := range []string{"a", "b", "c", "d"} {
+		r.Add(node, 1)
+	}
+	const n = 10000
+	before := owners(r, n)
+
+	r.Add("e", 1)
+	moved := 0
+	for k, o := range owners(r, n) {
+		if o != before[k] {
+			moved++
+			if o != "e" {
+				t.Fatalf("%s moved from %s to %s", k, before[k], o)
+			}
+		}
+	}
+	if moved < n/10 || moved > n*3/10 {
+		t.Error("unexpected number of keys moved to a new node:", moved)
+	}
+
+	r.Remove("e")
+	for k, o := range owners(r, n) {
+		if o != before[k] {
+			t.Fatalf("%s is owned by %s instead of %s after removal", k, o, before[k])
+		}
+	}
+
+	// A heavier node only takes keys from the others.
+	r.Add("a", 3)
+	if w := r.Weight("a"); w != 3 {
+		t.Error("unexpected weight:", w)
+	}
+	for k, o := range owners(r, n) {
+		if o != before[k] && o != "a" {
+			t.Fatalf("%s moved from %s to %s", k, before[k], o)
+		}
+	}
+}
@@ -0,0 +1,311 @@
+package cache
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/gob"
+	"encoding/json"
+	"errors"
+	"math"
+	"reflect"
+	"sync"
+)
+
+// Codec Encodes and decodes values of cache items for snapshots (Save, Load
+// and the files derived from them) and for the append-only log.
+//
+// A cache uses its default codec (see WithCodec, Gob by default) for values of
+// all types, except types that have their own codec registered with
+// RegisterCodec.
+type Codec interface {
+	// Name identifies the codec in stored data. It must be unique and must
+	// not change, otherwise data written with the codec can't be decoded.
+	Name() string
+	// Marshal returns the encoding of v.
+	Marshal(v any) ([]byte, error)
+	// Unmarshal decodes a value previously encoded with Marshal.
+	Unmarshal(data []byte) (any, error)
+}
+
+var ErrUnsupportedType = errors.New("unsupported value type")
+
+func init() {
+	// Types of the values stored by the cache itself are registered, so
+	// that they can be decoded before any of them is encoded.
+	gob.Register(&Lease{})
+	gob.Register(List{})
+	gob.Register(&StringSet{})
+	gob.Register(&Hash{})
+	gob.Register(&SortedSet{})
+	gob.Register(&ExpiringSet{})
+}
+
+var codecs = struct {
+	sync.RWMutex
+	byType map[reflect.Type]Codec
+	byName map[string]Codec
+}{
+	byType: map[reflect.Type]Codec{},
+	byName: map[string]Codec{
+		GobCodec{}.Name():    GobCodec{},
+		JSONCodec{}.Name():   JSONCodec{},
+		BinaryCodec{}.Name(): BinaryCodec{},
+	},
+}
+
+// RegisterCodec Makes all caches encode values of the same type as v with c,
+// instead of the caches' default codec. A codec must be registered before
+// data it wrote is loaded, the same as for gob.Register.
+func RegisterCodec(v any, c Codec) {
+	codecs.Lock()
+	defer codecs.Unlock()
+	codecs.byType[reflect.TypeOf(v)] = c
+	codecs.byName[c.Name()] = c
+}
+
+// codecFor returns the codec to encode v with.
+func (c *cache) codecFor(v any) Codec {
+	codecs.RLock()
+	tc, found := codecs.byType[reflect.TypeOf(v)]
+	codecs.RUnlock()
+	if found {
+		return tc
+	}
+	return c.defaultCodec()
+}
+
+func (c *cache) defaultCodec() Codec {
+	if c.codec != nil {
+		return c.codec
+	}
+	return GobCodec{}
+}
+
+// codecByName returns the codec to decode data written by the codec
+// with name.
+func (c *cache) codecByName(name string) (Codec, error) {
+	if dc := c.defaultCodec(); dc.Name() == name {
+		return dc, nil
+	}
+	codecs.RLock()
+	nc, found := codecs.byName[name]
+	codecs.RUnlock()
+	if !found {
+		return nil, errors.New("unknown codec: " + name)
+	}
+	return nc, nil
+}
+
+// GobCodec Encodes values with encoding/gob. Types of values are registered
+// with gob.Register automatically the first time they are encoded, but they
+// must also be registered before decoding. Every value is encoded on its own,
+// with its type, so that it can be decoded on its own, which makes Save
+// slower than the Gob-encoded items map of previous versions.
+type GobCodec struct{}
+
+func (GobCodec) Name() string {
+	return "gob"
+}
+
+func (GobCodec) Marshal(v any) ([]byte, error) {
+	if err := gobRegister(v); err != nil {
+		return nil, err
+	}
+	var buf bytes.Buffer
+	if err := gob.NewEncoder(&buf).Encode(&v); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func (GobCodec) Unmarshal(data []byte) (v any, err error) {
+	err = gob.NewDecoder(bytes.NewReader(data)).Decode(&v)
+	return
+}
+
+// JSONCodec Encodes values with encoding/json. Decoded values are of the
+// types json.Unmarshal produces for an interface value, i.e. numbers become
+// float64, objects become map[string]any, etc. Use JSONCodecOf to preserve a
+// particular type.
+type JSONCodec struct{}
+
+func (JSONCodec) Name() string {
+	return "json"
+}
+
+func (JSONCodec) Marshal(v any) ([]byte, error) {
+	return json.Marshal(v)
+}
+
+func (JSONCodec) Unmarshal(data []byte) (v any, err error) {
+	err = json.Unmarshal(data, &v)
+	return
+}
+
+type typedJSONCodec[T any] struct {
+	name string
+}
+
+// JSONCodecOf Returns a codec which encodes values of type T with
+// encoding/json, and decodes them back into T. Intended to be registered with
+// RegisterCodec for T.
+func JSONCodecOf[T any]() Codec {
+	return typedJSONCodec[T]{name: "json:" + reflect.TypeFor[T]().String()}
+}
+
+func (c typedJSONCodec[T]) Name() string {
+	return c.name
+}
+
+func (typedJSONCodec[T]) Marshal(v any) ([]byte, error) {
+	return json.Marshal(v)
+}
+
+func (typedJSONCodec[T]) Unmarshal(data []byte) (any, error) {
+	var v T
+	err := json.Unmarshal(data, &v)
+	return v, err
+}
+
+// BinaryCodec Compact encoding of nil, []byte, string, bool, and integer and
+// floating point values: one byte of type tag followed by the value. Integers
+// are encoded as varints. Other types are not supported, Marshal returns
+// ErrUnsupportedType for them.
+type BinaryCodec struct{}
+
+const (
+	binNil byte = iota
+	binBytes
+	binString
+	binBool
+	binInt
+	binInt8
+	binInt16
+	binInt32
+	binInt64
+	binUint
+	binUint8
+	binUint16
+	binUint32
+	binUint64
+	binUintptr
+	binFloat32
+	binFloat64
+)
+
+func (BinaryCodec) Name() string {
+	return "binary"
+}
+
+func (BinaryCodec) Marshal(v any) ([]byte, error) {
+	var b []byte
+	switch x := v.(type) {
+	case nil:
+		b = []byte{binNil}
+	case []byte:
+		b = append([]byte{binBytes}, x...)
+	case string:
+		b = append([]byte{binString}, x...)
+	case bool:
+		b = []byte{binBool, 0}
+		if x {
+			b[1] = 1
+		}
+	case int:
+		b = binary.AppendVarint([]byte{binInt}, int64(x))
+	case int8:
+		b = binary.AppendVarint([]byte{binInt8}, int64(x))
+	case int16:
+		b = binary.AppendVarint([]byte{binInt16}, int64(x))
+	case int32:
+		b = binary.AppendVarint([]byte{binInt32}, int64(x))
+	case int64:
+		b = binary.AppendVarint([]byte{binInt64}, x)
+	case uint:
+		b = binary.AppendUvarint([]byte{binUint}, uint64(x))
+	case uint8:
+		b = binary.AppendUvarint([]byte{binUint8}, uint64(x))
+	case uint16:
+		b = binary.AppendUvarint([]byte{binUint16}, uint64(x))
+	case uint32:
+		b = binary.AppendUvarint([]byte{binUint32}, uint64(x))
+	case uint64:
+		b = binary.AppendUvarint([]byte{binUint64}, x)
+	case uintptr:
+		b = binary.AppendUvarint([]byte{binUintptr}, uint64(x))
+	case float32:
+		b = binary.LittleEndian.AppendUint32([]byte{binFloat32}, math.Float32bits(x))
+	case float64:
+		b = binary.LittleEndian.AppendUint64([]byte{binFloat64}, math.Float64bits(x))
+	default:
+		return nil, ErrUnsupportedType
+	}
+	return b, nil
+}
+
+var errInvalidBinary = errors.New("invalid binary codec data")
+
+func (BinaryCodec) Unmarshal(data []byte) (any, error) {
+	if len(data) == 0 {
+		return nil, errInvalidBinary
+	}
+	tag, data := data[0], data[1:]
+	switch tag {
+	case binNil:
+		return nil, nil
+	case binBytes:
+		return bytes.Clone(data), nil
+	case binString:
+		return string(data), nil
+	case binBool:
+		if len(data) != 1 {
+			return nil, errInvalidBinary
+		}
+		return data[0] != 0, nil
+	case binInt, binInt8, binInt16, binInt32, binInt64:
+		n, l := binary.Varint(data)
+		if l <= 0 || l != len(data) {
+			return nil, errInvalidBinary
+		}
+		switch tag {
+		case binInt:
+			return int(n), nil
+		case binInt8:
+			return int8(n), nil
+		case binInt16:
+			return int16(n), nil
+		case binInt32:
+			return int32(n), nil
+		}
+		return n, nil
+	case binUint, binUint8, binUint16, binUint32, binUint64, binUintptr:
+		n, l := binary.Uvarint(data)
+		if l <= 0 || l != len(data) {
+			return nil, errInvalidBinary
+		}
+		switch tag {
+		case binUint:
+			return uint(n), nil
+		case binUint8:
+			return uint8(n), nil
+		case binUint16:
+			return uint16(n), nil
+		case binUint32:
+			return uint32(n), nil
+		case binUintptr:
+			return uintptr(n), nil
+		}
+		return n, nil
+	case binFloat32:
+		if len(data) != 4 {
+			return nil, errInvalidBinary
+		}
+		return math.Float32frombits(binary.LittleEndian.Uint32(data)), nil
+	case binFloat64:
+		if len(data) != 8 {
+			return nil, errInvalidBinary
+		}
+		return math.Float64frombits(binary.LittleEndian.Uint64(data)), nil
+	}
+	return nil, errInvalidBinary
+}
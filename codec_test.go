@@ -0,0 +1,186 @@
+package cache
+
+import (
+	"bytes"
+	"encoding/gob"
+	"errors"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"reflect"
+	"strconv"
+	"testing"
+)
+
+func TestBinaryCodec(t *testing.T) {
+	values := []any{
+		nil, []byte("bytes"), "string", true, false,
+		-1, int8(-8), int16(-16), int32(-32), int64(-64),
+		uint(1), uint8(8), uint16(16), uint32(32), uint64(64), uintptr(7),
+		float32(3.5), 2.25,
+	}
+	var bc BinaryCodec
+	for _, v := range values {
+		b, err := bc.Marshal(v)
+		if err != nil {
+			t.Fatalf("Couldn't marshal %T: %v", v, err)
+		}
+		x, err := bc.Unmarshal(b)
+		if err != nil {
+			t.Fatalf("Couldn't unmarshal %T: %v", v, err)
+		}
+		if bv, ok := v.([]byte); ok {
+			if !bytes.Equal(bv, x.([]byte)) {
+				t.Errorf("%v is not %v", x, v)
+			}
+		} else if x != v {
+			t.Errorf("%v (%T) is not %v (%T)", x, x, v, v)
+		}
+	}
+	if _, err := bc.Marshal(struct{}{}); !errors.Is(err, ErrUnsupportedType) {
+		t.Error("struct was marshaled by binary codec:", err)
+	}
+}
+
+type jsonCodecStruct struct {
+	Name  string
+	Count int
+}
+
+func TestRegisteredCodec(t *testing.T) {
+	RegisterCodec(jsonCodecStruct{}, JSONCodecOf[jsonCodecStruct]())
+	tc := NewWithOptions(DefaultExpiration, 0, WithCodec(BinaryCodec{}))
+	tc.Set("s", jsonCodecStruct{Name: "a", Count: 2}, DefaultExpiration)
+	tc.Set("n", int16(42), DefaultExpiration)
+	tc.Set("b", []byte("bytes"), DefaultExpiration)
+
+	buf := &bytes.Buffer{}
+	if err := tc.Save(buf); err != nil {
+		t.Fatal("Couldn't save cache:", err)
+	}
+	oc := NewWithOptions(DefaultExpiration, 0, WithCodec(BinaryCodec{}))
+	if err := oc.Load(buf); err != nil {
+		t.Fatal("Couldn't load cache:", err)
+	}
+	if s, _ := oc.Get("s"); s != (jsonCodecStruct{Name: "a", Count: 2}) {
+		t.Error("s is not decoded with registered codec:", s)
+	}
+	if n, _ := oc.Get("n"); n != int16(42) {
+		t.Error("n is not int16(42):", n)
+	}
+	if b, _ := oc.Get("b"); !bytes.Equal(b.([]byte), []byte("bytes")) {
+		t.Error("b is not bytes:", b)
+	}
+
+	tc.Set("x", struct{ A int }{1}, DefaultExpiration)
+	if err := tc.Save(&bytes.Buffer{}); !errors.Is(err, ErrUnsupportedType) {
+		t.Error("unsupported type was saved with binary codec:", err)
+	}
+}
+
+func TestLoadLegacyGob(t *testing.T) {
+	buf := &bytes.Buffer{}
+	err := gob.NewEncoder(buf).Encode(map[string]Item{
+		"a": {Object: "a"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	tc := New(DefaultExpiration, 0)
+	if err = tc.Load(buf); err != nil {
+		t.Fatal("Couldn't load legacy data:", err)
+	}
+	if a, _ := tc.Get("a"); a != "a" {
+		t.Error("a is not a:", a)
+	}
+}
+
+func newBenchmarkSaveCache() *Cache {
+	tc := New(DefaultExpiration, 0)
+	for i := range 1000 {
+		k := strconv.Itoa(i)
+		switch i % 3 {
+		case 0:
+			tc.Set(k, i, DefaultExpiration)
+		case 1:
+			tc.Set(k, "value "+k, DefaultExpiration)
+		default:
+			tc.Set(k, &TestStruct{Num: i}, DefaultExpiration)
+		}
+	}
+	return tc
+}
+
+func BenchmarkSave(b *testing.B) {
+	tc := newBenchmarkSaveCache()
+	defer tc.Close()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if err := tc.Save(io.Discard); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+// BenchmarkSaveGobMap measures the format of Save of previous versions, a
+// Gob-encoded items map, for comparison with BenchmarkSave.
+func BenchmarkSaveGobMap(b *testing.B) {
+	tc := newBenchmarkSaveCache()
+	defer tc.Close()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		m := tc.Items()
+		for _, v := range m {
+			gob.Register(v.Object)
+		}
+		if err := gob.NewEncoder(io.Discard).Encode(m); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+// storedValues returns values of the types stored by the cache itself, by
+// their keys.
+func storedValues() map[string]any {
+	return map[string]any{
+		"lease": &Lease{key: "lease"},
+		"list":  NewList(1, "a"),
+		"set":   NewStringSet("a"),
+		"hash":  NewHash(map[string]string{"a": "1"}),
+		"zset":  NewSortedSet(ScoredMember{"a", 1}),
+		"eset":  NewExpiringSet(),
+	}
+}
+
+// TestDecodeStoredTypes loads values of the types stored by the cache itself
+// in a new process, which never encoded them.
+func TestDecodeStoredTypes(t *testing.T) {
+	if fname := os.Getenv("CACHE_TEST_SNAPSHOT"); fname != "" {
+		tc := New(DefaultExpiration, 0)
+		defer tc.Close()
+		if err := tc.LoadFile(fname); err != nil {
+			t.Fatal("Couldn't load:", err)
+		}
+		for k, v := range storedValues() {
+			if x, _ := tc.Get(k); reflect.TypeOf(x) != reflect.TypeOf(v) {
+				t.Errorf("unexpected value of %s: %#v", k, x)
+			}
+		}
+		return
+	}
+	fname := filepath.Join(t.TempDir(), "cache.dat")
+	tc := New(DefaultExpiration, 0)
+	defer tc.Close()
+	for k, v := range storedValues() {
+		tc.Set(k, v, DefaultExpiration)
+	}
+	if err := tc.SaveFile(fname); err != nil {
+		t.Fatal(err)
+	}
+	cmd := exec.Command(os.Args[0], "-test.run=^TestDecodeStoredTypes$")
+	cmd.Env = append(os.Environ(), "CACHE_TEST_SNAPSHOT="+fname)
+	if out, err := cmd.CombinedOutput(); err != nil {
+		t.Fatalf("%v\n%s", err, out)
+	}
+}
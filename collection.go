@@ -0,0 +1,40 @@
+package cache
+
+// modifyValue replaces the value of k with the result of f under the lock of
+// k, keeping the item's expiration, or deletes the key if f returns nil. If
+// the key doesn't exist, ErrNotExists is returned, unless create isn't nil,
+// in which case f is called with the value returned by create, and the result
+// is stored with the default expiration. f must return ErrInvalidType for
+// values of other types, the item is not changed if f fails.
+func (c *cache) modifyValue(k string, create func() any, f func(x any) (any, error)) error {
+	mu, err := c.lockWritable(k)
+	if err != nil {
+		return err
+	}
+	defer mu.Unlock()
+	v, found := c.getItem(k)
+	if found && v.expired(c.timeCache.Load()) {
+		found = false
+	}
+	if !found {
+		if create == nil {
+			return ErrNotExists
+		}
+		v = c.newItem(create(), DefaultExpiration)
+	}
+	x, err := f(v.Object)
+	if err != nil {
+		return err
+	}
+	if x == nil {
+		if found {
+			c.items.Delete(k)
+			c.stats.deletes.Add(1)
+			c.emit(mutation{op: opDelete, key: k, item: v})
+		}
+		return nil
+	}
+	v.Object = x
+	c.store(opSet, k, v)
+	return nil
+}
@@ -0,0 +1,54 @@
+package cache
+
+// EventType Kind of a change of the cache, see OnEvent.
+type EventType uint8
+
+const (
+	// EventSet An item was stored by Set, SetDefault, Add or Replace.
+	EventSet = EventType(opSet)
+	// EventDelete An item was deleted by Delete.
+	EventDelete = EventType(opDelete)
+	// EventIncrement An item was changed by one of Increment* or Decrement*.
+	EventIncrement = EventType(opIncrement)
+	// EventExpire An expired item was deleted by the janitor or
+	// DeleteExpired.
+	EventExpire = EventType(opExpire)
+	// EventFlush All items were deleted by Flush.
+	EventFlush = EventType(opFlush)
+	// EventLoad An item was loaded by LoadWithOptions with Notify set, or
+	// by a follower from the snapshot of its leader, see Follow.
+	EventLoad = EventType(opLoad)
+)
+
+// Event A change of the cache. Object and Expiration are those of the new
+// item for EventSet, EventIncrement and EventLoad, and of the removed item for
+// EventDelete and EventExpire. EventFlush has neither key nor item.
+type Event struct {
+	Type       EventType
+	Key        string
+	Object     any
+	Expiration int64
+}
+
+// OnEvent Sets an (optional) function that is called for every change of the
+// cache. The function is called synchronously, while the changed key is
+// locked, so it must return quickly and must not modify the cache. Set to nil
+// to disable.
+func (c *cache) OnEvent(f func(Event)) {
+	if c.onEvent != nil {
+		c.removeObserver(c.onEvent)
+		c.onEvent = nil
+	}
+	if f != nil {
+		c.onEvent = c.addObserver(func(m mutation) {
+			if !m.silent {
+				f(Event{
+					Type:       EventType(m.op),
+					Key:        m.key,
+					Object:     m.item.Object,
+					Expiration: m.item.Expiration,
+				})
+			}
+		})
+	}
+}
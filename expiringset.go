@@ -0,0 +1,315 @@
+package cache
+
+import (
+	"bytes"
+	"encoding/gob"
+	"encoding/json"
+	"maps"
+	"slices"
+	"sync/atomic"
+	"time"
+)
+
+// ExpiringSet A set of strings stored by EAdd, each member expiring
+// independently. Expired members are ignored by reads and deleted by the
+// janitor, or by the next EAdd to the same key. An ExpiringSet stored in the
+// cache is never changed: expiring set operations and the janitor store a new
+// ExpiringSet, so an ExpiringSet returned by Get can be read while other
+// goroutines change the set. Its methods tell expired members with the clock
+// of the cache the set was stored in by an expiring set operation, the same
+// as the operations and the janitor, or with the current time otherwise.
+type ExpiringSet struct {
+	// clock is the clock of the cache of the set, nil if it has none.
+	clock *atomic.Int64
+	// m maps members to their expiration in Unix nanoseconds, or 0 if they
+	// don't expire.
+	m map[string]int64
+	// next is the earliest expiration of the members, or 0 if none expires.
+	next int64
+}
+
+// NewExpiringSet Returns an empty expiring set.
+func NewExpiringSet() *ExpiringSet {
+	return &ExpiringSet{m: make(map[string]int64)}
+}
+
+// clone returns a copy of the set.
+func (s *ExpiringSet) clone() *ExpiringSet {
+	m := maps.Clone(s.m)
+	if m == nil {
+		m = make(map[string]int64)
+	}
+	return &ExpiringSet{clock: s.clock, m: m, next: s.next}
+}
+
+func memberExpired(e, now int64) bool {
+	return e > 0 && now > e
+}
+
+// add sets the expiration of the member, and reports whether it wasn't in
+// the set or was expired.
+func (s *ExpiringSet) add(member string, e, now int64) bool {
+	if s.m == nil {
+		s.m = make(map[string]int64)
+	}
+	old, found := s.m[member]
+	s.m[member] = e
+	if e > 0 && (s.next == 0 || e < s.next) {
+		s.next = e
+	}
+	return !found || memberExpired(old, now)
+}
+
+// prune deletes the expired members and returns them.
+func (s *ExpiringSet) prune(now int64) []string {
+	if !memberExpired(s.next, now) {
+		return nil
+	}
+	var expired []string
+	s.next = 0
+	for m, e := range s.m {
+		if memberExpired(e, now) {
+			delete(s.m, m)
+			expired = append(expired, m)
+		} else if e > 0 && (s.next == 0 || e < s.next) {
+			s.next = e
+		}
+	}
+	return expired
+}
+
+// expires reports whether some member is expired at now.
+func (s *ExpiringSet) expires(now int64) bool {
+	return memberExpired(s.next, now)
+}
+
+func (s *ExpiringSet) contains(member string, now int64) bool {
+	e, found := s.m[member]
+	return found && !memberExpired(e, now)
+}
+
+func (s *ExpiringSet) members(now int64) []string {
+	members := make([]string, 0, len(s.m))
+	for m, e := range s.m {
+		if !memberExpired(e, now) {
+			members = append(members, m)
+		}
+	}
+	slices.Sort(members)
+	return members
+}
+
+// now returns the time of the clock of the set in Unix nanoseconds.
+func (s *ExpiringSet) now() int64 {
+	if s.clock != nil {
+		return s.clock.Load()
+	}
+	return time.Now().UnixNano()
+}
+
+// Len Returns the number of unexpired members of the set.
+func (s *ExpiringSet) Len() int {
+	return len(s.members(s.now()))
+}
+
+// Contains Reports whether m is an unexpired member of the set.
+func (s *ExpiringSet) Contains(m string) bool {
+	return s.contains(m, s.now())
+}
+
+// Members Returns the unexpired members of the set, sorted.
+func (s *ExpiringSet) Members() []string {
+	return s.members(s.now())
+}
+
+func (s *ExpiringSet) expirations() map[string]int64 {
+	return maps.Clone(s.m)
+}
+
+func (s *ExpiringSet) setExpirations(m map[string]int64) {
+	*s = ExpiringSet{m: make(map[string]int64, len(m))}
+	for member, e := range m {
+		s.add(member, e, 0)
+	}
+}
+
+// GobEncode Encodes the members of the set and their expirations with Gob.
+func (s *ExpiringSet) GobEncode() ([]byte, error) {
+	var buf bytes.Buffer
+	if err := gob.NewEncoder(&buf).Encode(s.expirations()); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// GobDecode Decodes the set encoded by GobEncode.
+func (s *ExpiringSet) GobDecode(data []byte) error {
+	var m map[string]int64
+	if err := gob.NewDecoder(bytes.NewReader(data)).Decode(&m); err != nil {
+		return err
+	}
+	s.setExpirations(m)
+	return nil
+}
+
+// MarshalJSON Encodes the set as a JSON object mapping the members to their
+// expiration in Unix nanoseconds, or 0 if they don't expire.
+func (s *ExpiringSet) MarshalJSON() ([]byte, error) {
+	return json.Marshal(s.expirations())
+}
+
+// UnmarshalJSON Decodes the set encoded by MarshalJSON.
+func (s *ExpiringSet) UnmarshalJSON(data []byte) error {
+	var m map[string]int64
+	if err := json.Unmarshal(data, &m); err != nil {
+		return err
+	}
+	s.setExpirations(m)
+	return nil
+}
+
+// OnMemberEvicted Sets an (optional) function that is called with the key and
+// the member when a member of an ExpiringSet expires and is deleted by the
+// janitor or by EAdd. It is not called when the whole item is deleted or
+// expires, see OnEvicted. Set to nil to disable.
+func (c *cache) OnMemberEvicted(f func(string, string)) {
+	c.onMemberEvicted = f
+}
+
+func (c *cache) membersEvicted(k string, members []string) {
+	if f := c.onMemberEvicted; f != nil {
+		for _, m := range members {
+			f(k, m)
+		}
+	}
+}
+
+// modifyExpiringSet calls f with a copy of the expiring set of k under the
+// lock of k, after deleting its expired members, creating it with the default
+// expiration if the key doesn't exist and create is true, see modifyValue,
+// and stores the copy. The key is deleted if the set is empty after f. The
+// members evicted from the set are passed to OnMemberEvicted once the lock is
+// released.
+func (c *cache) modifyExpiringSet(k string, create bool, f func(s *ExpiringSet, now int64)) error {
+	var newSet func() any
+	if create {
+		newSet = func() any {
+			return NewExpiringSet()
+		}
+	}
+	var expired []string
+	err := c.modifyValue(k, newSet, func(x any) (any, error) {
+		s, ok := x.(*ExpiringSet)
+		if !ok {
+			return nil, ErrInvalidType
+		}
+		s = s.clone()
+		s.clock = &c.timeCache
+		now := c.timeCache.Load()
+		expired = s.prune(now)
+		f(s, now)
+		if len(s.m) == 0 {
+			return nil, nil
+		}
+		return s, nil
+	})
+	c.membersEvicted(k, expired)
+	return err
+}
+
+// pruneExpiringSet stores a copy of the expiring set of k without its expired
+// members, deleting the key if no member is left. The key is left as it is if
+// it no longer holds an expiring set with expired members, e.g. because it
+// was replaced or pruned by EAdd since the janitor saw it, or if the cache is
+// read-only.
+func (c *cache) pruneExpiringSet(k string, now int64) {
+	mu := c.lockKey(k)
+	v, found := c.getItem(k)
+	s, ok := v.Object.(*ExpiringSet)
+	if !found || !ok || v.expired(now) || c.readOnly.Load() {
+		mu.Unlock()
+		return
+	}
+	s = s.clone()
+	expired := s.prune(now)
+	v.Object = s
+	switch {
+	case len(expired) == 0:
+		// Only the earliest expiration, which was of a member whose
+		// expiration was replaced since, is updated, so the change isn't
+		// emitted.
+		c.items.Store(k, v)
+	case len(s.m) == 0:
+		c.items.Delete(k)
+		c.stats.deletes.Add(1)
+		c.emit(mutation{op: opDelete, key: k, item: v})
+	default:
+		c.store(opSet, k, v)
+	}
+	mu.Unlock()
+	c.membersEvicted(k, expired)
+}
+
+// getExpiringSet returns the expiring set of k, nil if the key doesn't
+// exist, or ErrInvalidType if its value isn't an *ExpiringSet.
+func (c *cache) getExpiringSet(k string) (*ExpiringSet, error) {
+	x, found := c.get(k)
+	if !found {
+		return nil, nil
+	}
+	s, ok := x.(*ExpiringSet)
+	if !ok {
+		return nil, ErrInvalidType
+	}
+	return s, nil
+}
+
+// EAdd Adds the member to the expiring set of k, expiring after ttl, and
+// reports whether it is new. If the member is already in the set, its
+// expiration is replaced. If ttl is DefaultExpiration, the cache's default
+// expiration is used, and if it is NoExpiration, the member never expires.
+// A new set with the default expiration is created if the key doesn't exist,
+// otherwise the expiration of the key is kept. Returns ErrInvalidType if the
+// value of k isn't an *ExpiringSet.
+func (c *cache) EAdd(k, member string, ttl time.Duration) (bool, error) {
+	var added bool
+	err := c.modifyExpiringSet(k, true, func(s *ExpiringSet, now int64) {
+		added = s.add(member, c.newItem(nil, ttl).Expiration, now)
+	})
+	return added, err
+}
+
+// EContains Reports whether m is an unexpired member of the expiring set of
+// k. Returns ErrInvalidType if the value of k isn't an *ExpiringSet.
+func (c *cache) EContains(k, m string) (bool, error) {
+	s, err := c.getExpiringSet(k)
+	if s == nil {
+		return false, err
+	}
+	return s.contains(m, c.timeCache.Load()), nil
+}
+
+// EMembers Returns the unexpired members of the expiring set of k, sorted,
+// or an empty slice if the key doesn't exist. Returns ErrInvalidType if the
+// value of k isn't an *ExpiringSet.
+func (c *cache) EMembers(k string) ([]string, error) {
+	s, err := c.getExpiringSet(k)
+	if s == nil {
+		if err != nil {
+			return nil, err
+		}
+		return []string{}, nil
+	}
+	return s.members(c.timeCache.Load()), nil
+}
+
+// ELen Returns the number of unexpired members of the expiring set of k,
+// zero if the key doesn't exist. Returns ErrInvalidType if the value of k
+// isn't an *ExpiringSet.
+func (c *cache) ELen(k string) (int, error) {
+	s, err := c.getExpiringSet(k)
+	if s == nil {
+		return 0, err
+	}
+	return len(s.members(c.timeCache.Load())), nil
+}
@@ -0,0 +1,146 @@
+package cache
+
+import (
+	"encoding/json"
+	"slices"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestExpiringSet(t *testing.T) {
+	tc := New(NoExpiration, 0)
+	defer tc.Close()
+	if added, err := tc.EAdd("s", "a", 20*time.Millisecond); !added || err != nil {
+		t.Fatal(added, err)
+	}
+	if added, _ := tc.EAdd("s", "a", 20*time.Millisecond); added {
+		t.Error("existing member was added")
+	}
+	tc.EAdd("s", "b", NoExpiration)
+	if ok, _ := tc.EContains("s", "a"); !ok {
+		t.Error("a is not a member")
+	}
+	if members, _ := tc.EMembers("s"); !slices.Equal(members, []string{"a", "b"}) {
+		t.Error("unexpected members:", members)
+	}
+	tc.timeCache.Add(int64(30 * time.Millisecond))
+	if ok, _ := tc.EContains("s", "a"); ok {
+		t.Error("expired member is a member")
+	}
+	if n, _ := tc.ELen("s"); n != 1 {
+		t.Error("unexpected length:", n)
+	}
+	if added, _ := tc.EAdd("s", "a", NoExpiration); !added {
+		t.Error("expired member was not added again")
+	}
+	if members, err := tc.EMembers("missing"); members == nil || len(members) != 0 || err != nil {
+		t.Error("unexpected members of a missing key:", members, err)
+	}
+	tc.Set("x", 1, DefaultExpiration)
+	if _, err := tc.EAdd("x", "a", NoExpiration); err != ErrInvalidType {
+		t.Error("unexpected EAdd error:", err)
+	}
+	if _, err := tc.EContains("x", "a"); err != ErrInvalidType {
+		t.Error("unexpected EContains error:", err)
+	}
+}
+
+func TestExpiringSetJanitor(t *testing.T) {
+	tc := New(NoExpiration, time.Millisecond, true)
+	defer tc.Close()
+	var mu sync.Mutex
+	var evicted []string
+	tc.OnMemberEvicted(func(k, m string) {
+		mu.Lock()
+		defer mu.Unlock()
+		evicted = append(evicted, k+"/"+m)
+	})
+	tc.EAdd("s", "a", 10*time.Millisecond)
+	tc.EAdd("s", "b", 200*time.Millisecond)
+	tc.EAdd("t", "c", 10*time.Millisecond)
+	<-time.After(50 * time.Millisecond)
+	mu.Lock()
+	slices.Sort(evicted)
+	if !slices.Equal(evicted, []string{"s/a", "t/c"}) {
+		t.Error("unexpected evicted members:", evicted)
+	}
+	mu.Unlock()
+	x, found := tc.Get("s")
+	if !found {
+		t.Fatal("set with unexpired members was deleted")
+	}
+	if got := x.(*ExpiringSet).expirations(); len(got) != 1 {
+		t.Error("expired member was not deleted:", got)
+	}
+	if _, found := tc.Get("t"); found {
+		t.Error("empty set was not deleted")
+	}
+}
+
+func TestExpiringSetSnapshot(t *testing.T) {
+	tc := New(NoExpiration, time.Millisecond, true)
+	defer tc.Close()
+	tc.EAdd("s", "a", 10*time.Millisecond)
+	tc.EAdd("s", "b", NoExpiration)
+	x, _ := tc.Get("s")
+	s := x.(*ExpiringSet)
+	tc.EAdd("s", "c", NoExpiration)
+	<-time.After(50 * time.Millisecond)
+	if got := s.expirations(); len(got) != 2 {
+		t.Error("set returned by Get was changed:", got)
+	}
+	if members, _ := tc.EMembers("s"); !slices.Equal(members, []string{"b", "c"}) {
+		t.Error("unexpected members:", members)
+	}
+}
+
+func TestExpiringSetClock(t *testing.T) {
+	tc := New(NoExpiration, 0)
+	defer tc.Close()
+	tc.EAdd("s", "a", time.Minute)
+	tc.EAdd("s", "b", NoExpiration)
+	x, _ := tc.Get("s")
+	s := x.(*ExpiringSet)
+	// The set agrees with the cache on expired members, even if the clock
+	// of the cache is off.
+	tc.timeCache.Add(int64(2 * time.Minute))
+	if s.Contains("a") || s.Len() != 1 || !slices.Equal(s.Members(), []string{"b"}) {
+		t.Error("member expired by the clock of the cache was reported:", s.Members())
+	}
+	tc.timeCache.Add(-int64(4 * time.Minute))
+	if ok, _ := tc.EContains("s", "a"); !ok || !s.Contains("a") {
+		t.Error("member unexpired by the clock of the cache was not reported")
+	}
+}
+
+func TestExpiringSetEncoding(t *testing.T) {
+	tc := New(NoExpiration, 0)
+	defer tc.Close()
+	tc.EAdd("s", "a", time.Hour)
+	tc.EAdd("s", "b", NoExpiration)
+	x, _ := tc.Get("s")
+	s := x.(*ExpiringSet)
+	data, err := json.Marshal(s)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var s2 ExpiringSet
+	if err := json.Unmarshal(data, &s2); err != nil {
+		t.Fatal(err)
+	}
+	if !slices.Equal(s2.Members(), []string{"a", "b"}) {
+		t.Error("unexpected decoded set:", s2.Members())
+	}
+	data, err = s.GobEncode()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var s3 ExpiringSet
+	if err := s3.GobDecode(data); err != nil {
+		t.Fatal(err)
+	}
+	if s3.next != s.next {
+		t.Error("unexpected next expiration:", s3.next, s.next)
+	}
+}
@@ -0,0 +1,155 @@
+package cache
+
+import (
+	"io"
+	"math/rand/v2"
+	"os"
+	"path/filepath"
+	"strconv"
+)
+
+// writeFileAtomic writes the output of write to fname so that a crash at any
+// point leaves either the previous file or the new one in place, but never a
+// partially written file. The data is written to a temporary file in the same
+// directory, synced, and renamed over fname. If keep is greater than zero, up
+// to keep previous versions of fname are retained as fname.1 (newest) through
+// fname.<keep> (oldest). The new file has the mode of the previous one, or
+// 0666 (before umask) if there is none, the same as with os.Create.
+func writeFileAtomic(fname string, keep int, write func(io.Writer) error) (err error) {
+	dir, base := filepath.Split(fname)
+	if dir == "" {
+		dir = "."
+	}
+	fp, err := createTemp(dir, base)
+	if err != nil {
+		return err
+	}
+	tmp := fp.Name()
+	defer func() {
+		if err != nil {
+			_ = fp.Close()
+			_ = os.Remove(tmp)
+		}
+	}()
+	if fi, serr := os.Stat(fname); serr == nil {
+		if err = fp.Chmod(fi.Mode().Perm()); err != nil {
+			return err
+		}
+	}
+	if err = write(fp); err != nil {
+		return err
+	}
+	if err = fp.Sync(); err != nil {
+		return err
+	}
+	if err = fp.Close(); err != nil {
+		return err
+	}
+	if keep > 0 {
+		if err = rotateFile(fname, keep); err != nil {
+			return err
+		}
+	}
+	if err = os.Rename(tmp, fname); err != nil {
+		return err
+	}
+	return syncDir(dir)
+}
+
+// createTemp creates a new temporary file for base in dir with mode 0666
+// (before umask), unlike os.CreateTemp, which uses 0600.
+func createTemp(dir, base string) (*os.File, error) {
+	for {
+		name := filepath.Join(dir, "."+base+".tmp-"+strconv.FormatUint(rand.Uint64(), 36))
+		fp, err := os.OpenFile(name, os.O_RDWR|os.O_CREATE|os.O_EXCL, 0o666)
+		if !os.IsExist(err) {
+			return fp, err
+		}
+	}
+}
+
+// rotateFile shifts fname.1 ... fname.<keep-1> one position up, dropping
+// fname.<keep>, and makes fname.1 refer to the current fname. The current
+// file is hard-linked, or copied where links aren't supported, so fname
+// stays in place until it is atomically replaced.
+func rotateFile(fname string, keep int) error {
+	if _, err := os.Stat(fname); err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return err
+	}
+	for i := keep - 1; i > 0; i-- {
+		src := rotatedName(fname, i)
+		if err := os.Rename(src, rotatedName(fname, i+1)); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	}
+	dst := rotatedName(fname, 1)
+	if err := os.Remove(dst); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	if err := os.Link(fname, dst); err != nil {
+		return copyFile(fname, dst)
+	}
+	return nil
+}
+
+// copyFile copies src to dst, with the same mode, through a temporary file
+// renamed to dst, so dst is never partially written.
+func copyFile(src, dst string) (err error) {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	fi, err := in.Stat()
+	if err != nil {
+		return err
+	}
+	dir, base := filepath.Split(dst)
+	if dir == "" {
+		dir = "."
+	}
+	out, err := createTemp(dir, base)
+	if err != nil {
+		return err
+	}
+	tmp := out.Name()
+	defer func() {
+		if err != nil {
+			_ = out.Close()
+			_ = os.Remove(tmp)
+		}
+	}()
+	if err = out.Chmod(fi.Mode().Perm()); err != nil {
+		return err
+	}
+	if _, err = io.Copy(out, in); err != nil {
+		return err
+	}
+	if err = out.Sync(); err != nil {
+		return err
+	}
+	if err = out.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp, dst)
+}
+
+func rotatedName(fname string, i int) string {
+	return fname + "." + strconv.Itoa(i)
+}
+
+// syncDir flushes directory entry changes (creates, renames) to stable storage.
+func syncDir(dir string) error {
+	d, err := os.Open(dir)
+	if err != nil {
+		return err
+	}
+	err = d.Sync()
+	if cerr := d.Close(); err == nil {
+		err = cerr
+	}
+	return err
+}
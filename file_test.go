@@ -0,0 +1,124 @@
+package cache
+
+import (
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestWriteFileAtomicKeepsPreviousOnError(t *testing.T) {
+	fname := filepath.Join(t.TempDir(), "cache.dat")
+	if err := os.WriteFile(fname, []byte("good"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	errWrite := errors.New("write failed")
+	err := writeFileAtomic(fname, 0, func(w io.Writer) error {
+		_, _ = w.Write([]byte("partial"))
+		return errWrite
+	})
+	if !errors.Is(err, errWrite) {
+		t.Fatal("unexpected error:", err)
+	}
+	b, err := os.ReadFile(fname)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(b) != "good" {
+		t.Error("previous file was overwritten:", string(b))
+	}
+	entries, err := os.ReadDir(filepath.Dir(fname))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 1 {
+		t.Error("temporary file was not removed, entries:", len(entries))
+	}
+}
+
+func TestSaveFileRotate(t *testing.T) {
+	fname := filepath.Join(t.TempDir(), "cache.dat")
+	tc := New(DefaultExpiration, 0)
+	for _, v := range []string{"a", "b", "c", "d"} {
+		tc.Set("v", v, DefaultExpiration)
+		if err := tc.SaveFileRotate(fname, 2); err != nil {
+			t.Fatal("Couldn't save cache:", err)
+		}
+	}
+	for name, want := range map[string]string{
+		fname:                 "d",
+		rotatedName(fname, 1): "c",
+		rotatedName(fname, 2): "b",
+	} {
+		oc := New(DefaultExpiration, 0)
+		if err := oc.LoadFile(name); err != nil {
+			t.Fatal("Couldn't load", name, err)
+		}
+		if v, _ := oc.Get("v"); v != want {
+			t.Errorf("%s contains %v, expected %s", name, v, want)
+		}
+	}
+	if _, err := os.Stat(rotatedName(fname, 3)); !os.IsNotExist(err) {
+		t.Error("more snapshots than requested were kept")
+	}
+}
+
+func TestWriteFileAtomicMode(t *testing.T) {
+	dir := t.TempDir()
+	// A file created by os.Create has the mode expected of a new snapshot.
+	ref := filepath.Join(dir, "ref")
+	fp, err := os.Create(ref)
+	if err != nil {
+		t.Fatal(err)
+	}
+	fp.Close()
+	want, err := os.Stat(ref)
+	if err != nil {
+		t.Fatal(err)
+	}
+	write := func(w io.Writer) error {
+		_, err := w.Write([]byte("data"))
+		return err
+	}
+	fname := filepath.Join(dir, "cache.dat")
+	if err := writeFileAtomic(fname, 0, write); err != nil {
+		t.Fatal(err)
+	}
+	if fi, err := os.Stat(fname); err != nil || fi.Mode() != want.Mode() {
+		t.Errorf("unexpected mode of a new file: %v, expected %v", fi.Mode(), want.Mode())
+	}
+
+	// The mode of an existing file is kept.
+	if err := os.Chmod(fname, 0o640); err != nil {
+		t.Fatal(err)
+	}
+	if err := writeFileAtomic(fname, 1, write); err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range []string{fname, rotatedName(fname, 1)} {
+		if fi, err := os.Stat(name); err != nil || fi.Mode().Perm() != 0o640 {
+			t.Errorf("unexpected mode of %s: %v", name, fi.Mode())
+		}
+	}
+}
+
+func TestCopyFile(t *testing.T) {
+	dir := t.TempDir()
+	src, dst := filepath.Join(dir, "src"), filepath.Join(dir, "dst")
+	if err := os.WriteFile(src, []byte("data"), 0o640); err != nil {
+		t.Fatal(err)
+	}
+	if err := copyFile(src, dst); err != nil {
+		t.Fatal(err)
+	}
+	if b, err := os.ReadFile(dst); string(b) != "data" || err != nil {
+		t.Error("unexpected copy:", string(b), err)
+	}
+	if fi, err := os.Stat(dst); err != nil || fi.Mode().Perm() != 0o640 {
+		t.Error("unexpected mode of the copy:", fi.Mode())
+	}
+	if entries, _ := os.ReadDir(dir); len(entries) != 2 {
+		t.Error("temporary file was not removed, entries:", len(entries))
+	}
+}
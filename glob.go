@@ -0,0 +1,102 @@
+package cache
+
+// MatchGlob Reports whether s matches the Redis-style glob pattern: '*'
+// matches any sequence, '?' any single byte, '[abc]', '[^abc]' and '[a-z]'
+// sets of bytes, and '\' escapes the next byte.
+func MatchGlob(pattern, s string) bool {
+	// Only the last star is backtracked to: a match of the pattern after
+	// an earlier star, which a later one failed to extend, can't be made
+	// to work by moving the earlier star further, since the later star
+	// could have absorbed that move. Matching is thus O(len(pattern)*len(s)).
+	var p, i int
+	star, starI := -1, 0
+	for i < len(s) {
+		if p < len(pattern) && pattern[p] == '*' {
+			p++
+			star, starI = p, i
+			continue
+		}
+		if p < len(pattern) {
+			if matched, next := matchByte(pattern, p, s[i]); matched {
+				p, i = next, i+1
+				continue
+			}
+		}
+		if star < 0 {
+			return false
+		}
+		// Let the last star absorb one more byte.
+		starI++
+		p, i = star, starI
+	}
+	for p < len(pattern) && pattern[p] == '*' {
+		p++
+	}
+	return p == len(pattern)
+}
+
+// matchByte matches c against the single-byte element of the pattern at p,
+// which isn't a star, and returns the position of the next element.
+func matchByte(pattern string, p int, c byte) (bool, int) {
+	switch pattern[p] {
+	case '?':
+		return true, p + 1
+	case '[':
+		matched, rest := matchSet(pattern[p+1:], c)
+		return matched, len(pattern) - len(rest)
+	case '\\':
+		if p+1 < len(pattern) {
+			p++
+		}
+	}
+	return pattern[p] == c, p + 1
+}
+
+// matchSet matches c against the set at the start of pattern (after '['),
+// and returns the rest of the pattern after the closing ']'.
+func matchSet(pattern string, c byte) (bool, string) {
+	negate := len(pattern) > 0 && pattern[0] == '^'
+	if negate {
+		pattern = pattern[1:]
+	}
+	var matched bool
+	for len(pattern) > 0 && pattern[0] != ']' {
+		switch {
+		case pattern[0] == '\\' && len(pattern) > 1:
+			matched = matched || pattern[1] == c
+			pattern = pattern[2:]
+		case len(pattern) > 2 && pattern[1] == '-' && pattern[2] != ']':
+			lo, hi := pattern[0], pattern[2]
+			if lo > hi {
+				lo, hi = hi, lo
+			}
+			matched = matched || (c >= lo && c <= hi)
+			pattern = pattern[3:]
+		default:
+			matched = matched || pattern[0] == c
+			pattern = pattern[1:]
+		}
+	}
+	if len(pattern) > 0 {
+		pattern = pattern[1:]
+	}
+	return matched != negate, pattern
+}
+
+// globPrefix returns the literal prefix of the glob pattern, which all
+// matching strings start with.
+func globPrefix(pattern string) string {
+	var prefix []byte
+	for i := 0; i < len(pattern); i++ {
+		switch pattern[i] {
+		case '*', '?', '[':
+			return string(prefix)
+		case '\\':
+			if i+1 < len(pattern) {
+				i++
+			}
+		}
+		prefix = append(prefix, pattern[i])
+	}
+	return string(prefix)
+}
@@ -0,0 +1,70 @@
+package cache
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestMatchGlob(t *testing.T) {
+	for _, tt := range []struct {
+		pattern, s string
+		match      bool
+	}{
+		{"*", "", true},
+		{"user:*", "user:1", true},
+		{"user:*", "users", false},
+		{"h?llo", "hello", true},
+		{"h?llo", "hllo", false},
+		{"h[ae]llo", "hallo", true},
+		{"h[^e]llo", "hello", false},
+		{"h[a-b]llo", "hbllo", true},
+		{"h\\*llo", "h*llo", true},
+		{"h\\*llo", "hello", false},
+		{"*:*:profile", "user:1:profile", true},
+		{"*:*:profile", "user:1:profiles", false},
+		{"a*b?", "axxbyb", false},
+		{"a*b?", "axxbybz", true},
+		{"*[0-9]", "key", false},
+		{"**x", "abx", true},
+		{"x*", "", false},
+		{"", "", true},
+	} {
+		if m := MatchGlob(tt.pattern, tt.s); m != tt.match {
+			t.Errorf("MatchGlob(%q, %q) = %v", tt.pattern, tt.s, m)
+		}
+	}
+}
+
+func TestMatchGlobPathological(t *testing.T) {
+	// Backtracking to every star would take exponential time.
+	pattern := strings.Repeat("*a", 30) + "*b"
+	s := strings.Repeat("a", 1000)
+	done := make(chan bool)
+	go func() {
+		done <- MatchGlob(pattern, s)
+	}()
+	select {
+	case m := <-done:
+		if m {
+			t.Error("pattern matched")
+		}
+	case <-time.After(time.Second):
+		t.Fatal("matching took too long")
+	}
+}
+
+func TestGlobPrefix(t *testing.T) {
+	for pattern, prefix := range map[string]string{
+		"user:*":     "user:",
+		"user:1?":    "user:1",
+		"[ab]*":      "",
+		"a\\*b*":     "a*b",
+		"plain":      "plain",
+		"trailing\\": "trailing\\",
+	} {
+		if p := globPrefix(pattern); p != prefix {
+			t.Errorf("globPrefix(%q) = %q, expected %q", pattern, p, prefix)
+		}
+	}
+}
@@ -0,0 +1,201 @@
+package cache
+
+import (
+	"bytes"
+	"encoding/gob"
+	"encoding/json"
+	"maps"
+	"strconv"
+)
+
+// Hash A map of string fields to string values stored by HSet. A Hash stored
+// in the cache is never changed: hash operations store a new Hash, so a Hash
+// returned by Get can be read while other goroutines change the hash.
+type Hash struct {
+	m map[string]string
+}
+
+// NewHash Returns a hash with a copy of the fields.
+func NewHash(fields map[string]string) *Hash {
+	return &Hash{m: maps.Clone(fields)}
+}
+
+// Len Returns the number of fields of the hash.
+func (h *Hash) Len() int {
+	return len(h.m)
+}
+
+// Get Returns the value of the field, and a bool indicating whether the
+// field was found.
+func (h *Hash) Get(field string) (string, bool) {
+	v, found := h.m[field]
+	return v, found
+}
+
+// Map Returns a copy of the fields of the hash.
+func (h *Hash) Map() map[string]string {
+	m := maps.Clone(h.m)
+	if m == nil {
+		m = make(map[string]string)
+	}
+	return m
+}
+
+// GobEncode Encodes the fields of the hash with Gob.
+func (h *Hash) GobEncode() ([]byte, error) {
+	var buf bytes.Buffer
+	if err := gob.NewEncoder(&buf).Encode(h.Map()); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// GobDecode Decodes the hash encoded by GobEncode.
+func (h *Hash) GobDecode(data []byte) error {
+	var m map[string]string
+	if err := gob.NewDecoder(bytes.NewReader(data)).Decode(&m); err != nil {
+		return err
+	}
+	*h = Hash{m: m}
+	return nil
+}
+
+// MarshalJSON Encodes the hash as a JSON object.
+func (h *Hash) MarshalJSON() ([]byte, error) {
+	return json.Marshal(h.Map())
+}
+
+// UnmarshalJSON Decodes the hash from a JSON object.
+func (h *Hash) UnmarshalJSON(data []byte) error {
+	var m map[string]string
+	if err := json.Unmarshal(data, &m); err != nil {
+		return err
+	}
+	*h = Hash{m: m}
+	return nil
+}
+
+// getHash returns the hash of k, nil if the key doesn't exist, or
+// ErrInvalidType if its value isn't a *Hash.
+func (c *cache) getHash(k string) (*Hash, error) {
+	x, found := c.get(k)
+	if !found {
+		return nil, nil
+	}
+	h, ok := x.(*Hash)
+	if !ok {
+		return nil, ErrInvalidType
+	}
+	return h, nil
+}
+
+// modifyHash calls f with a copy of the fields of the hash of k under the
+// lock of k, creating it with the default expiration if the key doesn't exist
+// and create is true, see modifyValue, and stores a new hash of the fields.
+// The key is deleted if the hash is empty after f.
+func (c *cache) modifyHash(k string, create bool, f func(m map[string]string) error) error {
+	var newHash func() any
+	if create {
+		newHash = func() any {
+			return NewHash(nil)
+		}
+	}
+	return c.modifyValue(k, newHash, func(x any) (any, error) {
+		h, ok := x.(*Hash)
+		if !ok {
+			return nil, ErrInvalidType
+		}
+		m := h.Map()
+		if err := f(m); err != nil || len(m) == 0 {
+			return nil, err
+		}
+		return &Hash{m: m}, nil
+	})
+}
+
+// HSet Sets the field of the hash of k to value, and returns true if the
+// field is new. A new hash with the default expiration is created if the key
+// doesn't exist, otherwise the expiration is kept. Returns ErrInvalidType if
+// the value of k isn't a *Hash.
+func (c *cache) HSet(k, field, value string) (bool, error) {
+	var created bool
+	err := c.modifyHash(k, true, func(m map[string]string) error {
+		_, found := m[field]
+		created = !found
+		m[field] = value
+		return nil
+	})
+	return created, err
+}
+
+// HGet Returns the value of the field of the hash of k. Returns ErrNotExists
+// if the key or the field doesn't exist, and ErrInvalidType if the value of k
+// isn't a *Hash.
+func (c *cache) HGet(k, field string) (string, error) {
+	h, err := c.getHash(k)
+	if h == nil {
+		if err == nil {
+			err = ErrNotExists
+		}
+		return "", err
+	}
+	v, found := h.Get(field)
+	if !found {
+		return "", ErrNotExists
+	}
+	return v, nil
+}
+
+// HDel Deletes the fields from the hash of k and returns the number of
+// deleted fields. The key is deleted when its last field is deleted. Returns
+// ErrInvalidType if the value of k isn't a *Hash.
+func (c *cache) HDel(k string, fields ...string) (int, error) {
+	var n int
+	err := c.modifyHash(k, false, func(m map[string]string) error {
+		for _, f := range fields {
+			if _, found := m[f]; found {
+				delete(m, f)
+				n++
+			}
+		}
+		return nil
+	})
+	if err == ErrNotExists {
+		return 0, nil
+	}
+	return n, err
+}
+
+// HGetAll Returns a copy of the fields of the hash of k, an empty map if the
+// key doesn't exist. Returns ErrInvalidType if the value of k isn't a *Hash.
+func (c *cache) HGetAll(k string) (map[string]string, error) {
+	h, err := c.getHash(k)
+	if h == nil {
+		if err != nil {
+			return nil, err
+		}
+		return map[string]string{}, nil
+	}
+	return h.Map(), nil
+}
+
+// HIncrBy Increments the integer value of the field of the hash of k by n,
+// and returns the new value. A missing field is set to n, and a missing key
+// is created as by HSet. Returns ErrInvalidType if the value of k isn't a
+// *Hash, or if the field value isn't an integer.
+func (c *cache) HIncrBy(k, field string, n int64) (int64, error) {
+	var result int64
+	err := c.modifyHash(k, true, func(m map[string]string) error {
+		var cur int64
+		if s, found := m[field]; found {
+			var err error
+			if cur, err = strconv.ParseInt(s, 10, 64); err != nil {
+				return ErrInvalidType
+			}
+		}
+		result = cur + n
+		m[field] = strconv.FormatInt(result, 10)
+		return nil
+	})
+	return result, err
+}
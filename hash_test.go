@@ -0,0 +1,130 @@
+package cache
+
+import (
+	"encoding/json"
+	"maps"
+	"sync"
+	"testing"
+)
+
+func TestHash(t *testing.T) {
+	tc := New(DefaultExpiration, 0)
+	defer tc.Close()
+	if created, err := tc.HSet("h", "a", "1"); !created || err != nil {
+		t.Fatal(created, err)
+	}
+	if created, err := tc.HSet("h", "a", "2"); created || err != nil {
+		t.Fatal(created, err)
+	}
+	tc.HSet("h", "b", "x")
+	if v, err := tc.HGet("h", "a"); v != "2" || err != nil {
+		t.Error("unexpected HGet result:", v, err)
+	}
+	if _, err := tc.HGet("h", "c"); err != ErrNotExists {
+		t.Error("unexpected error for a missing field:", err)
+	}
+	if _, err := tc.HGet("missing", "a"); err != ErrNotExists {
+		t.Error("unexpected error for a missing key:", err)
+	}
+	if m, _ := tc.HGetAll("h"); !maps.Equal(m, map[string]string{"a": "2", "b": "x"}) {
+		t.Error("unexpected fields:", m)
+	}
+	if n, err := tc.HIncrBy("h", "a", 5); n != 7 || err != nil {
+		t.Error("unexpected HIncrBy result:", n, err)
+	}
+	if n, err := tc.HIncrBy("h", "c", -2); n != -2 || err != nil {
+		t.Error("unexpected HIncrBy result for a new field:", n, err)
+	}
+	if _, err := tc.HIncrBy("h", "b", 1); err != ErrInvalidType {
+		t.Error("unexpected HIncrBy error:", err)
+	}
+	if n, err := tc.HDel("h", "a", "z"); n != 1 || err != nil {
+		t.Error("unexpected HDel result:", n, err)
+	}
+	if n, _ := tc.HDel("h", "b", "c"); n != 2 {
+		t.Error("unexpected HDel result:", n)
+	}
+	if _, found := tc.Get("h"); found {
+		t.Error("empty hash was not deleted")
+	}
+	if m, err := tc.HGetAll("h"); m == nil || len(m) != 0 || err != nil {
+		t.Error("unexpected fields of a missing key:", m, err)
+	}
+}
+
+func TestHashSnapshot(t *testing.T) {
+	tc := New(DefaultExpiration, 0)
+	defer tc.Close()
+	tc.HSet("h", "a", "1")
+	x, _ := tc.Get("h")
+	h := x.(*Hash)
+	tc.HSet("h", "a", "2")
+	tc.HSet("h", "b", "x")
+	if m := h.Map(); !maps.Equal(m, map[string]string{"a": "1"}) {
+		t.Error("hash returned by Get was changed:", m)
+	}
+	if m, _ := tc.HGetAll("h"); !maps.Equal(m, map[string]string{"a": "2", "b": "x"}) {
+		t.Error("unexpected fields:", m)
+	}
+}
+
+func TestHashInvalidType(t *testing.T) {
+	tc := New(DefaultExpiration, 0)
+	defer tc.Close()
+	tc.Set("x", "v", DefaultExpiration)
+	if _, err := tc.HSet("x", "a", "1"); err != ErrInvalidType {
+		t.Error("unexpected HSet error:", err)
+	}
+	if _, err := tc.HGet("x", "a"); err != ErrInvalidType {
+		t.Error("unexpected HGet error:", err)
+	}
+	if _, err := tc.HGetAll("x"); err != ErrInvalidType {
+		t.Error("unexpected HGetAll error:", err)
+	}
+}
+
+func TestHashEncoding(t *testing.T) {
+	h := NewHash(map[string]string{"a": "1"})
+	data, err := json.Marshal(h)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var h2 Hash
+	if err := json.Unmarshal(data, &h2); err != nil {
+		t.Fatal(err)
+	}
+	if v, _ := h2.Get("a"); v != "1" {
+		t.Error("unexpected decoded hash:", h2.Map())
+	}
+	data, err = h.GobEncode()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var h3 Hash
+	if err := h3.GobDecode(data); err != nil {
+		t.Fatal(err)
+	}
+	if !maps.Equal(h3.Map(), h.Map()) {
+		t.Error("unexpected decoded hash:", h3.Map())
+	}
+}
+
+func TestHashConcurrentIncrBy(t *testing.T) {
+	tc := New(DefaultExpiration, 0)
+	defer tc.Close()
+	var wg sync.WaitGroup
+	for range 8 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for range 100 {
+				tc.HIncrBy("h", "n", 1)
+				tc.HGetAll("h")
+			}
+		}()
+	}
+	wg.Wait()
+	if v, _ := tc.HGet("h", "n"); v != "800" {
+		t.Error("unexpected counter:", v)
+	}
+}
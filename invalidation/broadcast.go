@@ -0,0 +1,339 @@
+package invalidation
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/sot-tech/go-cache"
+)
+
+// DefaultTimeout is the default timeout of connecting and writing to TCP
+// peers.
+const DefaultTimeout = 5 * time.Second
+
+// maxMessageSize is the maximum size of an encoded message, the maximum
+// payload of a UDP datagram.
+const maxMessageSize = 65507
+
+// Config Settings of a Broadcaster.
+type Config struct {
+	// Network is "udp" (the default), "udp4", "udp6", "tcp", "tcp4" or
+	// "tcp6".
+	Network string
+	// Addr is the address to listen on for invalidations of the peers.
+	Addr string
+	// Peers are the addresses of the other instances, see
+	// Broadcaster.SetPeers.
+	Peers []string
+	// Timeout is the timeout of connecting and writing to TCP peers,
+	// DefaultTimeout if zero.
+	Timeout time.Duration
+	// OnError, if set, is called with the errors of receiving
+	// invalidations, like invalid messages or broken connections.
+	OnError func(error)
+}
+
+// Broadcaster Invalidator sending invalidations to its peers over UDP or TCP,
+// and applying those received from them.
+//
+// Over UDP, every invalidation is a datagram sent to every peer, which may be
+// a broadcast address. Datagrams may be lost, and the instance receives its
+// own invalidations sent to a broadcast address, which are ignored. Over TCP,
+// a connection to every peer is made on first use and made again once
+// broken; a peer which is down only makes the invalidation return an error.
+type Broadcaster struct {
+	*node
+	cfg     Config
+	tcp     bool
+	pc      net.PacketConn // UDP
+	ln      net.Listener   // TCP
+	wg      sync.WaitGroup
+	mu      sync.Mutex
+	peers   []string
+	udpAddr []net.Addr
+	conns   map[string]*tcpPeer   // outgoing TCP connections by address
+	accept  map[net.Conn]struct{} // incoming TCP connections
+	closed  bool
+}
+
+// Listen Returns a broadcaster of invalidations of c, listening on cfg.Addr.
+func Listen(c *cache.Cache, cfg Config) (*Broadcaster, error) {
+	if cfg.Network == "" {
+		cfg.Network = "udp"
+	}
+	if cfg.Timeout <= 0 {
+		cfg.Timeout = DefaultTimeout
+	}
+	b := &Broadcaster{
+		cfg:    cfg,
+		tcp:    strings.HasPrefix(cfg.Network, "tcp"),
+		conns:  make(map[string]*tcpPeer),
+		accept: make(map[net.Conn]struct{}),
+	}
+	b.node = newNode(c, b.broadcast)
+	var err error
+	switch {
+	case b.tcp:
+		b.ln, err = net.Listen(cfg.Network, cfg.Addr)
+	case strings.HasPrefix(cfg.Network, "udp"):
+		b.pc, err = net.ListenPacket(cfg.Network, cfg.Addr)
+	default:
+		err = fmt.Errorf("unsupported network %q", cfg.Network)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err = b.SetPeers(cfg.Peers...); err != nil {
+		b.Close()
+		return nil, err
+	}
+	b.wg.Add(1)
+	if b.tcp {
+		go b.acceptTCP()
+	} else {
+		go b.readUDP()
+	}
+	return b, nil
+}
+
+// Addr Returns the address the broadcaster listens on.
+func (b *Broadcaster) Addr() net.Addr {
+	if b.tcp {
+		return b.ln.Addr()
+	}
+	return b.pc.LocalAddr()
+}
+
+// SetPeers Replaces the addresses of the other instances. Connections to
+// TCP peers which are no longer listed are closed.
+func (b *Broadcaster) SetPeers(addrs ...string) error {
+	var udpAddr []net.Addr
+	if !b.tcp {
+		for _, a := range addrs {
+			ua, err := net.ResolveUDPAddr(b.cfg.Network, a)
+			if err != nil {
+				return err
+			}
+			udpAddr = append(udpAddr, ua)
+		}
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.peers, b.udpAddr = addrs, udpAddr
+	for a, p := range b.conns {
+		if !slices.Contains(addrs, a) {
+			p.close()
+			delete(b.conns, a)
+		}
+	}
+	return nil
+}
+
+// broadcast sends the message to every peer.
+func (b *Broadcaster) broadcast(m message) error {
+	msg := appendMessage(nil, m)
+	if len(msg) > maxMessageSize {
+		return fmt.Errorf("invalidation of %d bytes exceeds the limit of %d", len(msg), maxMessageSize)
+	}
+	b.mu.Lock()
+	if b.closed {
+		b.mu.Unlock()
+		return ErrClosed
+	}
+	var peers []*tcpPeer
+	if b.tcp {
+		for _, a := range b.peers {
+			p := b.conns[a]
+			if p == nil {
+				p = &tcpPeer{addr: a}
+				b.conns[a] = p
+			}
+			peers = append(peers, p)
+		}
+	}
+	udpAddr := b.udpAddr
+	b.mu.Unlock()
+
+	var errs []error
+	if b.tcp {
+		frame := binary.AppendUvarint(nil, uint64(len(msg)))
+		frame = append(frame, msg...)
+		for _, p := range peers {
+			if err := p.send(b.cfg, frame); err != nil {
+				errs = append(errs, fmt.Errorf("sending to %s: %w", p.addr, err))
+			}
+		}
+	} else {
+		for _, a := range udpAddr {
+			if _, err := b.pc.WriteTo(msg, a); err != nil {
+				errs = append(errs, fmt.Errorf("sending to %s: %w", a, err))
+			}
+		}
+	}
+	return errors.Join(errs...)
+}
+
+func (b *Broadcaster) onError(err error) {
+	if b.cfg.OnError != nil {
+		b.cfg.OnError(err)
+	}
+}
+
+func (b *Broadcaster) handle(msg []byte) {
+	m, err := parseMessage(msg)
+	if err != nil {
+		b.onError(err)
+		return
+	}
+	b.receive(m)
+}
+
+func (b *Broadcaster) readUDP() {
+	defer b.wg.Done()
+	buf := make([]byte, maxMessageSize)
+	for {
+		n, _, err := b.pc.ReadFrom(buf)
+		if err != nil {
+			if errors.Is(err, net.ErrClosed) {
+				return
+			}
+			b.onError(err)
+			continue
+		}
+		b.handle(buf[:n])
+	}
+}
+
+func (b *Broadcaster) acceptTCP() {
+	defer b.wg.Done()
+	for {
+		conn, err := b.ln.Accept()
+		if err != nil {
+			if errors.Is(err, net.ErrClosed) {
+				return
+			}
+			b.onError(err)
+			continue
+		}
+		b.mu.Lock()
+		if b.closed {
+			b.mu.Unlock()
+			conn.Close()
+			return
+		}
+		b.accept[conn] = struct{}{}
+		b.wg.Add(1)
+		b.mu.Unlock()
+		go b.readTCP(conn)
+	}
+}
+
+func (b *Broadcaster) readTCP(conn net.Conn) {
+	defer b.wg.Done()
+	defer func() {
+		b.mu.Lock()
+		delete(b.accept, conn)
+		b.mu.Unlock()
+		conn.Close()
+	}()
+	r := bufio.NewReader(conn)
+	var buf []byte
+	for {
+		size, err := binary.ReadUvarint(r)
+		if err == nil && size > maxMessageSize {
+			err = errBadMessage
+		}
+		if err == nil {
+			if cap(buf) < int(size) {
+				buf = make([]byte, size)
+			}
+			buf = buf[:size]
+			_, err = io.ReadFull(r, buf)
+		}
+		if err != nil {
+			if err != io.EOF && !errors.Is(err, net.ErrClosed) {
+				b.onError(fmt.Errorf("receiving from %s: %w", conn.RemoteAddr(), err))
+			}
+			return
+		}
+		b.handle(buf)
+	}
+}
+
+// Close Stops listening, closes the connections and waits for the
+// invalidations being received to be applied.
+func (b *Broadcaster) Close() error {
+	b.mu.Lock()
+	if b.closed {
+		b.mu.Unlock()
+		return nil
+	}
+	b.closed = true
+	for _, p := range b.conns {
+		p.close()
+	}
+	for conn := range b.accept {
+		conn.Close()
+	}
+	b.mu.Unlock()
+	var err error
+	if b.tcp {
+		err = b.ln.Close()
+	} else {
+		err = b.pc.Close()
+	}
+	b.wg.Wait()
+	return err
+}
+
+// tcpPeer An outgoing connection to a TCP peer.
+type tcpPeer struct {
+	addr   string
+	mu     sync.Mutex
+	conn   net.Conn
+	closed bool
+}
+
+// send writes the frame to the peer, connecting first if needed. A write
+// error on an existing connection, which the peer may have closed since, is
+// retried once on a new connection.
+func (p *tcpPeer) send(cfg Config, frame []byte) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.closed {
+		return ErrClosed
+	}
+	var err error
+	for range 2 {
+		if p.conn == nil {
+			if p.conn, err = net.DialTimeout(cfg.Network, p.addr, cfg.Timeout); err != nil {
+				return err
+			}
+		}
+		_ = p.conn.SetWriteDeadline(time.Now().Add(cfg.Timeout))
+		if _, err = p.conn.Write(frame); err == nil {
+			return nil
+		}
+		p.conn.Close()
+		p.conn = nil
+	}
+	return err
+}
+
+func (p *tcpPeer) close() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.closed = true
+	if p.conn != nil {
+		p.conn.Close()
+		p.conn = nil
+	}
+}
@@ -0,0 +1,179 @@
+package invalidation
+
+import (
+	"net"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/sot-tech/go-cache"
+)
+
+// waitUntil fails the test if f doesn't return true within a second.
+func waitUntil(t *testing.T, f func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(time.Second)
+	for !f() {
+		if time.Now().After(deadline) {
+			t.Fatal("condition not reached")
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func listen(t *testing.T, c *cache.Cache, network string) *Broadcaster {
+	b, err := Listen(c, Config{
+		Network: network,
+		Addr:    "127.0.0.1:0",
+		OnError: func(err error) {
+			t.Error(err)
+		},
+	})
+	if err != nil {
+		t.Skip("loopback is not available:", err)
+	}
+	t.Cleanup(func() { b.Close() })
+	return b
+}
+
+func TestBroadcaster(t *testing.T) {
+	for _, network := range []string{"udp", "tcp"} {
+		t.Run(network, func(t *testing.T) {
+			cs := newCaches(3)
+			var bs []*Broadcaster
+			for _, c := range cs {
+				bs = append(bs, listen(t, c, network))
+			}
+			for _, b := range bs {
+				var peers []string
+				for _, o := range bs {
+					// The broadcaster receives its own invalidations, as
+					// with a broadcast address.
+					peers = append(peers, o.Addr().String())
+				}
+				if err := b.SetPeers(peers...); err != nil {
+					t.Fatal(err)
+				}
+			}
+			testInvalidations(t, bs[0], cs, func(f func(*cache.Cache) bool) {
+				for _, c := range cs {
+					waitUntil(t, func() bool {
+						return f(c)
+					})
+				}
+			})
+			bs[2].Close()
+			if err := bs[2].Delete("k"); err != ErrClosed {
+				t.Error("unexpected error of a closed broadcaster:", err)
+			}
+		})
+	}
+}
+
+func TestBroadcasterIgnoresOwnMessages(t *testing.T) {
+	c := cache.New(cache.DefaultExpiration, 0)
+	var deletes atomic.Int64
+	c.OnEvent(func(ev cache.Event) {
+		if ev.Type == cache.EventDelete {
+			deletes.Add(1)
+		}
+	})
+	b := listen(t, c, "udp")
+	conn, err := net.Dial("udp", b.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	send := func(m message) {
+		if _, err := conn.Write(appendMessage(nil, m)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	c.Set("own", 1, cache.DefaultExpiration)
+	c.Set("k", 1, cache.DefaultExpiration)
+	send(message{origin: b.origin, seq: 1, op: opDelete, arg: "own"})
+	m := message{origin: [8]byte{1}, seq: 1, op: opDelete, arg: "k"}
+	send(m)
+	waitUntil(t, func() bool {
+		_, found := c.Get("k")
+		return !found
+	})
+	c.Set("k", 1, cache.DefaultExpiration)
+	send(m)
+	c.Set("marker", 1, cache.DefaultExpiration)
+	send(message{origin: [8]byte{1}, seq: 2, op: opDelete, arg: "marker"})
+	waitUntil(t, func() bool {
+		_, found := c.Get("marker")
+		return !found
+	})
+	if _, found := c.Get("own"); !found {
+		t.Error("own message was applied")
+	}
+	if _, found := c.Get("k"); !found {
+		t.Error("duplicate message was applied")
+	}
+	if n := deletes.Load(); n != 2 {
+		t.Error("unexpected number of deletes:", n)
+	}
+}
+
+func TestBroadcasterTCPPeerDown(t *testing.T) {
+	c := cache.New(cache.DefaultExpiration, 0)
+	b := listen(t, c, "tcp")
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	addr := ln.Addr().String()
+	ln.Close()
+	b.SetPeers(addr)
+	c.Set("k", 1, cache.DefaultExpiration)
+	if err := b.Delete("k"); err == nil {
+		t.Error("no error for an unreachable peer")
+	}
+	if _, found := c.Get("k"); found {
+		t.Error("invalidation was not applied locally")
+	}
+
+	// The peer is connected once it is up.
+	c2 := cache.New(cache.DefaultExpiration, 0)
+	b2, err := Listen(c2, Config{Network: "tcp", Addr: addr})
+	if err != nil {
+		t.Skip("address was taken:", err)
+	}
+	defer b2.Close()
+	c2.Set("k", 1, cache.DefaultExpiration)
+	if err := b.Delete("k"); err != nil {
+		t.Fatal(err)
+	}
+	waitUntil(t, func() bool {
+		_, found := c2.Get("k")
+		return !found
+	})
+}
+
+func TestBroadcasterInvalidMessage(t *testing.T) {
+	c := cache.New(cache.DefaultExpiration, 0)
+	errs := make(chan error, 1)
+	b, err := Listen(c, Config{Addr: "127.0.0.1:0", OnError: func(err error) {
+		errs <- err
+	}})
+	if err != nil {
+		t.Skip("loopback is not available:", err)
+	}
+	defer b.Close()
+	conn, err := net.Dial("udp", b.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	conn.Write([]byte("garbage"))
+	select {
+	case err := <-errs:
+		if err != errBadMessage {
+			t.Error("unexpected error:", err)
+		}
+	case <-time.After(time.Second):
+		t.Error("invalid message was not reported")
+	}
+}
@@ -0,0 +1,272 @@
+// Package invalidation propagates invalidations between the caches of several
+// instances of a service, each with its own cache.Cache, so that an item
+// changed at the source of truth is dropped everywhere:
+//
+//	b, err := invalidation.Listen(c, invalidation.Config{
+//		Addr:  ":7946",
+//		Peers: []string{"10.0.0.2:7946", "10.0.0.3:7946"},
+//	})
+//	...
+//	b.Delete("user:42") // deleted from c and from the caches of the peers
+//
+// Hub connects caches of the same process, and Broadcaster connects
+// processes over UDP or TCP. Invalidations are applied to the local cache
+// first, then sent to the other instances. Delivery is best effort: an
+// instance which is down or unreachable misses the invalidations sent in the
+// meantime, so items should still expire.
+package invalidation
+
+import (
+	"crypto/rand"
+	"encoding/binary"
+	"errors"
+	"sync"
+	"sync/atomic"
+
+	"github.com/sot-tech/go-cache"
+)
+
+// Invalidator Invalidates items of the caches of all instances, including
+// the local one. The returned errors are those of sending the invalidation
+// to other instances, it is applied to the local cache anyway, unless the
+// local cache follows a leader (see cache.Cache.Follow): invalidations are
+// then left to the leader.
+type Invalidator interface {
+	// Delete Deletes the key, see cache.Cache.Delete.
+	Delete(key string) error
+	// InvalidateTag Deletes the items carrying the tag, see
+	// cache.Cache.InvalidateTag.
+	InvalidateTag(tag string) error
+	// DeletePrefix Deletes the items with keys starting with the prefix,
+	// see cache.Cache.DeletePrefix.
+	DeletePrefix(prefix string) error
+	// Flush Deletes all items, see cache.Cache.Flush.
+	Flush() error
+	// Close Stops propagating invalidations from and to the local cache.
+	Close() error
+}
+
+type op uint8
+
+const (
+	opDelete op = iota + 1
+	opTag
+	opPrefix
+	opFlush
+)
+
+// message An invalidation, identified by the instance it originates from and
+// its sequence number there.
+type message struct {
+	origin [8]byte
+	seq    uint64
+	op     op
+	arg    string // key, tag or prefix
+}
+
+// version is the first byte of encoded messages.
+const version = 1
+
+// ErrClosed Returned by invalidators which are closed.
+var ErrClosed = errors.New("invalidator closed")
+
+var errBadMessage = errors.New("invalid invalidation message")
+
+func appendMessage(b []byte, m message) []byte {
+	b = append(b, version)
+	b = append(b, m.origin[:]...)
+	b = binary.AppendUvarint(b, m.seq)
+	b = append(b, byte(m.op))
+	b = binary.AppendUvarint(b, uint64(len(m.arg)))
+	return append(b, m.arg...)
+}
+
+func parseMessage(b []byte) (message, error) {
+	var m message
+	if len(b) < 1+len(m.origin) || b[0] != version {
+		return m, errBadMessage
+	}
+	b = b[1+copy(m.origin[:], b[1:]):]
+	seq, n := binary.Uvarint(b)
+	if n <= 0 || n >= len(b) {
+		return m, errBadMessage
+	}
+	m.seq, m.op, b = seq, op(b[n]), b[n+1:]
+	size, n := binary.Uvarint(b)
+	if n <= 0 || size != uint64(len(b)-n) || m.op < opDelete || m.op > opFlush {
+		return m, errBadMessage
+	}
+	m.arg = string(b[n:])
+	return m, nil
+}
+
+// node Applies invalidations to a cache, and sends them to other instances
+// with send.
+type node struct {
+	c      *cache.Cache
+	origin [8]byte
+	seq    atomic.Uint64
+	send   func(message) error
+	mu     sync.Mutex
+	seen   map[[8]byte]*window
+}
+
+func newNode(c *cache.Cache, send func(message) error) *node {
+	n := &node{c: c, send: send, seen: make(map[[8]byte]*window)}
+	_, _ = rand.Read(n.origin[:])
+	return n
+}
+
+// apply applies the invalidation to the cache, unless it follows a leader,
+// which invalidates it in turn.
+func (n *node) apply(m message) {
+	if n.c.ReadOnly() {
+		return
+	}
+	// The cache may follow a leader since it was checked, in which case
+	// InvalidateTag and DeletePrefix panic.
+	defer recoverReadOnly()
+	switch m.op {
+	case opDelete:
+		_, _ = n.c.TryDelete(m.arg)
+	case opTag:
+		n.c.InvalidateTag(m.arg)
+	case opPrefix:
+		n.c.DeletePrefix(m.arg)
+	case opFlush:
+		_ = n.c.TryFlush()
+	}
+}
+
+// recoverReadOnly recovers from a panic with cache.ErrReadOnly, the panics of
+// the writers of a cache which follows a leader.
+func recoverReadOnly() {
+	if r := recover(); r != nil {
+		if err, ok := r.(error); !ok || !errors.Is(err, cache.ErrReadOnly) {
+			panic(r)
+		}
+	}
+}
+
+func (n *node) publish(op op, arg string) error {
+	m := message{origin: n.origin, seq: n.seq.Add(1), op: op, arg: arg}
+	n.apply(m)
+	return n.send(m)
+}
+
+// receive applies a message of another instance, unless it was sent by the
+// node itself or was already received.
+func (n *node) receive(m message) {
+	if m.origin == n.origin {
+		return
+	}
+	n.mu.Lock()
+	w := n.seen[m.origin]
+	if w == nil {
+		w = &window{}
+		n.seen[m.origin] = w
+	}
+	dup := w.seen(m.seq)
+	n.mu.Unlock()
+	if !dup {
+		n.apply(m)
+	}
+}
+
+// Delete Implements Invalidator.
+func (n *node) Delete(key string) error {
+	return n.publish(opDelete, key)
+}
+
+// InvalidateTag Implements Invalidator.
+func (n *node) InvalidateTag(tag string) error {
+	return n.publish(opTag, tag)
+}
+
+// DeletePrefix Implements Invalidator.
+func (n *node) DeletePrefix(prefix string) error {
+	return n.publish(opPrefix, prefix)
+}
+
+// Flush Implements Invalidator.
+func (n *node) Flush() error {
+	return n.publish(opFlush, "")
+}
+
+// window Sequence numbers received from an instance, within 64 of the
+// highest one.
+type window struct {
+	max  uint64
+	bits uint64 // bit i is set if max-i was received
+}
+
+// seen records seq and reports whether it was received before. Sequence
+// numbers too old to tell are reported as new, as applying an invalidation
+// twice is harmless, while missing one isn't.
+func (w *window) seen(seq uint64) bool {
+	switch {
+	case seq > w.max:
+		if d := seq - w.max; d < 64 {
+			w.bits = w.bits<<d | 1
+		} else {
+			w.bits = 1
+		}
+		w.max = seq
+		return false
+	case w.max-seq >= 64:
+		return false
+	}
+	bit := uint64(1) << (w.max - seq)
+	dup := w.bits&bit != 0
+	w.bits |= bit
+	return dup
+}
+
+// Hub Connects the caches of a process, e.g. caches of separate components,
+// or instances of a service in tests.
+type Hub struct {
+	mu      sync.RWMutex
+	members map[*Member]struct{}
+}
+
+// NewHub Returns a hub without members.
+func NewHub() *Hub {
+	return &Hub{members: make(map[*Member]struct{})}
+}
+
+// Member Invalidator of a cache joined to a Hub. Invalidations are applied
+// to the caches of the other members before its methods return.
+type Member struct {
+	*node
+	h *Hub
+}
+
+// Join Returns an Invalidator of c, which propagates invalidations to and
+// from the other members of the hub.
+func (h *Hub) Join(c *cache.Cache) *Member {
+	m := &Member{h: h}
+	m.node = newNode(c, func(msg message) error {
+		h.mu.RLock()
+		defer h.mu.RUnlock()
+		if _, joined := h.members[m]; !joined {
+			return ErrClosed
+		}
+		for o := range h.members {
+			o.receive(msg)
+		}
+		return nil
+	})
+	h.mu.Lock()
+	h.members[m] = struct{}{}
+	h.mu.Unlock()
+	return m
+}
+
+// Close Leaves the hub. Invalidations of the member are then only applied to
+// its own cache, and return ErrClosed.
+func (m *Member) Close() error {
+	m.h.mu.Lock()
+	delete(m.h.members, m)
+	m.h.mu.Unlock()
+	return nil
+}
@@ -0,0 +1,160 @@
+package invalidation
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/sot-tech/go-cache"
+)
+
+func TestMessageEncoding(t *testing.T) {
+	m := message{origin: [8]byte{1, 2, 3, 4, 5, 6, 7, 8}, seq: 300, op: opPrefix, arg: "user:"}
+	b := appendMessage(nil, m)
+	if got, err := parseMessage(b); got != m || err != nil {
+		t.Error("unexpected message:", got, err)
+	}
+	for i := range b {
+		if _, err := parseMessage(b[:i]); err != errBadMessage {
+			t.Errorf("truncated message of %d bytes was parsed: %v", i, err)
+		}
+	}
+	m.op = 0
+	if _, err := parseMessage(appendMessage(nil, m)); err != errBadMessage {
+		t.Error("message with an unknown op was parsed:", err)
+	}
+}
+
+func TestWindow(t *testing.T) {
+	var w window
+	for _, seq := range []uint64{1, 3, 2, 70, 10} {
+		if w.seen(seq) {
+			t.Errorf("%d was reported as seen", seq)
+		}
+	}
+	for _, seq := range []uint64{1, 2, 3, 70} {
+		// 1, 2 and 3 are too old to tell.
+		if seen := w.seen(seq); seen != (seq == 70) {
+			t.Errorf("unexpected result for %d: %v", seq, seen)
+		}
+	}
+	if !w.seen(10) {
+		t.Error("10 was not reported as seen")
+	}
+}
+
+func newCaches(n int) []*cache.Cache {
+	cs := make([]*cache.Cache, n)
+	for i := range cs {
+		cs[i] = cache.New(cache.DefaultExpiration, 0)
+		cs[i].Set("key", 1, cache.DefaultExpiration)
+		cs[i].SetWithTags("tagged", 1, cache.DefaultExpiration, "tag")
+		cs[i].Set("user:1", 1, cache.DefaultExpiration)
+		cs[i].Set("user:2", 1, cache.DefaultExpiration)
+		cs[i].Set("other", 1, cache.DefaultExpiration)
+	}
+	return cs
+}
+
+// testInvalidations invalidates items of the caches with inv, calling sync
+// after each invalidation to wait for it to be propagated.
+func testInvalidations(t *testing.T, inv Invalidator, cs []*cache.Cache, sync func(func(c *cache.Cache) bool)) {
+	t.Helper()
+	missing := func(k string) func(*cache.Cache) bool {
+		return func(c *cache.Cache) bool {
+			_, found := c.Get(k)
+			return !found
+		}
+	}
+	if err := inv.Delete("key"); err != nil {
+		t.Fatal(err)
+	}
+	sync(missing("key"))
+	if err := inv.InvalidateTag("tag"); err != nil {
+		t.Fatal(err)
+	}
+	sync(missing("tagged"))
+	if err := inv.DeletePrefix("user:"); err != nil {
+		t.Fatal(err)
+	}
+	sync(missing("user:2"))
+	for _, c := range cs {
+		if n := c.ItemCount(); n != 1 {
+			t.Fatal("unexpected number of items left:", n)
+		}
+	}
+	if err := inv.Flush(); err != nil {
+		t.Fatal(err)
+	}
+	sync(missing("other"))
+}
+
+func TestHub(t *testing.T) {
+	cs := newCaches(3)
+	h := NewHub()
+	var members []*Member
+	for _, c := range cs {
+		members = append(members, h.Join(c))
+	}
+	// Invalidations are propagated synchronously.
+	testInvalidations(t, members[1], cs, func(f func(*cache.Cache) bool) {
+		for i, c := range cs {
+			if !f(c) {
+				t.Fatalf("invalidation was not applied to cache %d", i)
+			}
+		}
+	})
+
+	cs[0].Set("k", 1, cache.DefaultExpiration)
+	cs[1].Set("k", 1, cache.DefaultExpiration)
+	members[0].Close()
+	if err := members[0].Delete("k"); err != ErrClosed {
+		t.Error("unexpected error of a closed member:", err)
+	}
+	if _, found := cs[1].Get("k"); !found {
+		t.Error("invalidation of a closed member was propagated")
+	}
+	cs[0].Set("k", 1, cache.DefaultExpiration)
+	members[1].Delete("k")
+	if _, found := cs[0].Get("k"); !found {
+		t.Error("invalidation was propagated to a closed member")
+	}
+}
+
+func TestReceiveDeduplicates(t *testing.T) {
+	c := cache.New(cache.DefaultExpiration, 0)
+	n := newNode(c, func(message) error { return nil })
+	m := message{origin: [8]byte{1}, seq: 1, op: opDelete, arg: "k"}
+	c.Set("k", 1, cache.DefaultExpiration)
+	n.receive(m)
+	if _, found := c.Get("k"); found {
+		t.Error("message was not applied")
+	}
+	c.Set("k", 1, cache.DefaultExpiration)
+	n.receive(m)
+	if _, found := c.Get("k"); !found {
+		t.Error("duplicate message was applied")
+	}
+	m.origin = n.origin
+	m.seq = 2
+	n.receive(m)
+	if _, found := c.Get("k"); !found {
+		t.Error("own message was applied")
+	}
+}
+
+func TestRecoverReadOnly(t *testing.T) {
+	func() {
+		defer recoverReadOnly()
+		panic(cache.ErrReadOnly)
+	}()
+	errOther := errors.New("other")
+	defer func() {
+		if r := recover(); r != errOther {
+			t.Error("unexpected panic:", r)
+		}
+	}()
+	func() {
+		defer recoverReadOnly()
+		panic(errOther)
+	}()
+}
@@ -0,0 +1,116 @@
+package cache
+
+import (
+	"iter"
+	"maps"
+	"slices"
+)
+
+// All Returns an iterator over the unexpired items of the cache. Unlike
+// Items, it doesn't copy the cache: items are read lazily while the iteration
+// proceeds, so the iterator is cheap to stop early.
+//
+// The iteration is not a snapshot. Each key is visited at most once, but
+// items stored, replaced or deleted during the iteration may or may not be
+// seen, and items expiring during the iteration are still yielded, since
+// expiration is checked against the time the iteration started. The cache may
+// be modified while iterating, including from the loop body.
+func (c *cache) All() iter.Seq2[string, Item] {
+	return func(yield func(string, Item) bool) {
+		now := c.timeCache.Load()
+		c.items.Range(func(key, value any) bool {
+			v := value.(Item)
+			if v.expired(now) {
+				return true
+			}
+			return yield(key.(string), v)
+		})
+	}
+}
+
+// Keys Returns an iterator over the keys of the unexpired items of the cache,
+// with the same consistency as All.
+func (c *cache) Keys() iter.Seq[string] {
+	return keys(c.All())
+}
+
+// Values Returns an iterator over the values of the unexpired items of the
+// cache, with the same consistency as All.
+func (c *cache) Values() iter.Seq[any] {
+	return func(yield func(any) bool) {
+		for _, v := range c.All() {
+			if !yield(v.Object) {
+				return
+			}
+		}
+	}
+}
+
+// All Returns an iterator over the unexpired items of all shards, one shard
+// after another, with the same consistency as cache.All.
+func (sc *shardedCache) All() iter.Seq2[string, Item] {
+	return func(yield func(string, Item) bool) {
+		for _, c := range sc.cs {
+			for k, v := range c.All() {
+				if !yield(k, v) {
+					return
+				}
+			}
+		}
+	}
+}
+
+// Keys Returns an iterator over the keys of the unexpired items of all
+// shards, with the same consistency as cache.All.
+func (sc *shardedCache) Keys() iter.Seq[string] {
+	return keys(sc.All())
+}
+
+// Values Returns an iterator over the values of the unexpired items of all
+// shards, with the same consistency as cache.All.
+func (sc *shardedCache) Values() iter.Seq[any] {
+	return func(yield func(any) bool) {
+		for _, v := range sc.All() {
+			if !yield(v.Object) {
+				return
+			}
+		}
+	}
+}
+
+// keys returns an iterator over the keys yielded by seq.
+func keys(seq iter.Seq2[string, Item]) iter.Seq[string] {
+	return func(yield func(string) bool) {
+		for k := range seq {
+			if !yield(k) {
+				return
+			}
+		}
+	}
+}
+
+// Collect Copies the items yielded by seq, e.g. by All, into a new map.
+func Collect(seq iter.Seq2[string, Item]) map[string]Item {
+	m := make(map[string]Item)
+	maps.Insert(m, seq)
+	return m
+}
+
+// CollectKeys Returns the keys yielded by seq, e.g. by Keys, sorted.
+func CollectKeys(seq iter.Seq[string]) []string {
+	keys := slices.Sorted(seq)
+	if keys == nil {
+		keys = []string{}
+	}
+	return keys
+}
+
+// CollectValues Copies the values yielded by seq, e.g. by All, into a new map,
+// dropping expirations.
+func CollectValues(seq iter.Seq2[string, Item]) map[string]any {
+	m := make(map[string]any)
+	for k, v := range seq {
+		m[k] = v.Object
+	}
+	return m
+}
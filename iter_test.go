@@ -0,0 +1,61 @@
+package cache
+
+import (
+	"slices"
+	"testing"
+	"time"
+)
+
+func TestIterators(t *testing.T) {
+	tc := New(DefaultExpiration, 0, true)
+	defer tc.Close()
+	tc.Set("a", 1, NoExpiration)
+	tc.Set("b", 2, NoExpiration)
+	tc.Set("expired", 3, time.Millisecond)
+	<-time.After(5 * time.Millisecond)
+	if keys := CollectKeys(tc.Keys()); !slices.Equal(keys, []string{"a", "b"}) {
+		t.Error("unexpected keys:", keys)
+	}
+	values := slices.Collect(tc.Values())
+	slices.SortFunc(values, func(a, b any) int { return a.(int) - b.(int) })
+	if !slices.Equal(values, []any{1, 2}) {
+		t.Error("unexpected values:", values)
+	}
+	if m := CollectValues(tc.All()); len(m) != 2 || m["a"] != 1 || m["b"] != 2 {
+		t.Error("unexpected items:", m)
+	}
+	n := 0
+	for k := range tc.Keys() {
+		tc.Delete(k)
+		n++
+		break
+	}
+	if n != 1 || tc.ItemCount() != 2 {
+		t.Error("iteration didn't stop or delete failed:", n, tc.ItemCount())
+	}
+	if keys := CollectKeys(New(DefaultExpiration, 0).Keys()); keys == nil || len(keys) != 0 {
+		t.Error("unexpected keys of empty cache:", keys)
+	}
+}
+
+func TestShardedIterators(t *testing.T) {
+	tc := unexportedNewSharded(DefaultExpiration, 0, 4)
+	for _, k := range []string{"a", "b", "c", "d", "e"} {
+		tc.Set(k, k, DefaultExpiration)
+	}
+	if keys := CollectKeys(tc.Keys()); !slices.Equal(keys, []string{"a", "b", "c", "d", "e"}) {
+		t.Error("unexpected keys:", keys)
+	}
+	if m := Collect(tc.All()); len(m) != 5 || m["c"].Object != "c" {
+		t.Error("unexpected items:", m)
+	}
+	n := 0
+	for range tc.Values() {
+		if n++; n == 2 {
+			break
+		}
+	}
+	if n != 2 {
+		t.Error("iteration didn't stop:", n)
+	}
+}
@@ -0,0 +1,179 @@
+package cache
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+)
+
+var (
+	// ErrLocked Returned by TryLock if the key is locked by another lease.
+	ErrLocked = errors.New("key is locked")
+	// ErrLeaseLost Returned by Lease methods if the lease has expired, or
+	// its key was deleted or replaced.
+	ErrLeaseLost = errors.New("lease lost")
+)
+
+// Lease An exclusive lock of a key, stored as the value of the key until it
+// is released or expires, see Lock. A lease encoded with the items of the
+// cache, e.g. by Save or for a follower, is decoded as a lease which keeps
+// the key locked until it expires, but which can't be refreshed or released.
+type Lease struct {
+	c   *cache
+	key string
+}
+
+// Key Returns the locked key.
+func (l *Lease) Key() string {
+	return l.key
+}
+
+// GobEncode Encodes the key of the lease with Gob.
+func (l *Lease) GobEncode() ([]byte, error) {
+	return []byte(l.key), nil
+}
+
+// GobDecode Decodes the lease encoded by GobEncode, which doesn't belong to
+// any cache.
+func (l *Lease) GobDecode(data []byte) error {
+	*l = Lease{key: string(data)}
+	return nil
+}
+
+// Refresh Sets a new expiration for the lease, interpreted the same as by
+// Set. Returns ErrLeaseLost if the lease doesn't hold the key anymore.
+func (l *Lease) Refresh(ttl time.Duration) error {
+	if l.c == nil {
+		return ErrLeaseLost
+	}
+	mu, err := l.c.lockWritable(l.key)
+	if err != nil {
+		return err
+	}
+	defer mu.Unlock()
+	v, found := l.c.getItem(l.key)
+	if !found || v.expired(l.c.timeCache.Load()) || v.Object != l {
+		return ErrLeaseLost
+	}
+	l.c.store(opSet, l.key, l.c.newItem(l, ttl))
+	return nil
+}
+
+// Release Unlocks the key by deleting it, waking up a blocked Lock of the
+// key. Returns ErrLeaseLost if the lease doesn't hold the key anymore, in
+// which case the key isn't changed.
+func (l *Lease) Release() error {
+	if l.c == nil {
+		return ErrLeaseLost
+	}
+	if err := l.c.writable(); err != nil {
+		return err
+	}
+	now := l.c.timeCache.Load()
+	v, found := l.c.deleteIf(l.key, func(item Item) bool {
+		return item.Object == l && !item.expired(now)
+	})
+	if !found {
+		return ErrLeaseLost
+	}
+	l.c.evicted(l.key, v)
+	return nil
+}
+
+// tryLock stores a new lease of k if the key doesn't exist or has expired,
+// and returns it. Otherwise it returns nil and the expiration of the item
+// holding the key.
+func (c *cache) tryLock(k string, ttl time.Duration) (*Lease, int64, error) {
+	mu, err := c.lockWritable(k)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer mu.Unlock()
+	if v, found := c.getItem(k); found && !v.expired(c.timeCache.Load()) {
+		if _, ok := v.Object.(*Lease); !ok {
+			return nil, 0, ErrInvalidType
+		}
+		return nil, v.Expiration, nil
+	}
+	l := &Lease{c: c, key: k}
+	c.store(opSet, k, c.newItem(l, ttl))
+	return l, 0, nil
+}
+
+// TryLock Locks the key with a new lease expiring after ttl, interpreted the
+// same as by Set, if the key doesn't exist. Returns ErrLocked if the key is
+// locked by another lease, and ErrInvalidType if it holds another value.
+func (c *cache) TryLock(k string, ttl time.Duration) (*Lease, error) {
+	l, _, err := c.tryLock(k, ttl)
+	if l == nil && err == nil {
+		err = ErrLocked
+	}
+	return l, err
+}
+
+// Lock Same as TryLock, but if the key is locked, waits until the lease is
+// released, deleted or expires, and tries again. Returns the error of ctx
+// if it is done first.
+func (c *cache) Lock(ctx context.Context, k string, ttl time.Duration) (*Lease, error) {
+	w := c.initKeyObservers()
+	var rechecked bool
+	for {
+		// The observer is added before trying, so a release in between
+		// isn't missed.
+		released := make(chan struct{})
+		var once sync.Once
+		cancel := w.add(k, func(m mutation) {
+			if m.op == opDelete || m.op == opExpire || m.op == opFlush {
+				once.Do(func() {
+					close(released)
+				})
+			}
+		})
+		l, exp, err := c.tryLock(k, ttl)
+		if l != nil || err != nil {
+			cancel()
+			return l, err
+		}
+		var t *time.Timer
+		var expired <-chan time.Time
+		if exp > 0 {
+			// The item expires once the clock of the cache, updated
+			// every tick, passes exp. If it should have already, the
+			// lease is checked once more, and then only waited for to
+			// be released: the clock is stopped.
+			switch d := time.Until(time.Unix(0, exp)) + c.clockTick; {
+			case d > 0:
+				t = time.NewTimer(d)
+				expired = t.C
+			case !rechecked:
+				rechecked = true
+				cancel()
+				continue
+			}
+		}
+		select {
+		case <-released:
+		case <-expired:
+		case <-ctx.Done():
+			err = ctx.Err()
+		}
+		cancel()
+		if t != nil {
+			t.Stop()
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+}
+
+// TryLock Same as cache.TryLock.
+func (sc *shardedCache) TryLock(k string, ttl time.Duration) (*Lease, error) {
+	return sc.bucket(k).TryLock(k, ttl)
+}
+
+// Lock Same as cache.Lock.
+func (sc *shardedCache) Lock(ctx context.Context, k string, ttl time.Duration) (*Lease, error) {
+	return sc.bucket(k).Lock(ctx, k, ttl)
+}
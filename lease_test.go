@@ -0,0 +1,195 @@
+package cache
+
+import (
+	"bytes"
+	"context"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestTryLock(t *testing.T) {
+	tc := New(DefaultExpiration, 0)
+	defer tc.Close()
+	l, err := tc.TryLock("k", time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if l.Key() != "k" {
+		t.Error("unexpected key:", l.Key())
+	}
+	if _, err := tc.TryLock("k", time.Minute); err != ErrLocked {
+		t.Error("unexpected error for a locked key:", err)
+	}
+	if err := l.Refresh(time.Hour); err != nil {
+		t.Error("unexpected Refresh error:", err)
+	}
+	if _, ttl, _ := tc.GetWithRemainingTTL("k"); ttl <= time.Minute {
+		t.Error("lease was not refreshed:", ttl)
+	}
+	if err := l.Release(); err != nil {
+		t.Error("unexpected Release error:", err)
+	}
+	if err := l.Release(); err != ErrLeaseLost {
+		t.Error("unexpected error for a released lease:", err)
+	}
+	l2, err := tc.TryLock("k", time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := l.Refresh(time.Minute); err != ErrLeaseLost {
+		t.Error("stale lease was refreshed:", err)
+	}
+	if err := l.Release(); err != ErrLeaseLost {
+		t.Error("stale lease released the key:", err)
+	}
+	if x, _ := tc.Get("k"); x != l2 {
+		t.Error("lease was replaced:", x)
+	}
+	tc.Set("x", 1, DefaultExpiration)
+	if _, err := tc.TryLock("x", time.Minute); err != ErrInvalidType {
+		t.Error("unexpected error for another value:", err)
+	}
+}
+
+func TestLockExpiredLease(t *testing.T) {
+	tc := New(DefaultExpiration, 0)
+	defer tc.Close()
+	l, _ := tc.TryLock("k", time.Millisecond)
+	tc.timeCache.Add(int64(10 * time.Millisecond))
+	if err := l.Refresh(time.Minute); err != ErrLeaseLost {
+		t.Error("expired lease was refreshed:", err)
+	}
+	if _, err := tc.TryLock("k", time.Minute); err != nil {
+		t.Error("expired lease still holds the key:", err)
+	}
+}
+
+func TestLockWaitsForRelease(t *testing.T) {
+	tc := New(DefaultExpiration, 0)
+	defer tc.Close()
+	l, _ := tc.TryLock("k", NoExpiration)
+	acquired := make(chan *Lease)
+	go func() {
+		l, err := tc.Lock(context.Background(), "k", NoExpiration)
+		if err != nil {
+			t.Error(err)
+		}
+		acquired <- l
+	}()
+	select {
+	case <-acquired:
+		t.Fatal("Lock returned while the key is locked")
+	case <-time.After(20 * time.Millisecond):
+	}
+	l.Release()
+	select {
+	case l2 := <-acquired:
+		if l2 == nil || l2 == l {
+			t.Error("unexpected lease:", l2)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("Lock was not woken up by Release")
+	}
+}
+
+func TestLockWaitsForExpiration(t *testing.T) {
+	tc := New(DefaultExpiration, 0, true)
+	defer tc.Close()
+	tc.TryLock("k", 30*time.Millisecond)
+	start := time.Now()
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	if _, err := tc.Lock(ctx, "k", time.Minute); err != nil {
+		t.Fatal(err)
+	}
+	if d := time.Since(start); d < 25*time.Millisecond {
+		t.Error("lock was acquired before the lease expired:", d)
+	}
+}
+
+func TestShardedLockWaitsForExpiration(t *testing.T) {
+	tc := unexportedNewSharded(DefaultExpiration, 0, 4)
+	tc.TryLock("k", 10*time.Millisecond)
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+	if _, err := tc.Lock(ctx, "k", time.Minute); err != nil {
+		t.Fatal("lease of a sharded cache didn't expire:", err)
+	}
+}
+
+func TestLockContext(t *testing.T) {
+	tc := New(DefaultExpiration, 0)
+	defer tc.Close()
+	tc.TryLock("k", NoExpiration)
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if _, err := tc.Lock(ctx, "k", NoExpiration); err != context.DeadlineExceeded {
+		t.Error("unexpected error:", err)
+	}
+	if n := tc.keyObservers.Load().n.Load(); n != 0 {
+		t.Error("observer was not removed:", n)
+	}
+}
+
+func TestLockMutualExclusion(t *testing.T) {
+	tc := New(DefaultExpiration, 0)
+	defer tc.Close()
+	var wg sync.WaitGroup
+	var held, total int
+	for range 8 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for range 50 {
+				l, err := tc.Lock(context.Background(), "k", NoExpiration)
+				if err != nil {
+					t.Error(err)
+					return
+				}
+				held++
+				if held != 1 {
+					t.Error("lock held by several goroutines")
+				}
+				total++
+				held--
+				l.Release()
+			}
+		}()
+	}
+	wg.Wait()
+	if total != 400 {
+		t.Error("unexpected number of locks:", total)
+	}
+}
+
+func TestSaveLease(t *testing.T) {
+	tc := New(DefaultExpiration, 0)
+	defer tc.Close()
+	l, err := tc.TryLock("k", time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var buf bytes.Buffer
+	if err := tc.Save(&buf); err != nil {
+		t.Fatal("Couldn't save a cache holding a lease:", err)
+	}
+	oc := New(DefaultExpiration, 0)
+	defer oc.Close()
+	if err := oc.Load(&buf); err != nil {
+		t.Fatal(err)
+	}
+	x, _ := oc.Get("k")
+	if ol, ok := x.(*Lease); !ok || ol.Key() != "k" {
+		t.Fatal("unexpected loaded lease:", x)
+	}
+	if _, err := oc.TryLock("k", time.Minute); err != ErrLocked {
+		t.Error("loaded lease doesn't lock the key:", err)
+	}
+	if err := x.(*Lease).Release(); err != ErrLeaseLost {
+		t.Error("loaded lease was released:", err)
+	}
+	if err := l.Release(); err != nil {
+		t.Error("unexpected Release error:", err)
+	}
+}
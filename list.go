@@ -0,0 +1,304 @@
+package cache
+
+import (
+	"bytes"
+	"encoding/gob"
+	"encoding/json"
+	"iter"
+	"slices"
+	"sync"
+)
+
+// List A list value stored by LPush and RPush. A List is an immutable
+// snapshot: list operations store a new List, so a List returned by Get can
+// be read while other goroutines change the list.
+type List struct {
+	buf        *listBuf
+	start, end int
+}
+
+// listBuf is the storage shared by the versions of a list. Elements of data
+// in [lo, hi) may be visible to some version, and are never written again;
+// new elements are only written outside of it, so versions never see each
+// other's changes. mu guards lo and hi, since a List may be stored under
+// several keys.
+type listBuf struct {
+	mu     sync.Mutex
+	data   []any
+	lo, hi int
+}
+
+// NewList Returns a list of the elements.
+func NewList(elems ...any) List {
+	var l List
+	return l.pushBack(elems)
+}
+
+// Len Returns the number of elements of the list.
+func (l List) Len() int {
+	return l.end - l.start
+}
+
+// Index Returns the element at index i, which must be in [0, Len()).
+func (l List) Index(i int) any {
+	if i < 0 || i >= l.Len() {
+		panic("cache: list index out of range")
+	}
+	return l.buf.data[l.start+i]
+}
+
+// All Returns an iterator over the indexes and elements of the list.
+func (l List) All() iter.Seq2[int, any] {
+	return func(yield func(int, any) bool) {
+		for i := 0; i < l.Len(); i++ {
+			if !yield(i, l.buf.data[l.start+i]) {
+				return
+			}
+		}
+	}
+}
+
+// Slice Returns a copy of the elements of the list.
+func (l List) Slice() []any {
+	if l.Len() == 0 {
+		return []any{}
+	}
+	return slices.Clone(l.buf.data[l.start:l.end])
+}
+
+// grow returns a copy of l in a new buffer with room for front elements
+// before and back elements after the current ones.
+func (l List) grow(front, back int) List {
+	n := l.Len()
+	frontRoom, backRoom := max(front, n/2, 4), max(back, n/2, 4)
+	data := make([]any, frontRoom+n+backRoom)
+	if n > 0 {
+		copy(data[frontRoom:], l.buf.data[l.start:l.end])
+	}
+	return List{
+		buf:   &listBuf{data: data, lo: frontRoom, hi: frontRoom + n},
+		start: frontRoom,
+		end:   frontRoom + n,
+	}
+}
+
+// pushBack returns l with elems appended.
+func (l List) pushBack(elems []any) List {
+	if l.buf != nil {
+		l.buf.mu.Lock()
+		defer l.buf.mu.Unlock()
+	}
+	if l.buf == nil || l.end != l.buf.hi || l.end+len(elems) > len(l.buf.data) {
+		l = l.grow(0, len(elems))
+	}
+	copy(l.buf.data[l.end:], elems)
+	l.end += len(elems)
+	l.buf.hi = l.end
+	return l
+}
+
+// pushFront returns l with elems prepended one by one, so the last one
+// becomes the first element.
+func (l List) pushFront(elems []any) List {
+	if l.buf != nil {
+		l.buf.mu.Lock()
+		defer l.buf.mu.Unlock()
+	}
+	if l.buf == nil || l.start != l.buf.lo || l.start < len(elems) {
+		l = l.grow(len(elems), 0)
+	}
+	for _, x := range elems {
+		l.start--
+		l.buf.data[l.start] = x
+	}
+	l.buf.lo = l.start
+	return l
+}
+
+// listRange converts Redis-style inclusive start and stop indexes, which
+// count from the end if negative, into a range of [0, n).
+func listRange(start, stop, n int) (int, int) {
+	if start < 0 {
+		start = max(n+start, 0)
+	}
+	if stop < 0 {
+		stop = n + stop
+	}
+	stop = min(stop+1, n)
+	if start >= stop {
+		return 0, 0
+	}
+	return start, stop
+}
+
+// sub returns the elements of l in [i, j).
+func (l List) sub(i, j int) List {
+	if i == j {
+		return List{}
+	}
+	return List{buf: l.buf, start: l.start + i, end: l.start + j}
+}
+
+// GobEncode Encodes the elements of the list with Gob.
+func (l List) GobEncode() ([]byte, error) {
+	var buf bytes.Buffer
+	elems := l.Slice()
+	for _, x := range elems {
+		if err := gobRegister(x); err != nil {
+			return nil, err
+		}
+	}
+	if err := gob.NewEncoder(&buf).Encode(elems); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// GobDecode Decodes the list encoded by GobEncode.
+func (l *List) GobDecode(data []byte) error {
+	var elems []any
+	if err := gob.NewDecoder(bytes.NewReader(data)).Decode(&elems); err != nil {
+		return err
+	}
+	*l = NewList(elems...)
+	return nil
+}
+
+// MarshalJSON Encodes the list as a JSON array.
+func (l List) MarshalJSON() ([]byte, error) {
+	return json.Marshal(l.Slice())
+}
+
+// UnmarshalJSON Decodes the list from a JSON array.
+func (l *List) UnmarshalJSON(data []byte) error {
+	var elems []any
+	if err := json.Unmarshal(data, &elems); err != nil {
+		return err
+	}
+	*l = NewList(elems...)
+	return nil
+}
+
+// modifyList replaces the list of k with the result of f, see modifyValue.
+// If create is true, f is called with an empty list if the key doesn't
+// exist. The key is deleted if the result is empty.
+func (c *cache) modifyList(k string, create bool, f func(List) (List, error)) error {
+	var newList func() any
+	if create {
+		newList = func() any {
+			return List{}
+		}
+	}
+	return c.modifyValue(k, newList, func(x any) (any, error) {
+		l, ok := x.(List)
+		if !ok {
+			return nil, ErrInvalidType
+		}
+		l, err := f(l)
+		if err != nil || l.Len() == 0 {
+			return nil, err
+		}
+		return l, nil
+	})
+}
+
+// getList returns the list of k, an empty list if the key doesn't exist, or
+// ErrInvalidType if its value isn't a List.
+func (c *cache) getList(k string) (List, error) {
+	x, found := c.get(k)
+	if !found {
+		return List{}, nil
+	}
+	l, ok := x.(List)
+	if !ok {
+		return List{}, ErrInvalidType
+	}
+	return l, nil
+}
+
+// LPush Inserts the elements at the head of the list of k one by one, so
+// the last element becomes the first one, and returns the new length of the
+// list. A new list with the default expiration is created if the key doesn't
+// exist, otherwise the expiration is kept. Returns ErrInvalidType if the value
+// of k isn't a List.
+func (c *cache) LPush(k string, elems ...any) (int, error) {
+	var n int
+	err := c.modifyList(k, true, func(l List) (List, error) {
+		l = l.pushFront(elems)
+		n = l.Len()
+		return l, nil
+	})
+	return n, err
+}
+
+// RPush Same as LPush, but appends the elements at the tail of the list.
+func (c *cache) RPush(k string, elems ...any) (int, error) {
+	var n int
+	err := c.modifyList(k, true, func(l List) (List, error) {
+		l = l.pushBack(elems)
+		n = l.Len()
+		return l, nil
+	})
+	return n, err
+}
+
+// LPop Removes and returns the first element of the list of k. The key is
+// deleted when its last element is removed. Returns ErrNotExists if the key
+// doesn't exist and ErrInvalidType if its value isn't a List.
+func (c *cache) LPop(k string) (any, error) {
+	var x any
+	err := c.modifyList(k, false, func(l List) (List, error) {
+		if l.Len() == 0 {
+			return l, ErrNotExists
+		}
+		x = l.Index(0)
+		return l.sub(1, l.Len()), nil
+	})
+	return x, err
+}
+
+// RPop Same as LPop, but removes and returns the last element of the list.
+func (c *cache) RPop(k string) (any, error) {
+	var x any
+	err := c.modifyList(k, false, func(l List) (List, error) {
+		n := l.Len()
+		if n == 0 {
+			return l, ErrNotExists
+		}
+		x = l.Index(n - 1)
+		return l.sub(0, n-1), nil
+	})
+	return x, err
+}
+
+// LRange Returns the elements of the list of k from start to stop, both
+// inclusive. Negative indexes count from the end of the list: -1 is the last
+// element. An empty slice is returned if the key doesn't exist, or
+// ErrInvalidType if its value isn't a List.
+func (c *cache) LRange(k string, start, stop int) ([]any, error) {
+	l, err := c.getList(k)
+	if err != nil {
+		return nil, err
+	}
+	return l.sub(listRange(start, stop, l.Len())).Slice(), nil
+}
+
+// LTrim Removes the elements of the list of k outside of start and stop,
+// interpreted as by LRange. The key is deleted if no element remains. Returns
+// ErrInvalidType if the value of k isn't a List.
+func (c *cache) LTrim(k string, start, stop int) error {
+	err := c.modifyList(k, false, func(l List) (List, error) {
+		return l.sub(listRange(start, stop, l.Len())), nil
+	})
+	if err == ErrNotExists {
+		return nil
+	}
+	return err
+}
+
+// LLen Returns the length of the list of k, zero if the key doesn't exist.
+// Returns ErrInvalidType if the value of k isn't a List.
+func (c *cache) LLen(k string) (int, error) {
+	l, err := c.getList(k)
+	return l.Len(), err
+}
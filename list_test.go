@@ -0,0 +1,143 @@
+package cache
+
+import (
+	"bytes"
+	"encoding/json"
+	"slices"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestList(t *testing.T) {
+	tc := New(DefaultExpiration, 0)
+	defer tc.Close()
+	if n, err := tc.RPush("l", "b", "c"); n != 2 || err != nil {
+		t.Fatal(n, err)
+	}
+	if n, err := tc.LPush("l", "a", "z"); n != 4 || err != nil {
+		t.Fatal(n, err)
+	}
+	if elems, _ := tc.LRange("l", 0, -1); !slices.Equal(elems, []any{"z", "a", "b", "c"}) {
+		t.Error("unexpected list:", elems)
+	}
+	if elems, _ := tc.LRange("l", -3, 1); !slices.Equal(elems, []any{"a"}) {
+		t.Error("unexpected range:", elems)
+	}
+	if elems, _ := tc.LRange("l", 5, 10); len(elems) != 0 {
+		t.Error("unexpected out of range elements:", elems)
+	}
+	x, _ := tc.Get("l")
+	snapshot := x.(List)
+	if x, err := tc.LPop("l"); x != "z" || err != nil {
+		t.Error("unexpected LPop result:", x, err)
+	}
+	if x, err := tc.RPop("l"); x != "c" || err != nil {
+		t.Error("unexpected RPop result:", x, err)
+	}
+	if _, err := tc.RPush("l", "d"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := tc.LPush("l", "y"); err != nil {
+		t.Fatal(err)
+	}
+	if !slices.Equal(snapshot.Slice(), []any{"z", "a", "b", "c"}) {
+		t.Error("snapshot was changed:", snapshot.Slice())
+	}
+	if elems, _ := tc.LRange("l", 0, -1); !slices.Equal(elems, []any{"y", "a", "b", "d"}) {
+		t.Error("unexpected list:", elems)
+	}
+	if err := tc.LTrim("l", 1, 2); err != nil {
+		t.Fatal(err)
+	}
+	if n, _ := tc.LLen("l"); n != 2 {
+		t.Error("unexpected length after LTrim:", n)
+	}
+	tc.LPop("l")
+	tc.LPop("l")
+	if _, found := tc.Get("l"); found {
+		t.Error("empty list was not deleted")
+	}
+	if _, err := tc.LPop("l"); err != ErrNotExists {
+		t.Error("unexpected LPop error:", err)
+	}
+	if n, err := tc.LLen("l"); n != 0 || err != nil {
+		t.Error("unexpected LLen of missing key:", n, err)
+	}
+	tc.Set("s", "x", DefaultExpiration)
+	if _, err := tc.LPush("s", 1); err != ErrInvalidType {
+		t.Error("unexpected LPush error:", err)
+	}
+	if _, err := tc.LRange("s", 0, -1); err != ErrInvalidType {
+		t.Error("unexpected LRange error:", err)
+	}
+}
+
+func TestListTTL(t *testing.T) {
+	tc := New(DefaultExpiration, 0, true)
+	defer tc.Close()
+	tc.Set("l", NewList(1), 5*time.Millisecond)
+	if _, err := tc.RPush("l", 2); err != nil {
+		t.Fatal(err)
+	}
+	if _, ttl, _ := tc.GetWithRemainingTTL("l"); ttl <= 0 || ttl > 5*time.Millisecond {
+		t.Error("expiration was not kept:", ttl)
+	}
+	<-time.After(10 * time.Millisecond)
+	if n, _ := tc.LLen("l"); n != 0 {
+		t.Error("list has not expired:", n)
+	}
+	if n, _ := tc.RPush("l", 3); n != 1 {
+		t.Error("expired list was not replaced:", n)
+	}
+}
+
+func TestListConcurrent(t *testing.T) {
+	tc := New(DefaultExpiration, 0)
+	defer tc.Close()
+	var wg sync.WaitGroup
+	for w := 0; w < 4; w++ {
+		wg.Add(2)
+		go func() {
+			defer wg.Done()
+			for i := 0; i < 500; i++ {
+				tc.RPush("q", i)
+				tc.LPush("q", i)
+			}
+		}()
+		go func() {
+			defer wg.Done()
+			for i := 0; i < 500; i++ {
+				tc.LPop("q")
+				if x, found := tc.Get("q"); found {
+					l := x.(List)
+					for range l.All() {
+					}
+				}
+			}
+		}()
+	}
+	wg.Wait()
+}
+
+func TestListEncoding(t *testing.T) {
+	tc := New(DefaultExpiration, 0)
+	defer tc.Close()
+	tc.RPush("l", "a", 1)
+	var buf bytes.Buffer
+	if err := tc.Save(&buf); err != nil {
+		t.Fatal(err)
+	}
+	tc2 := New(DefaultExpiration, 0)
+	defer tc2.Close()
+	if err := tc2.Load(&buf); err != nil {
+		t.Fatal(err)
+	}
+	if elems, err := tc2.LRange("l", 0, -1); err != nil || !slices.Equal(elems, []any{"a", 1}) {
+		t.Error("unexpected loaded list:", elems, err)
+	}
+	b, err := json.Marshal(NewList("a", 1))
+	if err != nil || string(b) != `["a",1]` {
+		t.Error("unexpected JSON:", string(b), err)
+	}
+}
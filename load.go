@@ -0,0 +1,118 @@
+package cache
+
+import (
+	"bufio"
+	"encoding/gob"
+	"io"
+	"math"
+	"os"
+)
+
+// MergePolicy Defines what happens when a loaded item has the same key as
+// an unexpired item of the cache.
+type MergePolicy uint8
+
+const (
+	// MergeKeepExisting keeps the item of the cache.
+	MergeKeepExisting MergePolicy = iota
+	// MergeOverwrite replaces the item of the cache with the loaded one.
+	MergeOverwrite
+	// MergeKeepLater keeps the item which expires later. An item without
+	// expiration is considered to expire later than any other.
+	MergeKeepLater
+)
+
+// ExpiryMode Defines how expiration times of loaded items are interpreted.
+type ExpiryMode uint8
+
+const (
+	// ExpiryAbsolute keeps expiration times as saved, so the items expire at
+	// the same wall clock time as they would in the saved cache.
+	ExpiryAbsolute ExpiryMode = iota
+	// ExpiryRemaining treats the time left until expiration at the moment
+	// of save as the TTL of the loaded item, counted from the moment of load.
+	// Data saved by previous versions has no save time, so its expiration
+	// times are kept as saved.
+	ExpiryRemaining
+)
+
+// LoadOptions Options of LoadWithOptions. The zero value loads items the
+// same way as Load.
+type LoadOptions struct {
+	// Merge policy for keys which exist in the cache.
+	Merge MergePolicy
+	// Expiry defines the meaning of saved expiration times.
+	Expiry ExpiryMode
+	// DropExpired skips loaded items which are expired (after Expiry is
+	// applied) instead of adding them to be cleaned up by the janitor.
+	DropExpired bool
+	// Notify reports every loaded item to the OnEvent function with
+	// EventLoad.
+	Notify bool
+}
+
+// LoadWithOptions Adds cache items saved by Save from an io.Reader, merging
+// them with the items of the cache as defined by opts.
+func (c *cache) LoadWithOptions(r io.Reader, opts LoadOptions) error {
+	if err := c.writable(); err != nil {
+		return err
+	}
+	now := c.timeCache.Load()
+	var savedAt int64 // unknown for the legacy format
+	add := func(k string, v Item) {
+		if opts.Expiry == ExpiryRemaining && savedAt > 0 && v.Expiration > 0 {
+			v.Expiration += now - savedAt
+		}
+		if opts.DropExpired && v.expired(now) {
+			return
+		}
+		mu := c.lock(k)
+		defer mu.Unlock()
+		if ov, found := c.getItem(k); found && !ov.expired(now) {
+			switch opts.Merge {
+			case MergeKeepExisting:
+				return
+			case MergeKeepLater:
+				if expiresAt(ov) >= expiresAt(v) {
+					return
+				}
+			}
+		}
+		c.items.Store(k, v)
+		c.emit(mutation{op: opLoad, key: k, item: v, silent: !opts.Notify})
+	}
+	br := bufio.NewReader(r)
+	if isSnapshot(br) {
+		var err error
+		if savedAt, err = readSnapshotHeader(br); err != nil {
+			return err
+		}
+		return c.readSnapshotItems(br, add)
+	}
+	items := map[string]Item{}
+	err := gob.NewDecoder(br).Decode(&items)
+	if err == nil {
+		for k, v := range items {
+			add(k, v)
+		}
+	}
+	return err
+}
+
+// LoadFileWithOptions Same as LoadWithOptions, but loads items from the
+// given filename.
+func (c *cache) LoadFileWithOptions(fname string, opts LoadOptions) error {
+	fp, err := os.Open(fname)
+	if err != nil {
+		return err
+	}
+	defer fp.Close()
+	return c.LoadWithOptions(fp, opts)
+}
+
+func expiresAt(item Item) int64 {
+	if item.Expiration <= 0 {
+		return math.MaxInt64
+	}
+	return item.Expiration
+}
@@ -0,0 +1,83 @@
+package cache
+
+import (
+	"bytes"
+	"testing"
+	"time"
+)
+
+func saveItems(t *testing.T, items map[string]Item, savedAt int64) *bytes.Buffer {
+	t.Helper()
+	tc := NewFrom(DefaultExpiration, 0, items)
+	tc.timeCache.Store(savedAt)
+	buf := &bytes.Buffer{}
+	if err := tc.Save(buf); err != nil {
+		t.Fatal("Couldn't save cache:", err)
+	}
+	return buf
+}
+
+func TestLoadMergePolicies(t *testing.T) {
+	now := time.Now().UnixNano()
+	saved := map[string]Item{
+		"a": {Object: "saved", Expiration: now + int64(time.Hour)},
+		"b": {Object: "saved", Expiration: now + int64(time.Minute)},
+		"c": {Object: "saved"},
+	}
+	for _, tt := range []struct {
+		merge MergePolicy
+		want  map[string]string
+	}{
+		{MergeKeepExisting, map[string]string{"a": "existing", "b": "existing", "c": "existing"}},
+		{MergeOverwrite, map[string]string{"a": "saved", "b": "saved", "c": "saved"}},
+		{MergeKeepLater, map[string]string{"a": "saved", "b": "existing", "c": "saved"}},
+	} {
+		tc := New(DefaultExpiration, 0)
+		tc.Set("a", "existing", 10*time.Minute)
+		tc.Set("b", "existing", 10*time.Minute)
+		tc.Set("c", "existing", 10*time.Minute)
+		err := tc.LoadWithOptions(saveItems(t, saved, now), LoadOptions{Merge: tt.merge})
+		if err != nil {
+			t.Fatal("Couldn't load cache:", err)
+		}
+		for k, want := range tt.want {
+			if v, _ := tc.Get(k); v != want {
+				t.Errorf("policy %d: %s is %v, expected %s", tt.merge, k, v, want)
+			}
+		}
+	}
+}
+
+func TestLoadRemainingTTL(t *testing.T) {
+	savedAt := time.Now().Add(-2 * time.Hour).UnixNano()
+	buf := saveItems(t, map[string]Item{
+		"a": {Object: "a", Expiration: savedAt + int64(time.Hour)},
+		"b": {Object: "b", Expiration: savedAt - 1},
+	}, savedAt)
+	tc := New(DefaultExpiration, 0)
+	var events []Event
+	tc.OnEvent(func(e Event) {
+		events = append(events, e)
+	})
+	err := tc.LoadWithOptions(buf, LoadOptions{
+		Expiry:      ExpiryRemaining,
+		DropExpired: true,
+		Notify:      true,
+	})
+	if err != nil {
+		t.Fatal("Couldn't load cache:", err)
+	}
+	_, ttl, found := tc.GetWithRemainingTTL("a")
+	if !found {
+		t.Fatal("a was not found")
+	}
+	if ttl < 59*time.Minute || ttl > time.Hour {
+		t.Error("a has unexpected TTL:", ttl)
+	}
+	if tc.ItemCount() != 1 {
+		t.Error("expired item was not dropped")
+	}
+	if len(events) != 1 || events[0].Type != EventLoad || events[0].Key != "a" {
+		t.Error("unexpected events:", events)
+	}
+}
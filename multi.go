@@ -0,0 +1,175 @@
+package cache
+
+import (
+	"maps"
+	"slices"
+	"time"
+)
+
+// byStripe groups keys by the mutex guarding them, so each mutex is locked
+// once per batch.
+func byStripe(m map[string]any) map[uint32][]string {
+	groups := make(map[uint32][]string)
+	for k := range m {
+		i := stripe(k)
+		groups[i] = append(groups[i], k)
+	}
+	return groups
+}
+
+// GetMulti Returns the values of the unexpired items with the keys. Missing
+// keys are absent from the result.
+func (c *cache) GetMulti(keys []string) map[string]any {
+	m := make(map[string]any, len(keys))
+	now := c.timeCache.Load()
+	for _, k := range keys {
+		if v, found := c.getItem(k); c.stats.lookup(found && !v.expired(now)) {
+			m[k] = v.Object
+		}
+	}
+	return m
+}
+
+// SetMulti Adds the items to the cache, replacing any existing items, as if
+// by Set with the duration d.
+func (c *cache) SetMulti(items map[string]any, d time.Duration) {
+	for i, keys := range byStripe(items) {
+		c.checkWritable()
+		mu := &c.locks[i]
+		mu.Lock()
+		for _, k := range keys {
+			c.store(opSet, k, c.newItem(items[k], d))
+		}
+		mu.Unlock()
+	}
+}
+
+// AddMulti Adds the items to the cache, as if by Add with the duration d.
+// Items with keys which already exist (and haven't expired) aren't added,
+// their keys are returned, sorted.
+func (c *cache) AddMulti(items map[string]any, d time.Duration) []string {
+	var existing []string
+	for i, keys := range byStripe(items) {
+		c.checkWritable()
+		mu := &c.locks[i]
+		mu.Lock()
+		for _, k := range keys {
+			if _, found := c.get(k); found {
+				existing = append(existing, k)
+				continue
+			}
+			c.store(opSet, k, c.newItem(items[k], d))
+		}
+		mu.Unlock()
+	}
+	slices.Sort(existing)
+	return existing
+}
+
+// DeleteMulti Deletes the items with the keys, as if by Delete, and returns
+// the number of deleted items.
+func (c *cache) DeleteMulti(keys []string) int {
+	return c.deleteAll(slices.Values(keys), nil)
+}
+
+// GetMultiOrLoad Same as GetMulti, but the keys which are missing are passed
+// to load, and the loaded values are stored with the duration d and returned
+// along with the cached ones. load is called at most once, and not at all if
+// every key is cached. If load fails, the cached values are returned with its
+// error. If keys are missing from a cache which follows a leader, load isn't
+// called and ErrReadOnly is returned.
+func (c *cache) GetMultiOrLoad(keys []string, d time.Duration, load func(missing []string) (map[string]any, error)) (map[string]any, error) {
+	m := c.GetMulti(keys)
+	return m, loadMissing(keys, m, func(missing []string) (map[string]any, error) {
+		if err := c.writable(); err != nil {
+			return nil, err
+		}
+		return load(missing)
+	}, func(loaded map[string]any) {
+		c.SetMulti(loaded, d)
+	})
+}
+
+// loadMissing calls load for the keys absent in m, stores the loaded values
+// with set and adds them to m.
+func loadMissing(keys []string, m map[string]any, load func([]string) (map[string]any, error), set func(map[string]any)) error {
+	var missing []string
+	for _, k := range keys {
+		if _, found := m[k]; !found {
+			missing = append(missing, k)
+		}
+	}
+	if len(missing) == 0 {
+		return nil
+	}
+	loaded, err := load(slices.Compact(slices.Sorted(slices.Values(missing))))
+	if err != nil {
+		return err
+	}
+	if len(loaded) > 0 {
+		set(loaded)
+		maps.Copy(m, loaded)
+	}
+	return nil
+}
+
+// byShard groups keys by the shards they belong to.
+func (sc *shardedCache) byShard(keys []string) map[*cache][]string {
+	groups := make(map[*cache][]string)
+	for _, k := range keys {
+		c := sc.bucket(k)
+		groups[c] = append(groups[c], k)
+	}
+	return groups
+}
+
+// GetMulti Same as cache.GetMulti.
+func (sc *shardedCache) GetMulti(keys []string) map[string]any {
+	m := make(map[string]any, len(keys))
+	for c, ks := range sc.byShard(keys) {
+		maps.Copy(m, c.GetMulti(ks))
+	}
+	return m
+}
+
+// SetMulti Same as cache.SetMulti.
+func (sc *shardedCache) SetMulti(items map[string]any, d time.Duration) {
+	for c, ks := range sc.byShard(slices.Collect(maps.Keys(items))) {
+		part := make(map[string]any, len(ks))
+		for _, k := range ks {
+			part[k] = items[k]
+		}
+		c.SetMulti(part, d)
+	}
+}
+
+// AddMulti Same as cache.AddMulti.
+func (sc *shardedCache) AddMulti(items map[string]any, d time.Duration) []string {
+	var existing []string
+	for c, ks := range sc.byShard(slices.Collect(maps.Keys(items))) {
+		part := make(map[string]any, len(ks))
+		for _, k := range ks {
+			part[k] = items[k]
+		}
+		existing = append(existing, c.AddMulti(part, d)...)
+	}
+	slices.Sort(existing)
+	return existing
+}
+
+// DeleteMulti Same as cache.DeleteMulti.
+func (sc *shardedCache) DeleteMulti(keys []string) int {
+	n := 0
+	for c, ks := range sc.byShard(keys) {
+		n += c.DeleteMulti(ks)
+	}
+	return n
+}
+
+// GetMultiOrLoad Same as cache.GetMultiOrLoad.
+func (sc *shardedCache) GetMultiOrLoad(keys []string, d time.Duration, load func(missing []string) (map[string]any, error)) (map[string]any, error) {
+	m := sc.GetMulti(keys)
+	return m, loadMissing(keys, m, load, func(loaded map[string]any) {
+		sc.SetMulti(loaded, d)
+	})
+}
@@ -0,0 +1,91 @@
+package cache
+
+import (
+	"errors"
+	"maps"
+	"slices"
+	"testing"
+)
+
+func TestMulti(t *testing.T) {
+	tc := New(DefaultExpiration, 0)
+	defer tc.Close()
+	tc.SetMulti(map[string]any{"a": 1, "b": 2, "c": 3}, NoExpiration)
+	if m := tc.GetMulti([]string{"a", "c", "missing"}); !maps.Equal(m, map[string]any{"a": 1, "c": 3}) {
+		t.Error("unexpected GetMulti result:", m)
+	}
+	if existing := tc.AddMulti(map[string]any{"a": 10, "d": 4, "b": 20}, NoExpiration); !slices.Equal(existing, []string{"a", "b"}) {
+		t.Error("unexpected AddMulti result:", existing)
+	}
+	if x, _ := tc.Get("a"); x != 1 {
+		t.Error("AddMulti replaced a:", x)
+	}
+	var evicted []string
+	tc.OnEvicted(func(k string, _ any) {
+		evicted = append(evicted, k)
+	})
+	if n := tc.DeleteMulti([]string{"a", "b", "missing"}); n != 2 || len(evicted) != 2 {
+		t.Error("unexpected DeleteMulti result:", n, evicted)
+	}
+	if s := tc.Stats(); s.Hits != 3 || s.Misses != 1 || s.Sets != 4 {
+		t.Errorf("unexpected stats %+v", s)
+	}
+}
+
+func TestGetMultiOrLoad(t *testing.T) {
+	tc := New(DefaultExpiration, 0)
+	defer tc.Close()
+	tc.Set("a", 1, NoExpiration)
+	var calls [][]string
+	load := func(missing []string) (map[string]any, error) {
+		calls = append(calls, missing)
+		m := make(map[string]any)
+		for _, k := range missing {
+			if k != "none" {
+				m[k] = k
+			}
+		}
+		return m, nil
+	}
+	m, err := tc.GetMultiOrLoad([]string{"a", "b", "c", "b", "none"}, NoExpiration, load)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !maps.Equal(m, map[string]any{"a": 1, "b": "b", "c": "c"}) {
+		t.Error("unexpected result:", m)
+	}
+	if len(calls) != 1 || !slices.Equal(calls[0], []string{"b", "c", "none"}) {
+		t.Error("unexpected loader calls:", calls)
+	}
+	if _, err = tc.GetMultiOrLoad([]string{"a", "b"}, NoExpiration, load); err != nil || len(calls) != 1 {
+		t.Error("loader was called for cached keys:", calls, err)
+	}
+	errLoad := errors.New("load failed")
+	m, err = tc.GetMultiOrLoad([]string{"a", "x"}, NoExpiration, func([]string) (map[string]any, error) {
+		return nil, errLoad
+	})
+	if err != errLoad || !maps.Equal(m, map[string]any{"a": 1}) {
+		t.Error("unexpected result of failed load:", m, err)
+	}
+}
+
+func TestShardedMulti(t *testing.T) {
+	tc := unexportedNewSharded(DefaultExpiration, 0, 4)
+	items := map[string]any{"a": 1, "b": 2, "c": 3, "d": 4, "e": 5}
+	tc.SetMulti(items, DefaultExpiration)
+	if m := tc.GetMulti([]string{"a", "b", "c", "d", "e", "f"}); !maps.Equal(m, items) {
+		t.Error("unexpected GetMulti result:", m)
+	}
+	if existing := tc.AddMulti(map[string]any{"a": 0, "e": 0, "f": 6}, DefaultExpiration); !slices.Equal(existing, []string{"a", "e"}) {
+		t.Error("unexpected AddMulti result:", existing)
+	}
+	m, err := tc.GetMultiOrLoad([]string{"f", "g"}, DefaultExpiration, func(missing []string) (map[string]any, error) {
+		return map[string]any{"g": 7}, nil
+	})
+	if err != nil || !maps.Equal(m, map[string]any{"f": 6, "g": 7}) {
+		t.Error("unexpected GetMultiOrLoad result:", m, err)
+	}
+	if n := tc.DeleteMulti([]string{"a", "b", "g", "x"}); n != 3 {
+		t.Error("unexpected DeleteMulti result:", n)
+	}
+}
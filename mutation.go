@@ -0,0 +1,88 @@
+package cache
+
+// mutationOp is the kind of change applied to the cache.
+type mutationOp uint8
+
+const (
+	opSet mutationOp = iota + 1
+	opDelete
+	opIncrement
+	opExpire
+	opFlush
+	opLoad
+)
+
+// stores reports whether the mutation stores its item in the cache.
+func (op mutationOp) stores() bool {
+	return op == opSet || op == opIncrement || op == opLoad
+}
+
+// mutation describes a single change of the cache. For opSet, opIncrement
+// and opLoad item holds the new item, for opDelete and opExpire the removed
+// one. opFlush has neither key nor item. Silent mutations are not reported
+// to the OnEvent function.
+type mutation struct {
+	op     mutationOp
+	key    string
+	item   Item
+	silent bool
+}
+
+// observer receives every mutation of the cache it is attached to. It is
+// called synchronously, while the lock of the mutated key (or all locks for
+// opFlush) is held, so it must not modify the cache.
+type observer struct {
+	f func(mutation)
+}
+
+func (c *cache) emit(m mutation) {
+	if m.op == opFlush {
+		for i := range c.versions {
+			c.versions[i].Add(1)
+		}
+	} else {
+		c.versions[stripe(m.key)].Add(1)
+	}
+	if obs := c.observers.Load(); obs != nil {
+		for _, o := range *obs {
+			o.f(m)
+		}
+	}
+}
+
+func (c *cache) addObserver(f func(mutation)) *observer {
+	o := &observer{f: f}
+	for {
+		old := c.observers.Load()
+		var obs []*observer
+		if old != nil {
+			obs = append(obs, *old...)
+		}
+		obs = append(obs, o)
+		if c.observers.CompareAndSwap(old, &obs) {
+			return o
+		}
+	}
+}
+
+func (c *cache) removeObserver(o *observer) {
+	for {
+		old := c.observers.Load()
+		if old == nil {
+			return
+		}
+		obs := make([]*observer, 0, len(*old))
+		for _, v := range *old {
+			if v != o {
+				obs = append(obs, v)
+			}
+		}
+		var p *[]*observer
+		if len(obs) > 0 {
+			p = &obs
+		}
+		if c.observers.CompareAndSwap(old, p) {
+			return
+		}
+	}
+}
@@ -0,0 +1,268 @@
+package cache
+
+import (
+	"iter"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+// NamespaceSeparator separates the name of a namespace from the keys of its
+// items in the underlying cache.
+const NamespaceSeparator = ":"
+
+// NamespaceOptions Settings of a namespace, see Cache.Namespace.
+type NamespaceOptions struct {
+	// DefaultExpiration is used for items of the namespace stored with
+	// DefaultExpiration. If zero, the default expiration of the cache is
+	// used.
+	DefaultExpiration time.Duration
+	// OnEvicted, if set, is called for evicted items of the namespace, see
+	// Namespace.OnEvicted.
+	OnEvicted func(string, any)
+}
+
+// Namespace A view of a cache which transparently prefixes keys with the
+// namespace name and NamespaceSeparator, so several modules can share one
+// cache, and its janitor, without key collisions. A namespace has its own
+// default expiration, operation counters and OnEvicted function, and can be
+// flushed without touching items of other namespaces.
+type Namespace struct {
+	c                 *cache
+	name, prefix      string
+	defaultExpiration time.Duration
+	onEvicted         atomic.Pointer[func(string, any)]
+	stats             stats
+}
+
+// Namespace Returns the namespace with the name, creating it with opts if it
+// doesn't exist yet, otherwise opts are ignored. Names shouldn't contain
+// NamespaceSeparator, otherwise namespaces may overlap: items of "a:b" are
+// also items of "a".
+func (c *cache) Namespace(name string, opts NamespaceOptions) *Namespace {
+	c.namespacesMu.Lock()
+	defer c.namespacesMu.Unlock()
+	var nss []*Namespace
+	if old := c.namespaces.Load(); old != nil {
+		for _, ns := range *old {
+			if ns.name == name {
+				return ns
+			}
+		}
+		nss = append(nss, *old...)
+	} else {
+		c.addObserver(c.observeNamespaces)
+	}
+	ns := &Namespace{
+		c:                 c,
+		name:              name,
+		prefix:            name + NamespaceSeparator,
+		defaultExpiration: opts.DefaultExpiration,
+	}
+	if opts.OnEvicted != nil {
+		ns.onEvicted.Store(&opts.OnEvicted)
+	}
+	nss = append(nss, ns)
+	c.namespaces.Store(&nss)
+	return ns
+}
+
+// namespaceOf returns the namespace with the longest prefix of k, or nil.
+func (c *cache) namespaceOf(k string) *Namespace {
+	nss := c.namespaces.Load()
+	if nss == nil {
+		return nil
+	}
+	var found *Namespace
+	for _, ns := range *nss {
+		if strings.HasPrefix(k, ns.prefix) && (found == nil || len(ns.prefix) > len(found.prefix)) {
+			found = ns
+		}
+	}
+	return found
+}
+
+// observeNamespaces counts mutations of namespace items.
+func (c *cache) observeNamespaces(m mutation) {
+	if m.op == opFlush || m.op == opLoad {
+		return
+	}
+	ns := c.namespaceOf(m.key)
+	if ns == nil {
+		return
+	}
+	switch m.op {
+	case opSet, opIncrement:
+		ns.stats.sets.Add(1)
+	case opDelete:
+		ns.stats.deletes.Add(1)
+	case opExpire:
+		ns.stats.expirations.Add(1)
+	}
+}
+
+// Name Returns the name of the namespace.
+func (ns *Namespace) Name() string {
+	return ns.name
+}
+
+func (ns *Namespace) key(k string) string {
+	return ns.prefix + k
+}
+
+func (ns *Namespace) expiration(d time.Duration) time.Duration {
+	if d == DefaultExpiration && ns.defaultExpiration != 0 {
+		return ns.defaultExpiration
+	}
+	return d
+}
+
+// Set Same as Cache.Set, using the default expiration of the namespace.
+func (ns *Namespace) Set(k string, x any, d time.Duration) {
+	ns.c.set(ns.key(k), x, ns.expiration(d))
+}
+
+// SetDefault Same as Cache.SetDefault, using the default expiration of the
+// namespace.
+func (ns *Namespace) SetDefault(k string, x any) {
+	ns.Set(k, x, DefaultExpiration)
+}
+
+// SetWithTags Same as Cache.SetWithTags, using the default expiration of the
+// namespace. Tags are shared by all namespaces of the cache.
+func (ns *Namespace) SetWithTags(k string, x any, d time.Duration, tags ...string) {
+	ns.c.SetWithTags(ns.key(k), x, ns.expiration(d), tags...)
+}
+
+// Add Same as Cache.Add, using the default expiration of the namespace.
+func (ns *Namespace) Add(k string, x any, d time.Duration) error {
+	return ns.c.Add(ns.key(k), x, ns.expiration(d))
+}
+
+// Replace Same as Cache.Replace, using the default expiration of the
+// namespace.
+func (ns *Namespace) Replace(k string, x any, d time.Duration) error {
+	return ns.c.Replace(ns.key(k), x, ns.expiration(d))
+}
+
+// Get Same as Cache.Get.
+func (ns *Namespace) Get(k string) (any, bool) {
+	x, found := ns.c.Get(ns.key(k))
+	ns.stats.lookup(found)
+	return x, found
+}
+
+// GetWithExpiration Same as Cache.GetWithExpiration.
+func (ns *Namespace) GetWithExpiration(k string) (any, time.Time, bool) {
+	x, exp, found := ns.c.GetWithExpiration(ns.key(k))
+	ns.stats.lookup(found)
+	return x, exp, found
+}
+
+// GetWithTTL Same as Cache.GetWithTTL.
+func (ns *Namespace) GetWithTTL(k string) (any, time.Duration, bool) {
+	x, ttl, found := ns.c.GetWithTTL(ns.key(k))
+	ns.stats.lookup(found)
+	return x, ttl, found
+}
+
+// GetWithRemainingTTL Same as Cache.GetWithRemainingTTL.
+func (ns *Namespace) GetWithRemainingTTL(k string) (any, time.Duration, bool) {
+	x, ttl, found := ns.c.GetWithRemainingTTL(ns.key(k))
+	ns.stats.lookup(found)
+	return x, ttl, found
+}
+
+// Touch Same as Cache.Touch, using the default expiration of the namespace.
+func (ns *Namespace) Touch(k string, d time.Duration) error {
+	return ns.c.Touch(ns.key(k), ns.expiration(d))
+}
+
+// Modify Same as Cache.Modify.
+func (ns *Namespace) Modify(k string, f func(x any) (any, error)) error {
+	return ns.c.Modify(ns.key(k), f)
+}
+
+// Increment Same as Cache.Increment.
+func (ns *Namespace) Increment(k string, n int64) error {
+	return ns.c.Increment(ns.key(k), n)
+}
+
+// IncrementFloat Same as Cache.IncrementFloat.
+func (ns *Namespace) IncrementFloat(k string, n float64) error {
+	return ns.c.IncrementFloat(ns.key(k), n)
+}
+
+// Decrement Same as Cache.Decrement.
+func (ns *Namespace) Decrement(k string, n int64) error {
+	return ns.c.Decrement(ns.key(k), n)
+}
+
+// DecrementFloat Same as Cache.DecrementFloat.
+func (ns *Namespace) DecrementFloat(k string, n float64) error {
+	return ns.c.DecrementFloat(ns.key(k), n)
+}
+
+// Delete Same as Cache.Delete.
+func (ns *Namespace) Delete(k string) {
+	ns.c.Delete(ns.key(k))
+}
+
+// All Returns an iterator over the unexpired items of the namespace, with
+// keys without the namespace prefix, with the same consistency as Cache.All.
+func (ns *Namespace) All() iter.Seq2[string, Item] {
+	return func(yield func(string, Item) bool) {
+		for k, v := range ns.c.ScanPrefix(ns.prefix) {
+			if !yield(k[len(ns.prefix):], v) {
+				return
+			}
+		}
+	}
+}
+
+// Keys Returns an iterator over the keys of the unexpired items of the
+// namespace, see All.
+func (ns *Namespace) Keys() iter.Seq[string] {
+	return keys(ns.All())
+}
+
+// Items Copies all unexpired items of the namespace into a new map and
+// returns it.
+func (ns *Namespace) Items() map[string]Item {
+	return Collect(ns.All())
+}
+
+// ItemCount Returns the number of unexpired items in the namespace.
+func (ns *Namespace) ItemCount() int {
+	n := 0
+	for range ns.c.ScanPrefix(ns.prefix) {
+		n++
+	}
+	return n
+}
+
+// Flush Deletes all items of the namespace. Like Cache.Flush, it doesn't call
+// OnEvicted functions.
+func (ns *Namespace) Flush() {
+	for k := range keys(ns.c.ScanPrefix(ns.prefix)) {
+		ns.c.delete(k)
+	}
+	ns.stats.flushes.Add(1)
+}
+
+// OnEvicted Sets an (optional) function that is called with the key (without
+// the namespace prefix) and value when an item of the namespace is evicted,
+// in addition to the OnEvicted function of the cache. Set to nil to disable.
+func (ns *Namespace) OnEvicted(f func(string, any)) {
+	if f == nil {
+		ns.onEvicted.Store(nil)
+	} else {
+		ns.onEvicted.Store(&f)
+	}
+}
+
+// Stats Returns the operation counters of the namespace. Deletes include the
+// items deleted by Flush.
+func (ns *Namespace) Stats() Stats {
+	return ns.stats.snapshot()
+}
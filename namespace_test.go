@@ -0,0 +1,61 @@
+package cache
+
+import (
+	"slices"
+	"testing"
+	"time"
+)
+
+func TestNamespace(t *testing.T) {
+	tc := New(time.Hour, 0, true)
+	defer tc.Close()
+	users := tc.Namespace("users", NamespaceOptions{DefaultExpiration: time.Millisecond})
+	if tc.Namespace("users", NamespaceOptions{}) != users {
+		t.Error("Namespace returned a new namespace for the same name")
+	}
+	products := tc.Namespace("products", NamespaceOptions{})
+	users.SetDefault("1", "alice")
+	users.Set("2", "bob", NoExpiration)
+	products.SetDefault("1", "book")
+	if x, found := tc.Get("users:2"); !found || x != "bob" {
+		t.Error("namespace key is not prefixed:", x, found)
+	}
+	if x, found := products.Get("1"); !found || x != "book" {
+		t.Error("products:1 not found:", x, found)
+	}
+	if _, ttl, _ := products.GetWithRemainingTTL("1"); ttl <= time.Minute {
+		t.Error("cache default expiration was not used:", ttl)
+	}
+	var evicted []string
+	users.OnEvicted(func(k string, _ any) {
+		evicted = append(evicted, k)
+	})
+	<-time.After(5 * time.Millisecond)
+	tc.DeleteExpired()
+	if !slices.Equal(evicted, []string{"1"}) {
+		t.Error("namespace default expiration or OnEvicted wasn't used:", evicted)
+	}
+	users.Set("3", 3, NoExpiration)
+	if err := users.Increment("3", 1); err != nil {
+		t.Fatal(err)
+	}
+	if keys := CollectKeys(users.Keys()); !slices.Equal(keys, []string{"2", "3"}) || users.ItemCount() != 2 {
+		t.Error("unexpected namespace keys:", keys)
+	}
+	users.Delete("2")
+	if !slices.Equal(evicted, []string{"1", "2"}) {
+		t.Error("OnEvicted was not called for Delete:", evicted)
+	}
+	users.Flush()
+	if users.ItemCount() != 0 || products.ItemCount() != 1 {
+		t.Error("Flush affected other namespaces:", users.ItemCount(), products.ItemCount())
+	}
+	users.Get("missing")
+	want := Stats{Misses: 1, Sets: 4, Deletes: 2, Expirations: 1, Flushes: 1}
+	if s := users.Stats(); s != want {
+		t.Errorf("unexpected stats %+v, expected %+v", s, want)
+	}
+	if s := products.Stats(); s.Hits != 2 || s.Sets != 1 {
+		t.Errorf("unexpected products stats %+v", s)
+	}
+}
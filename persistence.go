@@ -0,0 +1,115 @@
+package cache
+
+import (
+	"errors"
+	"io/fs"
+	"sync/atomic"
+	"time"
+)
+
+// Persistence Configures automatic snapshots of a cache, see WithPersistence.
+//
+// The cache is loaded from Path when it is created, then a snapshot is
+// written to Path every Interval and/or after every Mutations changes, and
+// finally once more on Close. Snapshots are written atomically, see SaveFile.
+type Persistence struct {
+	// Path of the snapshot file, required.
+	Path string
+	// Interval between periodic snapshots. Periodic snapshots are skipped
+	// if the cache was not modified since the previous one. Zero disables
+	// periodic snapshots.
+	Interval time.Duration
+	// Mutations is the number of modifications of the cache after which a
+	// snapshot is written. Zero disables such snapshots.
+	Mutations int64
+	// Keep previous snapshots, see SaveFileRotate.
+	Keep int
+	// OnError is called with errors which happen while loading or writing
+	// snapshots.
+	OnError func(error)
+}
+
+type snapshotter struct {
+	c         *cache
+	cfg       Persistence
+	obs       *observer
+	mutations atomic.Int64
+	trigger   chan struct{}
+	stop      chan any
+	done      chan any
+}
+
+func startSnapshots(c *cache, cfg Persistence) *snapshotter {
+	s := &snapshotter{
+		c:       c,
+		cfg:     cfg,
+		trigger: make(chan struct{}, 1),
+		stop:    make(chan any),
+		done:    make(chan any),
+	}
+	if err := c.LoadFile(cfg.Path); err != nil && !errors.Is(err, fs.ErrNotExist) {
+		s.report(err)
+	}
+	s.obs = c.addObserver(s.observe)
+	go s.run()
+	return s
+}
+
+func (s *snapshotter) observe(m mutation) {
+	if m.op == opExpire {
+		return
+	}
+	// The count may be over the threshold if the snapshot it triggered is
+	// still pending, triggers are coalesced then.
+	if n := s.mutations.Add(1); s.cfg.Mutations > 0 && n >= s.cfg.Mutations {
+		select {
+		case s.trigger <- struct{}{}:
+		default:
+		}
+	}
+}
+
+func (s *snapshotter) run() {
+	defer close(s.done)
+	var tick <-chan time.Time
+	if s.cfg.Interval > 0 {
+		ticker := time.NewTicker(s.cfg.Interval)
+		defer ticker.Stop()
+		tick = ticker.C
+	}
+	for {
+		select {
+		case <-tick:
+			if s.mutations.Load() > 0 {
+				s.report(s.save())
+			}
+		case <-s.trigger:
+			s.report(s.save())
+		case <-s.stop:
+			return
+		}
+	}
+}
+
+func (s *snapshotter) save() error {
+	// Mutations applied while the snapshot is written count towards the
+	// next one, they may or may not be included in this one.
+	s.mutations.Store(0)
+	return s.c.SaveFileRotate(s.cfg.Path, s.cfg.Keep)
+}
+
+func (s *snapshotter) report(err error) {
+	if err != nil && s.cfg.OnError != nil {
+		s.cfg.OnError(err)
+	}
+}
+
+// close stops periodic snapshots and writes the final one.
+func (s *snapshotter) close() error {
+	close(s.stop)
+	<-s.done
+	s.c.removeObserver(s.obs)
+	err := s.save()
+	s.report(err)
+	return err
+}
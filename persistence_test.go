@@ -0,0 +1,107 @@
+package cache
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestPersistenceFinalSnapshot(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "cache.dat")
+	p := Persistence{
+		Path: path,
+		OnError: func(err error) {
+			t.Error("Unexpected persistence error:", err)
+		},
+	}
+	tc := NewWithOptions(DefaultExpiration, 0, WithPersistence(p))
+	tc.Set("a", "a", DefaultExpiration)
+	if err := tc.Close(); err != nil {
+		t.Fatal("Couldn't close cache:", err)
+	}
+
+	oc := NewWithOptions(DefaultExpiration, 0, WithPersistence(p))
+	defer oc.Close()
+	if a, _ := oc.Get("a"); a != "a" {
+		t.Error("a was not loaded on start:", a)
+	}
+}
+
+func TestPersistenceAfterMutations(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "cache.dat")
+	tc := NewWithOptions(DefaultExpiration, 0, WithPersistence(Persistence{
+		Path:      path,
+		Mutations: 2,
+	}))
+	defer tc.Close()
+	tc.Set("a", "a", DefaultExpiration)
+	tc.Set("b", "b", DefaultExpiration)
+
+	deadline := time.Now().Add(time.Second)
+	for {
+		oc := New(DefaultExpiration, 0)
+		if err := oc.LoadFile(path); err == nil && oc.ItemCount() == 2 {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("snapshot was not written after 2 mutations")
+		}
+		<-time.After(5 * time.Millisecond)
+	}
+}
+
+func TestPersistenceOverMutations(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "cache.dat")
+	tc := NewWithOptions(DefaultExpiration, 0, WithPersistence(Persistence{
+		Path:      path,
+		Mutations: 2,
+	}))
+	defer tc.Close()
+	// The count went past the threshold without a snapshot, e.g. because
+	// the trigger was coalesced with a pending one.
+	tc.snapshots.mutations.Store(5)
+	tc.Set("a", "a", DefaultExpiration)
+
+	deadline := time.Now().Add(time.Second)
+	for {
+		oc := New(DefaultExpiration, 0)
+		if err := oc.LoadFile(path); err == nil && oc.ItemCount() == 1 {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("snapshot was not written over the threshold")
+		}
+		<-time.After(5 * time.Millisecond)
+	}
+}
+
+func TestPersistenceInterval(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "cache.dat")
+	errs := make(chan error, 1)
+	tc := NewWithOptions(DefaultExpiration, 0, WithPersistence(Persistence{
+		Path:     path,
+		Interval: 10 * time.Millisecond,
+		OnError: func(err error) {
+			select {
+			case errs <- err:
+			default:
+			}
+		},
+	}))
+	defer tc.Close()
+	tc.Set("a", "a", DefaultExpiration)
+	<-time.After(50 * time.Millisecond)
+	select {
+	case err := <-errs:
+		t.Fatal("Unexpected persistence error:", err)
+	default:
+	}
+
+	oc := New(DefaultExpiration, 0)
+	if err := oc.LoadFile(path); err != nil {
+		t.Fatal("periodic snapshot was not written:", err)
+	}
+	if a, _ := oc.Get("a"); a != "a" {
+		t.Error("a is not a:", a)
+	}
+}
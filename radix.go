@@ -0,0 +1,154 @@
+package cache
+
+import (
+	"sort"
+	"strings"
+	"sync"
+)
+
+// radixNode is a node of a radix tree. The key of a node is the
+// concatenation of the prefixes on the path from the root.
+type radixNode struct {
+	prefix string
+	// leaf is true if the key of the node is in the tree.
+	leaf bool
+	// children are sorted by the first byte of their prefixes, which are
+	// distinct.
+	children []*radixNode
+}
+
+func (n *radixNode) child(b byte) (int, bool) {
+	i := sort.Search(len(n.children), func(i int) bool {
+		return n.children[i].prefix[0] >= b
+	})
+	return i, i < len(n.children) && n.children[i].prefix[0] == b
+}
+
+func (n *radixNode) insertChild(i int, ch *radixNode) {
+	n.children = append(n.children, nil)
+	copy(n.children[i+1:], n.children[i:])
+	n.children[i] = ch
+}
+
+func commonPrefixLen(a, b string) int {
+	i := 0
+	for i < len(a) && i < len(b) && a[i] == b[i] {
+		i++
+	}
+	return i
+}
+
+// insert adds k to the subtree of n.
+func (n *radixNode) insert(k string) {
+	for len(k) > 0 {
+		i, found := n.child(k[0])
+		if !found {
+			n.insertChild(i, &radixNode{prefix: k, leaf: true})
+			return
+		}
+		ch := n.children[i]
+		l := commonPrefixLen(ch.prefix, k)
+		if l < len(ch.prefix) {
+			split := &radixNode{prefix: ch.prefix[:l], children: []*radixNode{ch}}
+			ch.prefix = ch.prefix[l:]
+			n.children[i] = split
+			ch = split
+		}
+		n, k = ch, k[l:]
+	}
+	n.leaf = true
+}
+
+// remove deletes k from the subtree of n, merging nodes left with a single
+// child. It returns false if k wasn't in the subtree.
+func (n *radixNode) remove(k string) bool {
+	if len(k) == 0 {
+		if !n.leaf {
+			return false
+		}
+		n.leaf = false
+		return true
+	}
+	i, found := n.child(k[0])
+	if !found {
+		return false
+	}
+	ch := n.children[i]
+	if !strings.HasPrefix(k, ch.prefix) || !ch.remove(k[len(ch.prefix):]) {
+		return false
+	}
+	if !ch.leaf {
+		switch len(ch.children) {
+		case 0:
+			n.children = append(n.children[:i], n.children[i+1:]...)
+		case 1:
+			gc := ch.children[0]
+			gc.prefix = ch.prefix + gc.prefix
+			n.children[i] = gc
+		}
+	}
+	return true
+}
+
+// walk calls f with the keys of the subtree of n in lexical order, key being
+// the key of n, until f returns false.
+func (n *radixNode) walk(key string, f func(string) bool) bool {
+	if n.leaf && !f(key) {
+		return false
+	}
+	for _, ch := range n.children {
+		if !ch.walk(key+ch.prefix, f) {
+			return false
+		}
+	}
+	return true
+}
+
+// prefixIndex is a radix tree of the keys of a cache, kept up to date by an
+// observer, so keys with a prefix can be found without scanning the cache.
+type prefixIndex struct {
+	mu   sync.RWMutex
+	root radixNode
+}
+
+func (x *prefixIndex) observe(m mutation) {
+	x.mu.Lock()
+	switch {
+	case m.op.stores():
+		x.root.insert(m.key)
+	case m.op == opFlush:
+		x.root = radixNode{}
+	default:
+		x.root.remove(m.key)
+	}
+	x.mu.Unlock()
+}
+
+// keys returns the keys with the prefix, sorted.
+func (x *prefixIndex) keys(prefix string) []string {
+	x.mu.RLock()
+	defer x.mu.RUnlock()
+	n, key := &x.root, ""
+	for len(prefix) > 0 {
+		i, found := n.child(prefix[0])
+		if !found {
+			return nil
+		}
+		ch := n.children[i]
+		switch {
+		case strings.HasPrefix(prefix, ch.prefix):
+			prefix = prefix[len(ch.prefix):]
+		case strings.HasPrefix(ch.prefix, prefix):
+			prefix = ""
+		default:
+			return nil
+		}
+		n, key = ch, key+ch.prefix
+	}
+	var keys []string
+	n.walk(key, func(k string) bool {
+		keys = append(keys, k)
+		return true
+	})
+	return keys
+}
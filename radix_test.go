@@ -0,0 +1,69 @@
+package cache
+
+import (
+	"math/rand"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestRadixTree(t *testing.T) {
+	var x prefixIndex
+	keys := []string{"user:1", "user:10", "user:2", "user:1:profile", "u", "", "product:1", "user:"}
+	for _, k := range keys {
+		x.observe(mutation{op: opSet, key: k})
+	}
+	for prefix, want := range map[string][]string{
+		"":       {"", "product:1", "u", "user:", "user:1", "user:10", "user:1:profile", "user:2"},
+		"user:1": {"user:1", "user:10", "user:1:profile"},
+		"us":     {"user:", "user:1", "user:10", "user:1:profile", "user:2"},
+		"user:3": nil,
+		"x":      nil,
+	} {
+		if got := x.keys(prefix); !slices.Equal(got, want) {
+			t.Errorf("keys(%q) = %q, expected %q", prefix, got, want)
+		}
+	}
+	x.observe(mutation{op: opDelete, key: "user:1"})
+	x.observe(mutation{op: opExpire, key: "user:10"})
+	x.observe(mutation{op: opDelete, key: "missing"})
+	if got := x.keys("user:1"); !slices.Equal(got, []string{"user:1:profile"}) {
+		t.Error("unexpected keys after delete:", got)
+	}
+	x.observe(mutation{op: opFlush})
+	if got := x.keys(""); got != nil {
+		t.Error("unexpected keys after flush:", got)
+	}
+}
+
+func TestRadixTreeRandom(t *testing.T) {
+	var x prefixIndex
+	set := make(map[string]bool)
+	rnd := rand.New(rand.NewSource(1))
+	for i := 0; i < 5000; i++ {
+		b := make([]byte, rnd.Intn(6))
+		for j := range b {
+			b[j] = "abc"[rnd.Intn(3)]
+		}
+		k := string(b)
+		if rnd.Intn(3) == 0 {
+			x.observe(mutation{op: opDelete, key: k})
+			delete(set, k)
+		} else {
+			x.observe(mutation{op: opSet, key: k})
+			set[k] = true
+		}
+	}
+	for _, prefix := range []string{"", "a", "ab", "cab", "bbbbb"} {
+		var want []string
+		for k := range set {
+			if strings.HasPrefix(k, prefix) {
+				want = append(want, k)
+			}
+		}
+		slices.Sort(want)
+		if got := x.keys(prefix); !slices.Equal(got, want) {
+			t.Errorf("keys(%q) = %q, expected %q", prefix, got, want)
+		}
+	}
+}
@@ -0,0 +1,74 @@
+package ratelimit
+
+import (
+	"time"
+
+	"github.com/sot-tech/go-cache"
+)
+
+// GCRA A limiter implementing the generic cell rate algorithm, which allows
+// the same events as TokenBucket, but only stores the theoretical arrival
+// time of the next event per key: the time at which the bucket would be full
+// again.
+type GCRA struct {
+	c *cache.Cache
+	// interval is the time between events at the average rate.
+	interval time.Duration
+	burst    int
+	// Prefix is prepended to the keys of the cache items holding the state
+	// of the limiter.
+	Prefix string
+	// Now returns the current time, time.Now if nil.
+	Now func() time.Time
+}
+
+// gcraState is the state of a key of a GCRA limiter: the theoretical arrival
+// time in Unix nanoseconds.
+type gcraState struct {
+	TAT int64
+}
+
+// NewGCRA Returns a GCRA limiter with the state in c, allowing limit events
+// per period on average, and up to burst events at once.
+func NewGCRA(c *cache.Cache, limit int, period time.Duration, burst int) *GCRA {
+	return &GCRA{
+		c:        c,
+		interval: period / time.Duration(limit),
+		burst:    burst,
+	}
+}
+
+// Allow Same as AllowN(key, 1).
+func (l *GCRA) Allow(key string) (Result, error) {
+	return l.AllowN(key, 1)
+}
+
+// AllowN Reports whether n events may happen now for the key, and counts
+// them if so. Returns ErrExceedsLimit if n is greater than the burst, and
+// cache.ErrInvalidType if the key holds a value of another type.
+func (l *GCRA) AllowN(key string, n int) (Result, error) {
+	if n > l.burst {
+		return Result{}, ErrExceedsLimit
+	}
+	interval := int64(l.interval)
+	tolerance := int64(l.burst) * interval
+	return update(l.c, l.Prefix+key, l.Now, func(x any, now int64) (Result, any, time.Duration, error) {
+		tat := now
+		if x != nil {
+			s, ok := x.(gcraState)
+			if !ok {
+				return Result{}, nil, 0, cache.ErrInvalidType
+			}
+			tat = max(tat, s.TAT)
+		}
+		next := tat + int64(n)*interval
+		if allowAt := next - tolerance; now < allowAt {
+			return Result{
+				Remaining:  int((now + tolerance - tat) / interval),
+				RetryAfter: time.Duration(allowAt - now),
+			}, nil, 0, nil
+		}
+		r := Result{Allowed: true, Remaining: int((now + tolerance - next) / interval)}
+		return r, gcraState{next}, time.Duration(next - now), nil
+	})
+}
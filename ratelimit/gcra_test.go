@@ -0,0 +1,41 @@
+package ratelimit
+
+import (
+	"testing"
+	"time"
+
+	"github.com/sot-tech/go-cache"
+)
+
+func TestGCRA(t *testing.T) {
+	c := cache.New(cache.NoExpiration, 0)
+	defer c.Close()
+	clk := newClock()
+	l := NewGCRA(c, 10, time.Second, 3)
+	l.Now = clk.Now
+	if r := allow(t, l, "a", 1); !r.Allowed || r.Remaining != 2 {
+		t.Fatal("unexpected result of the first event:", r)
+	}
+	if r := allow(t, l, "a", 2); !r.Allowed || r.Remaining != 0 {
+		t.Fatal("unexpected result of the burst:", r)
+	}
+	r := allow(t, l, "a", 1)
+	if r.Allowed || r.RetryAfter != 100*time.Millisecond {
+		t.Error("unexpected result over the burst:", r)
+	}
+	clk.advance(r.RetryAfter - time.Nanosecond)
+	if r := allow(t, l, "a", 1); r.Allowed {
+		t.Error("event was allowed before RetryAfter:", r)
+	}
+	clk.advance(time.Nanosecond)
+	if r := allow(t, l, "a", 1); !r.Allowed || r.Remaining != 0 {
+		t.Error("unexpected result after RetryAfter:", r)
+	}
+	clk.advance(time.Hour)
+	if r := allow(t, l, "a", 1); !r.Allowed || r.Remaining != 2 {
+		t.Error("burst was exceeded after idling:", r)
+	}
+	if x, _ := c.Get("a"); x != (gcraState{clk.now.UnixNano() + int64(100*time.Millisecond)}) {
+		t.Error("unexpected state:", x)
+	}
+}
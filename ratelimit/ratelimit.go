@@ -0,0 +1,102 @@
+// Package ratelimit provides rate limiters keyed by string, e.g. by client
+// address or user ID, which keep their state in a cache.Cache:
+//
+//	TokenBucket    tokens refill at a constant rate up to a burst size
+//	GCRA           same limits as TokenBucket, with a single timestamp of
+//	               state per key
+//	SlidingLog     at most limit events in any window, exact, with one
+//	               timestamp of state per allowed event
+//	SlidingWindow  approximation of SlidingLog weighting the count of the
+//	               previous fixed window, with constant state per key
+//
+// The state of a key is updated atomically with cache.Cache.Txn, so a
+// limiter may be shared by goroutines, and several limiters may share a
+// cache, as long as their keys don't collide, see the Prefix fields. State
+// items expire once the key is back to its initial state, give or take the
+// delay of the cache's clock, so idle keys are deleted by the cache's janitor.
+package ratelimit
+
+import (
+	"encoding/gob"
+	"errors"
+	"math"
+	"time"
+
+	"github.com/sot-tech/go-cache"
+)
+
+// ErrExceedsLimit Returned by limiters when more events are requested at
+// once than they could ever allow.
+var ErrExceedsLimit = errors.New("n exceeds the limit")
+
+// Result Outcome of a request of events from a limiter.
+type Result struct {
+	// Allowed reports whether the events are allowed, in which case they
+	// are counted against the limit. Denied events are not counted.
+	Allowed bool
+	// Remaining is the number of events which would be allowed right after
+	// this request.
+	Remaining int
+	// RetryAfter is the time to wait before the same request would be
+	// allowed, if it wasn't.
+	RetryAfter time.Duration
+}
+
+// Limiter A rate limiter keyed by string.
+type Limiter interface {
+	// AllowN Reports whether n events may happen now for the key.
+	AllowN(key string, n int) (Result, error)
+}
+
+func init() {
+	// The states are registered, so that caches holding them can be loaded
+	// before any of them is encoded.
+	gob.Register(tokenBucketState{})
+	gob.Register(gcraState{})
+	gob.Register(slidingLogState{})
+	gob.Register(slidingWindowState{})
+}
+
+// clockTick is the longest delay of the clock the cache stamps expirations
+// with, see cache.New: an item set to expire after ttl may expire up to
+// clockTick early. State TTLs, computed with the precise time of the limiter,
+// are padded with it, so that state never expires before the key is back to
+// its initial state.
+const clockTick = time.Second
+
+// update runs f with the state of the key in a transaction of c, with the
+// current time in Unix nanoseconds. f returns the result and the new state
+// of the key, which is stored to expire after ttl (and clockTick), or
+// deleted if ttl isn't positive, unless the state is nil. Returns
+// cache.ErrReadOnly if c follows a leader.
+func update(c *cache.Cache, key string, now func() time.Time, f func(x any, now int64) (Result, any, time.Duration, error)) (Result, error) {
+	if now == nil {
+		now = time.Now
+	}
+	var r Result
+	err := c.Txn(func(tx *cache.Tx) error {
+		x, _ := tx.Get(key)
+		var state any
+		var ttl time.Duration
+		var err error
+		r, state, ttl, err = f(x, now().UnixNano())
+		switch {
+		case err != nil || state == nil:
+		case ttl > 0:
+			tx.Set(key, state, ttl+clockTick)
+		default:
+			tx.Delete(key)
+		}
+		return err
+	})
+	if errors.Is(err, cache.ErrReadOnly) {
+		// The events weren't counted.
+		r = Result{}
+	}
+	return r, err
+}
+
+// ceil returns the duration of d nanoseconds rounded up.
+func ceil(d float64) time.Duration {
+	return time.Duration(math.Ceil(d))
+}
@@ -0,0 +1,202 @@
+package ratelimit
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"reflect"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/sot-tech/go-cache"
+)
+
+var (
+	_ Limiter = (*TokenBucket)(nil)
+	_ Limiter = (*GCRA)(nil)
+	_ Limiter = (*SlidingLog)(nil)
+	_ Limiter = (*SlidingWindow)(nil)
+)
+
+// clock is a fake time source for limiters.
+type clock struct {
+	now time.Time
+}
+
+func newClock() *clock {
+	return &clock{now: time.Unix(1000, 0)}
+}
+
+func (c *clock) Now() time.Time {
+	return c.now
+}
+
+func (c *clock) advance(d time.Duration) {
+	c.now = c.now.Add(d)
+}
+
+func allow(t *testing.T, l Limiter, key string, n int) Result {
+	t.Helper()
+	r, err := l.AllowN(key, n)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return r
+}
+
+func TestLimitersConcurrent(t *testing.T) {
+	c := cache.New(cache.NoExpiration, 0)
+	defer c.Close()
+	clk := newClock()
+	limiters := map[string]Limiter{
+		"tb":  NewTokenBucket(c, 1, time.Hour, 50),
+		"gc":  NewGCRA(c, 1, time.Hour, 50),
+		"log": NewSlidingLog(c, 50, time.Hour),
+		"win": NewSlidingWindow(c, 50, time.Hour),
+	}
+	for prefix, l := range limiters {
+		switch l := l.(type) {
+		case *TokenBucket:
+			l.Prefix, l.Now = prefix, clk.Now
+		case *GCRA:
+			l.Prefix, l.Now = prefix, clk.Now
+		case *SlidingLog:
+			l.Prefix, l.Now = prefix, clk.Now
+		case *SlidingWindow:
+			l.Prefix, l.Now = prefix, clk.Now
+		}
+		var allowed atomic.Int64
+		var wg sync.WaitGroup
+		for range 8 {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				for range 20 {
+					if r, err := l.AllowN("k", 1); err != nil {
+						t.Error(err)
+					} else if r.Allowed {
+						allowed.Add(1)
+					}
+				}
+			}()
+		}
+		wg.Wait()
+		if n := allowed.Load(); n != 50 {
+			t.Errorf("%s: unexpected number of allowed events: %d", prefix, n)
+		}
+	}
+}
+
+func TestLimiterInvalidType(t *testing.T) {
+	c := cache.New(cache.NoExpiration, 0)
+	defer c.Close()
+	c.Set("k", "v", cache.DefaultExpiration)
+	for _, l := range []Limiter{
+		NewTokenBucket(c, 1, time.Second, 1),
+		NewGCRA(c, 1, time.Second, 1),
+		NewSlidingLog(c, 1, time.Second),
+		NewSlidingWindow(c, 1, time.Second),
+	} {
+		if _, err := l.AllowN("k", 1); err != cache.ErrInvalidType {
+			t.Errorf("%T: unexpected error: %v", l, err)
+		}
+		if _, err := l.AllowN("other", 2); err != ErrExceedsLimit {
+			t.Errorf("%T: unexpected error: %v", l, err)
+		}
+	}
+}
+
+func TestLimiterStateExpires(t *testing.T) {
+	c := cache.New(cache.NoExpiration, time.Millisecond, true)
+	defer c.Close()
+	l := NewGCRA(c, 1, 20*time.Millisecond, 1)
+	if r, _ := l.Allow("k"); !r.Allowed {
+		t.Fatal("first event was denied")
+	}
+	if _, found := c.Get("k"); !found {
+		t.Fatal("state was not stored")
+	}
+	// The state is kept for one tick of the cache's clock more.
+	<-time.After(20*time.Millisecond + clockTick + 40*time.Millisecond)
+	if c.ItemCount() != 0 {
+		t.Error("idle state was not deleted")
+	}
+}
+
+func TestLimiterStateOutlivesClockTick(t *testing.T) {
+	// The clock of the cache is only updated every second, so the state of
+	// a limiter using the precise time expires early unless padded.
+	for _, newLimiter := range []func(c *cache.Cache) Limiter{
+		func(c *cache.Cache) Limiter { return NewTokenBucket(c, 1, time.Second, 1) },
+		func(c *cache.Cache) Limiter { return NewGCRA(c, 1, time.Second, 1) },
+		func(c *cache.Cache) Limiter { return NewSlidingLog(c, 1, time.Second) },
+		func(c *cache.Cache) Limiter { return NewSlidingWindow(c, 1, time.Second) },
+	} {
+		c := cache.New(cache.NoExpiration, 10*time.Millisecond)
+		l := newLimiter(c)
+		t.Run(fmt.Sprintf("%T", l), func(t *testing.T) {
+			t.Parallel()
+			defer c.Close()
+			// Let the clock of the cache fall behind.
+			<-time.After(500 * time.Millisecond)
+			if r := allow(t, l, "k", 1); !r.Allowed {
+				t.Fatal("first event was denied")
+			}
+			for deadline := time.Now().Add(800 * time.Millisecond); time.Now().Before(deadline); {
+				if r := allow(t, l, "k", 1); r.Allowed {
+					t.Fatal("event was allowed within the period")
+				}
+				<-time.After(20 * time.Millisecond)
+			}
+		})
+	}
+}
+
+// TestDecodeStates loads the states of the limiters in a new process, which
+// never encoded them.
+func TestDecodeStates(t *testing.T) {
+	states := map[string]any{
+		"tb:k":  tokenBucketState{},
+		"gc:k":  gcraState{},
+		"log:k": slidingLogState{},
+		"win:k": slidingWindowState{},
+	}
+	if fname := os.Getenv("RATELIMIT_TEST_SNAPSHOT"); fname != "" {
+		c := cache.New(cache.NoExpiration, 0)
+		defer c.Close()
+		if err := c.LoadFile(fname); err != nil {
+			t.Fatal("Couldn't load:", err)
+		}
+		for k, v := range states {
+			if x, _ := c.Get(k); reflect.TypeOf(x) != reflect.TypeOf(v) {
+				t.Errorf("unexpected state of %s: %#v", k, x)
+			}
+		}
+		return
+	}
+	c := cache.New(cache.NoExpiration, 0)
+	defer c.Close()
+	tb := NewTokenBucket(c, 1, time.Hour, 5)
+	tb.Prefix = "tb:"
+	gc := NewGCRA(c, 1, time.Hour, 5)
+	gc.Prefix = "gc:"
+	log := NewSlidingLog(c, 5, time.Hour)
+	log.Prefix = "log:"
+	win := NewSlidingWindow(c, 5, time.Hour)
+	win.Prefix = "win:"
+	for _, l := range []Limiter{tb, gc, log, win} {
+		allow(t, l, "k", 1)
+	}
+	fname := filepath.Join(t.TempDir(), "cache.dat")
+	if err := c.SaveFile(fname); err != nil {
+		t.Fatal(err)
+	}
+	cmd := exec.Command(os.Args[0], "-test.run=^TestDecodeStates$")
+	cmd.Env = append(os.Environ(), "RATELIMIT_TEST_SNAPSHOT="+fname)
+	if out, err := cmd.CombinedOutput(); err != nil {
+		t.Fatalf("%v\n%s", err, out)
+	}
+}
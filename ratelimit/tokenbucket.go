@@ -0,0 +1,74 @@
+package ratelimit
+
+import (
+	"time"
+
+	"github.com/sot-tech/go-cache"
+)
+
+// TokenBucket A limiter allowing events while tokens remain in the bucket
+// of the key, which holds up to burst tokens and is refilled at a constant
+// rate. Each event takes one token.
+type TokenBucket struct {
+	c *cache.Cache
+	// rate is the number of tokens added per nanosecond.
+	rate  float64
+	burst int
+	// Prefix is prepended to the keys of the cache items holding the state
+	// of the limiter.
+	Prefix string
+	// Now returns the current time, time.Now if nil.
+	Now func() time.Time
+}
+
+// tokenBucketState is the state of a key of a TokenBucket: the tokens in
+// the bucket at Last, in Unix nanoseconds.
+type tokenBucketState struct {
+	Tokens float64
+	Last   int64
+}
+
+// NewTokenBucket Returns a token bucket limiter with the state in c,
+// allowing limit events per period on average, and up to burst events at
+// once. A key starts with a full bucket.
+func NewTokenBucket(c *cache.Cache, limit int, period time.Duration, burst int) *TokenBucket {
+	return &TokenBucket{
+		c:     c,
+		rate:  float64(limit) / float64(period),
+		burst: burst,
+	}
+}
+
+// Allow Same as AllowN(key, 1).
+func (l *TokenBucket) Allow(key string) (Result, error) {
+	return l.AllowN(key, 1)
+}
+
+// AllowN Reports whether n events may happen now for the key, and takes n
+// tokens if so. Returns ErrExceedsLimit if n is greater than the burst, and
+// cache.ErrInvalidType if the key holds a value of another type.
+func (l *TokenBucket) AllowN(key string, n int) (Result, error) {
+	if n > l.burst {
+		return Result{}, ErrExceedsLimit
+	}
+	burst := float64(l.burst)
+	return update(l.c, l.Prefix+key, l.Now, func(x any, now int64) (Result, any, time.Duration, error) {
+		tokens := burst
+		if x != nil {
+			s, ok := x.(tokenBucketState)
+			if !ok {
+				return Result{}, nil, 0, cache.ErrInvalidType
+			}
+			tokens = min(burst, s.Tokens+float64(now-s.Last)*l.rate)
+		}
+		if tokens < float64(n) {
+			return Result{
+				Remaining:  int(tokens),
+				RetryAfter: ceil((float64(n) - tokens) / l.rate),
+			}, nil, 0, nil
+		}
+		tokens -= float64(n)
+		r := Result{Allowed: true, Remaining: int(tokens)}
+		return r, tokenBucketState{tokens, now}, ceil((burst - tokens) / l.rate), nil
+	})
+}
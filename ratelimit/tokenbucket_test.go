@@ -0,0 +1,37 @@
+package ratelimit
+
+import (
+	"testing"
+	"time"
+
+	"github.com/sot-tech/go-cache"
+)
+
+func TestTokenBucket(t *testing.T) {
+	c := cache.New(cache.NoExpiration, 0)
+	defer c.Close()
+	clk := newClock()
+	l := NewTokenBucket(c, 10, time.Second, 5)
+	l.Now = clk.Now
+	if r := allow(t, l, "a", 5); !r.Allowed || r.Remaining != 0 {
+		t.Fatal("unexpected result of a full burst:", r)
+	}
+	r := allow(t, l, "a", 2)
+	if r.Allowed || r.RetryAfter != 200*time.Millisecond {
+		t.Error("unexpected result of an empty bucket:", r)
+	}
+	if r := allow(t, l, "b", 1); !r.Allowed || r.Remaining != 4 {
+		t.Error("keys share a bucket:", r)
+	}
+	clk.advance(r.RetryAfter)
+	if r := allow(t, l, "a", 2); !r.Allowed || r.Remaining != 0 {
+		t.Error("unexpected result after RetryAfter:", r)
+	}
+	clk.advance(time.Hour)
+	if r := allow(t, l, "a", 1); !r.Allowed || r.Remaining != 4 {
+		t.Error("bucket was filled over the burst:", r)
+	}
+	if _, ttl, _ := c.GetWithRemainingTTL("a"); ttl <= clockTick || ttl > 100*time.Millisecond+clockTick {
+		t.Error("unexpected state TTL:", ttl)
+	}
+}
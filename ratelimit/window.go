@@ -0,0 +1,165 @@
+package ratelimit
+
+import (
+	"slices"
+	"time"
+
+	"github.com/sot-tech/go-cache"
+)
+
+// SlidingLog A limiter allowing at most limit events per key in any window
+// of time, which stores the time of each allowed event in the window.
+type SlidingLog struct {
+	c      *cache.Cache
+	limit  int
+	window time.Duration
+	// Prefix is prepended to the keys of the cache items holding the state
+	// of the limiter.
+	Prefix string
+	// Now returns the current time, time.Now if nil.
+	Now func() time.Time
+}
+
+// slidingLogState is the state of a key of a SlidingLog: the times of the
+// allowed events in Unix nanoseconds, in ascending order. The slice is never
+// changed once stored.
+type slidingLogState struct {
+	Times []int64
+}
+
+// NewSlidingLog Returns a sliding log limiter with the state in c, allowing
+// limit events per window.
+func NewSlidingLog(c *cache.Cache, limit int, window time.Duration) *SlidingLog {
+	return &SlidingLog{c: c, limit: limit, window: window}
+}
+
+// Allow Same as AllowN(key, 1).
+func (l *SlidingLog) Allow(key string) (Result, error) {
+	return l.AllowN(key, 1)
+}
+
+// AllowN Reports whether n events may happen now for the key, and records
+// them if so. Returns ErrExceedsLimit if n is greater than the limit, and
+// cache.ErrInvalidType if the key holds a value of another type.
+func (l *SlidingLog) AllowN(key string, n int) (Result, error) {
+	if n > l.limit {
+		return Result{}, ErrExceedsLimit
+	}
+	window := int64(l.window)
+	return update(l.c, l.Prefix+key, l.Now, func(x any, now int64) (Result, any, time.Duration, error) {
+		var times []int64
+		if x != nil {
+			s, ok := x.(slidingLogState)
+			if !ok {
+				return Result{}, nil, 0, cache.ErrInvalidType
+			}
+			times = s.Times
+		}
+		// Events at or before now-window are out of the window.
+		i, _ := slices.BinarySearch(times, now-window+1)
+		times = times[i:]
+		if len(times)+n > l.limit {
+			// Wait until enough events leave the window.
+			t := times[len(times)+n-l.limit-1]
+			return Result{
+				Remaining:  l.limit - len(times),
+				RetryAfter: time.Duration(t + window - now),
+			}, nil, 0, nil
+		}
+		next := make([]int64, len(times), len(times)+n)
+		copy(next, times)
+		for range n {
+			next = append(next, now)
+		}
+		r := Result{Allowed: true, Remaining: l.limit - len(next)}
+		return r, slidingLogState{next}, l.window, nil
+	})
+}
+
+// SlidingWindow A limiter allowing about limit events per key in any window
+// of time. It counts the events of the current and of the previous fixed
+// window, and estimates the events in the sliding window assuming that the
+// events of the previous window were evenly spread.
+type SlidingWindow struct {
+	c      *cache.Cache
+	limit  int
+	window time.Duration
+	// Prefix is prepended to the keys of the cache items holding the state
+	// of the limiter.
+	Prefix string
+	// Now returns the current time, time.Now if nil.
+	Now func() time.Time
+}
+
+// slidingWindowState is the state of a key of a SlidingWindow: the start of
+// the current fixed window in Unix nanoseconds, and the number of events
+// allowed in it and in the previous one.
+type slidingWindowState struct {
+	Start      int64
+	Prev, Curr int
+}
+
+// NewSlidingWindow Returns a sliding window limiter with the state in c,
+// allowing about limit events per window.
+func NewSlidingWindow(c *cache.Cache, limit int, window time.Duration) *SlidingWindow {
+	return &SlidingWindow{c: c, limit: limit, window: window}
+}
+
+// Allow Same as AllowN(key, 1).
+func (l *SlidingWindow) Allow(key string) (Result, error) {
+	return l.AllowN(key, 1)
+}
+
+// AllowN Reports whether n events may happen now for the key, and counts
+// them if so. Returns ErrExceedsLimit if n is greater than the limit, and
+// cache.ErrInvalidType if the key holds a value of another type.
+func (l *SlidingWindow) AllowN(key string, n int) (Result, error) {
+	if n > l.limit {
+		return Result{}, ErrExceedsLimit
+	}
+	window := int64(l.window)
+	return update(l.c, l.Prefix+key, l.Now, func(x any, now int64) (Result, any, time.Duration, error) {
+		s := slidingWindowState{Start: now - now%window}
+		if x != nil {
+			old, ok := x.(slidingWindowState)
+			if !ok {
+				return Result{}, nil, 0, cache.ErrInvalidType
+			}
+			switch old.Start {
+			case s.Start:
+				s = old
+			case s.Start - window:
+				s.Prev = old.Curr
+			}
+		}
+		elapsed := now - s.Start
+		// weight returns the estimated number of events of the previous
+		// window still in the sliding window after elapsed nanoseconds.
+		weight := func(prev int, elapsed int64) float64 {
+			return float64(prev) * float64(window-elapsed) / float64(window)
+		}
+		count := weight(s.Prev, elapsed) + float64(s.Curr)
+		if count+float64(n) > float64(l.limit) {
+			var retry time.Duration
+			if s.Curr+n <= l.limit {
+				// Wait until the weight of the previous window is low
+				// enough, before the end of the current one.
+				free := float64(l.limit - s.Curr - n)
+				retry = ceil(float64(window)-free*float64(window)/float64(s.Prev)) - time.Duration(elapsed)
+			} else {
+				// Wait for the next window, where the current one is the
+				// previous one.
+				free := float64(l.limit - n)
+				retry = time.Duration(window-elapsed) + max(0, ceil(float64(window)-free*float64(window)/float64(s.Curr)))
+			}
+			return Result{
+				Remaining:  max(0, int(float64(l.limit)-count)),
+				RetryAfter: max(retry, 1),
+			}, nil, 0, nil
+		}
+		s.Curr += n
+		r := Result{Allowed: true, Remaining: int(float64(l.limit) - count - float64(n))}
+		// The events are counted until the end of the next window.
+		return r, s, time.Duration(2*window - elapsed), nil
+	})
+}
@@ -0,0 +1,70 @@
+package ratelimit
+
+import (
+	"testing"
+	"time"
+
+	"github.com/sot-tech/go-cache"
+)
+
+func TestSlidingLog(t *testing.T) {
+	c := cache.New(cache.NoExpiration, 0)
+	defer c.Close()
+	clk := newClock()
+	l := NewSlidingLog(c, 3, time.Second)
+	l.Now = clk.Now
+	allow(t, l, "a", 1)
+	clk.advance(400 * time.Millisecond)
+	if r := allow(t, l, "a", 2); !r.Allowed || r.Remaining != 0 {
+		t.Fatal("unexpected result:", r)
+	}
+	clk.advance(100 * time.Millisecond)
+	r := allow(t, l, "a", 2)
+	if r.Allowed || r.RetryAfter != 900*time.Millisecond {
+		t.Error("unexpected result over the limit:", r)
+	}
+	clk.advance(500 * time.Millisecond)
+	if r := allow(t, l, "a", 1); !r.Allowed || r.Remaining != 0 {
+		t.Error("oldest event was not dropped:", r)
+	}
+	if r := allow(t, l, "a", 1); r.Allowed || r.RetryAfter != 400*time.Millisecond {
+		t.Error("unexpected result over the limit:", r)
+	}
+	x, _ := c.Get("a")
+	if times := x.(slidingLogState).Times; len(times) != 3 {
+		t.Error("unexpected log:", times)
+	}
+}
+
+func TestSlidingWindow(t *testing.T) {
+	c := cache.New(cache.NoExpiration, 0)
+	defer c.Close()
+	clk := newClock()
+	l := NewSlidingWindow(c, 10, time.Second)
+	l.Now = clk.Now
+	if r := allow(t, l, "a", 10); !r.Allowed || r.Remaining != 0 {
+		t.Fatal("unexpected result:", r)
+	}
+	r := allow(t, l, "a", 1)
+	if r.Allowed || r.RetryAfter != time.Second+100*time.Millisecond {
+		t.Error("unexpected result over the limit:", r)
+	}
+	// A quarter into the next window, 7.5 events of the previous one
+	// are estimated to be in the sliding window.
+	clk.advance(1250 * time.Millisecond)
+	if r := allow(t, l, "a", 2); !r.Allowed || r.Remaining != 0 {
+		t.Error("unexpected result in the next window:", r)
+	}
+	r = allow(t, l, "a", 1)
+	if r.Allowed || r.RetryAfter != 50*time.Millisecond {
+		t.Error("unexpected result over the limit:", r)
+	}
+	clk.advance(r.RetryAfter)
+	if r := allow(t, l, "a", 1); !r.Allowed {
+		t.Error("unexpected result after RetryAfter:", r)
+	}
+	clk.advance(2 * time.Second)
+	if r := allow(t, l, "a", 10); !r.Allowed {
+		t.Error("old windows were counted:", r)
+	}
+}
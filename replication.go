@@ -0,0 +1,500 @@
+package cache
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math/rand/v2"
+	"net"
+	"sync"
+	"time"
+)
+
+// Replication streams have the following layout. The follower starts with
+//
+//	magic "GOCREPL1"
+//	uint64 leader ID and uint64 sequence number of the last applied
+//	mutation, both zero if the follower has no state to resume from
+//
+// and the leader answers with the magic followed by messages, each starting
+// with a tag byte:
+//
+//	msgFull:      uint64 leader ID, uint64 sequence number, snapshot in the
+//	              format of Save, holding the state up to the sequence number
+//	msgResume:    uint64 leader ID, uint64 sequence number, the stream goes on
+//	              from the position of the follower
+//	msgRecord:    uvarint sequence number, bytes record in the format of the
+//	              append-only log
+//	msgHeartbeat: sent when the leader is idle
+//
+// Integers are little endian. Records hold resulting items, so applying a
+// record which is already part of the snapshot is harmless.
+var replicationMagic = []byte("GOCREPL1")
+
+const (
+	msgFull byte = iota + 1
+	msgResume
+	msgRecord
+	msgHeartbeat
+)
+
+const (
+	// DefaultBacklog is the default number of mutations a Leader keeps for
+	// followers.
+	DefaultBacklog = 10000
+	// DefaultHeartbeat is the default interval of heartbeats sent by a
+	// Leader to idle followers.
+	DefaultHeartbeat = time.Second
+)
+
+var (
+	// ErrReadOnly Returned by Follow if the cache already follows a leader,
+	// and by the methods writing to a cache which follows a leader, see
+	// Cache.ReadOnly.
+	ErrReadOnly = errors.New("cache is read-only")
+	// ErrLeaderClosed Returned by Leader.Serve once the leader is closed.
+	ErrLeaderClosed = errors.New("leader closed")
+	// ErrFollowerBehind Returned by Leader.Serve when a follower falls
+	// behind the mutations kept by the leader. The follower reconnects and
+	// receives a full snapshot.
+	ErrFollowerBehind = errors.New("follower fell behind the backlog")
+	errBadReplication = errors.New("invalid replication stream")
+)
+
+// replicationPosition identifies the last mutation a follower has applied.
+type replicationPosition struct {
+	id, seq uint64
+}
+
+// LeaderConfig Configuration of a Leader, see Cache.Lead.
+type LeaderConfig struct {
+	// Backlog is the number of recent mutations kept for followers which
+	// reconnect or are slower than the leader, DefaultBacklog if zero. It
+	// must cover the mutations made while a snapshot is sent, or followers
+	// never catch up.
+	Backlog int
+	// Heartbeat is the interval of heartbeats sent to idle followers,
+	// DefaultHeartbeat if zero.
+	Heartbeat time.Duration
+}
+
+// Leader Sends the state of a cache and then its mutations to followers,
+// see Cache.Lead and Cache.Follow.
+type Leader struct {
+	c   *cache
+	cfg LeaderConfig
+	// id distinguishes the sequence numbers of this leader from those of
+	// other leaders, e.g. an earlier run of the same process.
+	id  uint64
+	obs *observer
+
+	mu sync.Mutex
+	// seq is the sequence number of the last mutation, entries are the
+	// last ones up to it, in order.
+	seq     uint64
+	entries []replicationEntry
+	// changed is closed and replaced when a mutation is added.
+	changed chan struct{}
+	closed  bool
+}
+
+// replicationEntry is a mutation encoded as a record of the append-only log,
+// or the error of encoding it.
+type replicationEntry struct {
+	seq  uint64
+	data []byte
+	err  error
+}
+
+// Lead Returns a leader replicating the cache to followers connected with
+// Leader.Serve. Mutations are recorded from now on, until Leader.Close.
+// Values are encoded with codecs the same way as by Save, so codecs and Gob
+// types must be registered on followers, the same as for Load. Tags aren't
+// replicated. A cache which follows a leader may lead followers of its own.
+func (c *cache) Lead(cfg LeaderConfig) *Leader {
+	if cfg.Backlog <= 0 {
+		cfg.Backlog = DefaultBacklog
+	}
+	if cfg.Heartbeat <= 0 {
+		cfg.Heartbeat = DefaultHeartbeat
+	}
+	l := &Leader{
+		c:       c,
+		cfg:     cfg,
+		id:      rand.Uint64() | 1,
+		changed: make(chan struct{}),
+	}
+	l.obs = c.addObserver(l.observe)
+	return l
+}
+
+func (l *Leader) observe(m mutation) {
+	if m.op == opExpire {
+		// Followers expire items themselves.
+		return
+	}
+	data, err := l.c.appendLogRecord(nil, logRecord{Op: m.op, Key: m.key, Item: m.item})
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.closed {
+		return
+	}
+	l.seq++
+	l.entries = append(l.entries, replicationEntry{seq: l.seq, data: data, err: err})
+	if len(l.entries) > l.cfg.Backlog {
+		l.entries = l.entries[len(l.entries)-l.cfg.Backlog:]
+	}
+	close(l.changed)
+	l.changed = make(chan struct{})
+}
+
+// after returns the entries following seq, and a channel closed once more
+// are added. It returns ErrFollowerBehind if entries after seq were dropped.
+func (l *Leader) after(seq uint64) ([]replicationEntry, <-chan struct{}, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.closed {
+		return nil, nil, ErrLeaderClosed
+	}
+	first := l.seq + 1 - uint64(len(l.entries))
+	if seq+1 < first {
+		return nil, nil, ErrFollowerBehind
+	}
+	// Entries are never changed once added, and appends don't write to
+	// the part of the array the returned slice covers.
+	return l.entries[seq+1-first:], l.changed, nil
+}
+
+// Close Stops recording mutations, and makes Serve return ErrLeaderClosed.
+func (l *Leader) Close() {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if !l.closed {
+		l.closed = true
+		l.entries = nil
+		l.c.removeObserver(l.obs)
+		close(l.changed)
+	}
+}
+
+// Serve Replicates the cache to the follower connected with rw, until ctx
+// is done, the leader is closed or the connection fails. The follower
+// receives a snapshot of the cache, unless it can resume from the mutations
+// the leader keeps, followed by every mutation. If rw is an io.Closer, it is
+// closed when ctx is done.
+func (l *Leader) Serve(ctx context.Context, rw io.ReadWriter) error {
+	if cl, ok := rw.(io.Closer); ok {
+		stop := context.AfterFunc(ctx, func() {
+			_ = cl.Close()
+		})
+		defer stop()
+	}
+	hs := make([]byte, len(replicationMagic)+16)
+	if _, err := io.ReadFull(rw, hs); err != nil {
+		return noEOF(err)
+	}
+	if !bytes.Equal(hs[:len(replicationMagic)], replicationMagic) {
+		return errBadReplication
+	}
+	from := replicationPosition{
+		id:  binary.LittleEndian.Uint64(hs[len(replicationMagic):]),
+		seq: binary.LittleEndian.Uint64(hs[len(replicationMagic)+8:]),
+	}
+	bw := bufio.NewWriter(rw)
+	bw.Write(replicationMagic)
+	l.mu.Lock()
+	seq, first := l.seq, l.seq+1-uint64(len(l.entries))
+	closed := l.closed
+	l.mu.Unlock()
+	if closed {
+		return ErrLeaderClosed
+	}
+	resume := from.id == l.id && from.seq+1 >= first && from.seq <= seq
+	if resume {
+		seq = from.seq
+		bw.WriteByte(msgResume)
+	} else {
+		// Mutations after seq are streamed after the snapshot, even if
+		// the snapshot already holds some of them.
+		bw.WriteByte(msgFull)
+	}
+	b := binary.LittleEndian.AppendUint64(nil, l.id)
+	bw.Write(binary.LittleEndian.AppendUint64(b, seq))
+	if !resume {
+		if err := l.c.writeSnapshot(bw); err != nil {
+			return err
+		}
+	}
+	heartbeat := time.NewTicker(l.cfg.Heartbeat)
+	defer heartbeat.Stop()
+	for {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		entries, changed, err := l.after(seq)
+		if err != nil {
+			return err
+		}
+		for _, e := range entries {
+			if e.err != nil {
+				return e.err
+			}
+			b = binary.AppendUvarint(append(b[:0], msgRecord), e.seq)
+			bw.Write(appendBytes(b, e.data))
+			seq = e.seq
+		}
+		if err := bw.Flush(); err != nil {
+			return err
+		}
+		if len(entries) > 0 {
+			continue
+		}
+		select {
+		case <-changed:
+		case <-heartbeat.C:
+			bw.WriteByte(msgHeartbeat)
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
+
+// ServeListener Accepts followers from ln and serves each of them with
+// Serve, until ctx is done, at which point ln and the connections are
+// closed. Errors of single followers are passed to onError, unless it is
+// nil. Returns the error of ln, or of ctx.
+func (l *Leader) ServeListener(ctx context.Context, ln net.Listener, onError func(error)) error {
+	stop := context.AfterFunc(ctx, func() {
+		_ = ln.Close()
+	})
+	defer stop()
+	var wg sync.WaitGroup
+	defer wg.Wait()
+	for {
+		conn, err := ln.Accept()
+		if err != nil {
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+			return err
+		}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			defer conn.Close()
+			if err := l.Serve(ctx, conn); err != nil && ctx.Err() == nil && onError != nil {
+				onError(fmt.Errorf("follower %s: %w", conn.RemoteAddr(), err))
+			}
+		}()
+	}
+}
+
+// FollowerConfig Configuration of a follower, see Cache.Follow.
+type FollowerConfig struct {
+	// Dial connects to a leader, whose Serve must be called with the other
+	// end of the connection. Required.
+	Dial func(ctx context.Context) (io.ReadWriteCloser, error)
+	// MinBackoff is the delay before the first reconnection after a
+	// failure, 100ms if zero. It is doubled after every failed attempt.
+	MinBackoff time.Duration
+	// MaxBackoff is the upper bound of the delay between reconnections,
+	// 10s if zero.
+	MaxBackoff time.Duration
+	// Timeout is the time without any message from the leader after which
+	// the connection is considered lost, 5 times DefaultHeartbeat if zero.
+	// It requires a connection with a SetReadDeadline method, such as a
+	// net.Conn.
+	Timeout time.Duration
+	// OnError is called with the errors of connections to the leader,
+	// which are retried. Such errors are dropped if it is nil.
+	OnError func(error)
+}
+
+// ReadOnly Reports whether the cache follows a leader, in which case its
+// items can't be changed, see Follow.
+func (c *cache) ReadOnly() bool {
+	return c.readOnly.Load()
+}
+
+// Follow Makes the cache a read-only replica of a leader, see Lead, until
+// ctx is done, and returns the error of ctx. The items of the cache are
+// replaced by those of the leader, unless the follower can resume from the
+// mutations the leader keeps. Broken connections are reconnected with
+// exponential backoff.
+//
+// While the cache follows a leader, methods writing to it return ErrReadOnly,
+// or panic with it if they don't return errors, like Set, Delete or Flush,
+// so their callers must check ReadOnly first, or use TrySet, TryDelete and
+// TryFlush, which return it instead. Close and DeleteExpired work as usual:
+// the janitor expires items locally, with the expirations set by the leader.
+// Reads, OnEvent and Watch work as usual, with the replicated mutations.
+// Once Follow returns, the cache is writable again, e.g. to be promoted to a
+// leader. Returns ErrReadOnly if the cache already follows a leader.
+func (c *cache) Follow(ctx context.Context, cfg FollowerConfig) error {
+	if !c.readOnly.CompareAndSwap(false, true) {
+		return ErrReadOnly
+	}
+	defer c.readOnly.Store(false)
+	minBackoff := orDefault(cfg.MinBackoff, 100*time.Millisecond)
+	maxBackoff := orDefault(cfg.MaxBackoff, 10*time.Second)
+	backoff := minBackoff
+	var pos replicationPosition
+	for {
+		applied := pos
+		err := c.followOnce(ctx, cfg, &pos)
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		if err != nil && cfg.OnError != nil {
+			cfg.OnError(err)
+		}
+		if pos != applied {
+			backoff = minBackoff
+		}
+		t := time.NewTimer(backoff)
+		select {
+		case <-t.C:
+		case <-ctx.Done():
+			t.Stop()
+			return ctx.Err()
+		}
+		backoff = min(backoff*2, maxBackoff)
+	}
+}
+
+// orDefault returns d, or def if d isn't positive.
+func orDefault(d, def time.Duration) time.Duration {
+	if d <= 0 {
+		return def
+	}
+	return d
+}
+
+// followOnce connects to the leader and applies its stream until the
+// connection fails, updating pos with every applied mutation.
+func (c *cache) followOnce(ctx context.Context, cfg FollowerConfig, pos *replicationPosition) error {
+	conn, err := cfg.Dial(ctx)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	stop := context.AfterFunc(ctx, func() {
+		_ = conn.Close()
+	})
+	defer stop()
+	deadliner, _ := conn.(interface{ SetReadDeadline(time.Time) error })
+	timeout := orDefault(cfg.Timeout, 5*DefaultHeartbeat)
+	hs := binary.LittleEndian.AppendUint64(append([]byte{}, replicationMagic...), pos.id)
+	if _, err := conn.Write(binary.LittleEndian.AppendUint64(hs, pos.seq)); err != nil {
+		return err
+	}
+	br := bufio.NewReader(conn)
+	magic := make([]byte, len(replicationMagic))
+	if _, err := io.ReadFull(br, magic); err != nil {
+		return noEOF(err)
+	}
+	if !bytes.Equal(magic, replicationMagic) {
+		return errBadReplication
+	}
+	for {
+		if deadliner != nil {
+			if err := deadliner.SetReadDeadline(time.Now().Add(timeout)); err != nil {
+				return err
+			}
+		}
+		tag, err := br.ReadByte()
+		if err != nil {
+			return err
+		}
+		switch tag {
+		case msgFull, msgResume:
+			b := make([]byte, 16)
+			if _, err := io.ReadFull(br, b); err != nil {
+				return noEOF(err)
+			}
+			next := replicationPosition{
+				id:  binary.LittleEndian.Uint64(b),
+				seq: binary.LittleEndian.Uint64(b[8:]),
+			}
+			if tag == msgResume {
+				if next != *pos {
+					return errBadReplication
+				}
+				continue
+			}
+			if deadliner != nil {
+				// Snapshots may take longer than the timeout.
+				if err := deadliner.SetReadDeadline(time.Time{}); err != nil {
+					return err
+				}
+			}
+			if err := c.applySnapshot(br); err != nil {
+				return err
+			}
+			*pos = next
+		case msgRecord:
+			seq, err := binary.ReadUvarint(br)
+			if err != nil {
+				return noEOF(err)
+			}
+			data, err := readBytes(br)
+			if err != nil {
+				return noEOF(err)
+			}
+			if pos.id == 0 || seq != pos.seq+1 {
+				return errBadReplication
+			}
+			rec, err := c.readLogRecord(bytes.NewReader(data))
+			if err != nil {
+				return err
+			}
+			c.applyRecord(rec)
+			pos.seq = seq
+		case msgHeartbeat:
+		default:
+			return errBadReplication
+		}
+	}
+}
+
+// applySnapshot replaces the items of the cache with those of a snapshot
+// read from r. Unexpired items are stored as loaded, other items are
+// deleted.
+func (c *cache) applySnapshot(r *bufio.Reader) error {
+	if _, err := readSnapshotHeader(r); err != nil {
+		return err
+	}
+	items := make(map[string]Item)
+	if err := c.readSnapshotItems(r, func(k string, item Item) {
+		items[k] = item
+	}); err != nil {
+		return err
+	}
+	now := c.timeCache.Load()
+	c.items.Range(func(key, value any) bool {
+		k := key.(string)
+		if item, found := items[k]; !found || item.expired(now) {
+			mu := c.lockKey(k)
+			if tmp, found := c.items.LoadAndDelete(k); found {
+				c.stats.deletes.Add(1)
+				c.emit(mutation{op: opDelete, key: k, item: tmp.(Item)})
+			}
+			mu.Unlock()
+		}
+		return true
+	})
+	for k, item := range items {
+		if item.expired(now) {
+			continue
+		}
+		mu := c.lockKey(k)
+		c.items.Store(k, item)
+		c.emit(mutation{op: opLoad, key: k, item: item})
+		mu.Unlock()
+	}
+	return nil
+}
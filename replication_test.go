@@ -0,0 +1,328 @@
+package cache
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net"
+	"slices"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// waitUntil fails the test if f doesn't return true within a second.
+func waitUntil(t *testing.T, f func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(time.Second)
+	for !f() {
+		if time.Now().After(deadline) {
+			t.Fatal("condition not reached")
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+// pipeDialer connects followers to a leader with net.Pipe.
+type pipeDialer struct {
+	ctx    context.Context
+	leader *Leader
+	mu     sync.Mutex
+	conn   net.Conn
+	dials  int
+}
+
+func (d *pipeDialer) dial(context.Context) (io.ReadWriteCloser, error) {
+	a, b := net.Pipe()
+	go func() {
+		d.leader.Serve(d.ctx, b)
+		b.Close()
+	}()
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.conn = a
+	d.dials++
+	return a, nil
+}
+
+// disconnect closes the current connection and returns the number of dials
+// so far.
+func (d *pipeDialer) disconnect() int {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.conn.Close()
+	return d.dials
+}
+
+func (d *pipeDialer) dialed() int {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return d.dials
+}
+
+// follow starts following the leader of d with f, and returns a function
+// stopping it.
+func follow(t *testing.T, f *Cache, d *pipeDialer) func() {
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error)
+	go func() {
+		done <- f.Follow(ctx, FollowerConfig{Dial: d.dial, MinBackoff: time.Millisecond})
+	}()
+	waitUntil(t, f.readOnly.Load)
+	return func() {
+		cancel()
+		if err := <-done; err != context.Canceled {
+			t.Error("unexpected Follow error:", err)
+		}
+	}
+}
+
+func TestReplication(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	leader := New(DefaultExpiration, 0)
+	defer leader.Close()
+	leader.Set("a", 1, DefaultExpiration)
+	leader.Set("expiring", 1, time.Hour)
+	l := leader.Lead(LeaderConfig{})
+	defer l.Close()
+	follower := New(DefaultExpiration, 0)
+	defer follower.Close()
+	follower.Set("stale", 1, DefaultExpiration)
+	stop := follow(t, follower, &pipeDialer{ctx: ctx, leader: l})
+	defer stop()
+
+	if x, err := follower.WaitFor(ctx, "a"); x != 1 || err != nil {
+		t.Fatal("snapshot was not applied:", x, err)
+	}
+	if _, found := follower.Get("stale"); found {
+		t.Error("item missing from the snapshot was kept")
+	}
+	if _, exp, _ := follower.GetWithExpiration("expiring"); exp.IsZero() {
+		t.Error("expiration was not replicated")
+	}
+	leader.Set("b", "v", DefaultExpiration)
+	leader.Increment("a", 2)
+	leader.Delete("expiring")
+	leader.SAdd("s", "x", "y")
+	waitUntil(t, func() bool {
+		members, _ := follower.SMembers("s")
+		return slices.Equal(members, []string{"x", "y"})
+	})
+	if x, _ := follower.Get("a"); x != 3 {
+		t.Error("increment was not replicated:", x)
+	}
+	if x, _ := follower.Get("b"); x != "v" {
+		t.Error("set was not replicated:", x)
+	}
+	if _, found := follower.Get("expiring"); found {
+		t.Error("delete was not replicated")
+	}
+	leader.Flush()
+	waitUntil(t, func() bool {
+		return follower.ItemCount() == 0
+	})
+}
+
+func TestFollowerReadOnly(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	leader := New(DefaultExpiration, 0)
+	defer leader.Close()
+	l := leader.Lead(LeaderConfig{})
+	defer l.Close()
+	follower := New(DefaultExpiration, 0)
+	defer follower.Close()
+	stop := follow(t, follower, &pipeDialer{ctx: ctx, leader: l})
+	if err := follower.Follow(ctx, FollowerConfig{}); err != ErrReadOnly {
+		t.Error("unexpected error of a second Follow:", err)
+	}
+	if !follower.ReadOnly() {
+		t.Error("follower is not read-only")
+	}
+	for name, f := range map[string]func() error{
+		"Add":       func() error { return follower.Add("k", 1, DefaultExpiration) },
+		"Increment": func() error { return follower.Increment("k", 1) },
+		"Touch":     func() error { return follower.Touch("k", DefaultExpiration) },
+		"TrySet":    func() error { return follower.TrySet("k", 1, DefaultExpiration) },
+		"TryDelete": func() error {
+			_, err := follower.TryDelete("k")
+			return err
+		},
+		"TryFlush": follower.TryFlush,
+		"LPush": func() error {
+			_, err := follower.LPush("k", 1)
+			return err
+		},
+		"HSet": func() error {
+			_, err := follower.HSet("k", "f", "v")
+			return err
+		},
+		"TryLock": func() error {
+			_, err := follower.TryLock("k", time.Minute)
+			return err
+		},
+		"Txn": func() error {
+			return follower.Txn(func(tx *Tx) error {
+				tx.Set("k", 1, DefaultExpiration)
+				return nil
+			})
+		},
+		"GetMultiOrLoad": func() error {
+			_, err := follower.GetMultiOrLoad([]string{"k"}, DefaultExpiration, func([]string) (map[string]any, error) {
+				t.Error("load was called on a follower")
+				return nil, nil
+			})
+			return err
+		},
+	} {
+		if err := f(); err != ErrReadOnly {
+			t.Errorf("%s: unexpected error: %v", name, err)
+		}
+	}
+	// Methods without an error result panic.
+	for name, f := range map[string]func(){
+		"Set":      func() { follower.Set("k", 1, DefaultExpiration) },
+		"Delete":   func() { follower.Delete("k") },
+		"Flush":    func() { follower.Flush() },
+		"SetMulti": func() { follower.SetMulti(map[string]any{"k": 1}, DefaultExpiration) },
+	} {
+		func() {
+			defer func() {
+				if err, _ := recover().(error); !errors.Is(err, ErrReadOnly) {
+					t.Errorf("%s: unexpected panic: %v", name, err)
+				}
+			}()
+			f()
+		}()
+	}
+	if err := follower.Txn(func(tx *Tx) error {
+		tx.Get("k")
+		return nil
+	}); err != nil {
+		t.Error("read-only transaction failed:", err)
+	}
+	stop()
+	if follower.ReadOnly() {
+		t.Error("follower is read-only after Follow returned")
+	}
+	follower.Set("k", 1, DefaultExpiration)
+	if x, _ := follower.Get("k"); x != 1 {
+		t.Error("follower was not writable after Follow returned:", x)
+	}
+}
+
+func TestFollowerResume(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	leader := New(DefaultExpiration, 0)
+	defer leader.Close()
+	leader.Set("a", 1, DefaultExpiration)
+	l := leader.Lead(LeaderConfig{Backlog: 3})
+	defer l.Close()
+	follower := New(DefaultExpiration, 0)
+	defer follower.Close()
+	var loads atomic.Int64
+	follower.OnEvent(func(ev Event) {
+		if ev.Type == EventLoad {
+			loads.Add(1)
+		}
+	})
+	d := &pipeDialer{ctx: ctx, leader: l}
+	stop := follow(t, follower, d)
+	defer stop()
+	follower.WaitFor(ctx, "a")
+	if n := loads.Load(); n != 1 {
+		t.Fatal("unexpected number of loaded items:", n)
+	}
+
+	// Within the backlog, the follower resumes from its position.
+	dials := d.disconnect()
+	leader.Set("b", 2, DefaultExpiration)
+	leader.Delete("a")
+	if x, err := follower.WaitFor(ctx, "b"); x != 2 || err != nil {
+		t.Fatal("mutation was not replicated after reconnection:", x, err)
+	}
+	waitUntil(t, func() bool {
+		_, found := follower.Get("a")
+		return !found
+	})
+	if d.dialed() == dials {
+		t.Error("follower did not reconnect")
+	}
+	if n := loads.Load(); n != 1 {
+		t.Error("snapshot was sent to a follower which could resume:", n)
+	}
+
+	// Beyond the backlog, the follower receives a new snapshot.
+	d.disconnect()
+	for i := range 5 {
+		leader.Set("c", i, DefaultExpiration)
+	}
+	leader.Delete("b")
+	waitUntil(t, func() bool {
+		x, _ := follower.Get("c")
+		_, found := follower.Get("b")
+		return x == 4 && !found
+	})
+	if n := loads.Load(); n != 2 {
+		t.Error("unexpected number of loaded items:", n)
+	}
+}
+
+func TestReplicationLoopback(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Skip("loopback is not available:", err)
+	}
+	leader := New(DefaultExpiration, 0)
+	defer leader.Close()
+	l := leader.Lead(LeaderConfig{Heartbeat: 10 * time.Millisecond})
+	defer l.Close()
+	served := make(chan error)
+	go func() {
+		served <- l.ServeListener(ctx, ln, func(err error) {
+			t.Error(err)
+		})
+	}()
+	followers := []*Cache{New(DefaultExpiration, 0), New(DefaultExpiration, 0)}
+	var wg sync.WaitGroup
+	fctx, fcancel := context.WithCancel(ctx)
+	for _, f := range followers {
+		defer f.Close()
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			f.Follow(fctx, FollowerConfig{
+				Dial: func(ctx context.Context) (io.ReadWriteCloser, error) {
+					var d net.Dialer
+					return d.DialContext(ctx, "tcp", ln.Addr().String())
+				},
+				Timeout: 100 * time.Millisecond,
+				OnError: func(err error) {
+					t.Error(err)
+				},
+			})
+		}()
+	}
+	for i := range 100 {
+		leader.Set("k", i, DefaultExpiration)
+	}
+	for _, f := range followers {
+		waitUntil(t, func() bool {
+			x, _ := f.Get("k")
+			return x == 99
+		})
+	}
+	// Heartbeats keep idle connections alive.
+	time.Sleep(200 * time.Millisecond)
+	fcancel()
+	wg.Wait()
+	cancel()
+	if err := <-served; err != context.Canceled {
+		t.Error("unexpected ServeListener error:", err)
+	}
+}
@@ -0,0 +1,139 @@
+package cache
+
+import (
+	"iter"
+	"strings"
+)
+
+// WithPrefixIndex Maintains a radix tree of the cache's keys, so ScanPrefix,
+// DeletePrefix and ScanMatch/DeleteMatching with patterns starting with a
+// literal prefix visit only the matching keys instead of the whole cache. The
+// index costs memory for every key, and time for every Set and Delete.
+func WithPrefixIndex() Option {
+	return func(o *options) {
+		o.prefixIndex = true
+	}
+}
+
+// scan returns an iterator over the unexpired items with keys having the
+// prefix, and matching match if it isn't nil.
+func (c *cache) scan(prefix string, match func(string) bool) iter.Seq2[string, Item] {
+	if c.index == nil {
+		return func(yield func(string, Item) bool) {
+			for k, v := range c.All() {
+				if strings.HasPrefix(k, prefix) && (match == nil || match(k)) && !yield(k, v) {
+					return
+				}
+			}
+		}
+	}
+	return func(yield func(string, Item) bool) {
+		now := c.timeCache.Load()
+		// The keys are copied, so the cache can be modified while iterating.
+		for _, k := range c.index.keys(prefix) {
+			if match != nil && !match(k) {
+				continue
+			}
+			if v, found := c.getItem(k); found && !v.expired(now) && !yield(k, v) {
+				return
+			}
+		}
+	}
+}
+
+// ScanPrefix Returns an iterator over the unexpired items with keys starting
+// with prefix, with the same consistency as All. If the cache was created
+// with WithPrefixIndex, the keys are yielded in lexical order.
+func (c *cache) ScanPrefix(prefix string) iter.Seq2[string, Item] {
+	return c.scan(prefix, nil)
+}
+
+// ScanMatch Returns an iterator over the unexpired items with keys matching
+// the glob pattern (see MatchGlob), with the same consistency as All.
+func (c *cache) ScanMatch(pattern string) iter.Seq2[string, Item] {
+	return c.scan(globPrefix(pattern), func(k string) bool {
+		return MatchGlob(pattern, k)
+	})
+}
+
+// deleteAll deletes the keys yielded by seq, for which f returns true unless
+// it is nil, calling the OnEvicted function for each of them, and returns the
+// number of deleted items.
+func (c *cache) deleteAll(seq iter.Seq[string], f func(Item) bool) int {
+	c.checkWritable()
+	var evictedItems []kv
+	n := 0
+	for k := range seq {
+		if v, found := c.deleteIf(k, f); found {
+			n++
+			if c.notifiesEvictions() {
+				evictedItems = append(evictedItems, kv{k, v})
+			}
+		}
+	}
+	for _, v := range evictedItems {
+		c.evicted(v.key, v.value)
+	}
+	return n
+}
+
+// DeletePrefix Deletes all unexpired items with keys starting with prefix, as
+// if by Delete, and returns the number of deleted items.
+func (c *cache) DeletePrefix(prefix string) int {
+	return c.deleteAll(keys(c.ScanPrefix(prefix)), nil)
+}
+
+// DeleteMatching Deletes all unexpired items with keys matching the glob
+// pattern (see MatchGlob), as if by Delete, and returns the number of deleted
+// items.
+func (c *cache) DeleteMatching(pattern string) int {
+	return c.deleteAll(keys(c.ScanMatch(pattern)), nil)
+}
+
+// ScanPrefix Returns an iterator over the unexpired items of all shards with
+// keys starting with prefix, see cache.ScanPrefix.
+func (sc *shardedCache) ScanPrefix(prefix string) iter.Seq2[string, Item] {
+	return sc.scan(func(c *cache) iter.Seq2[string, Item] {
+		return c.ScanPrefix(prefix)
+	})
+}
+
+// ScanMatch Returns an iterator over the unexpired items of all shards with
+// keys matching the glob pattern, see cache.ScanMatch.
+func (sc *shardedCache) ScanMatch(pattern string) iter.Seq2[string, Item] {
+	return sc.scan(func(c *cache) iter.Seq2[string, Item] {
+		return c.ScanMatch(pattern)
+	})
+}
+
+func (sc *shardedCache) scan(f func(*cache) iter.Seq2[string, Item]) iter.Seq2[string, Item] {
+	return func(yield func(string, Item) bool) {
+		for _, c := range sc.cs {
+			for k, v := range f(c) {
+				if !yield(k, v) {
+					return
+				}
+			}
+		}
+	}
+}
+
+// DeletePrefix Deletes all unexpired items of all shards with keys starting
+// with prefix, see cache.DeletePrefix.
+func (sc *shardedCache) DeletePrefix(prefix string) int {
+	n := 0
+	for _, c := range sc.cs {
+		n += c.DeletePrefix(prefix)
+	}
+	return n
+}
+
+// DeleteMatching Deletes all unexpired items of all shards with keys matching
+// the glob pattern, see cache.DeleteMatching.
+func (sc *shardedCache) DeleteMatching(pattern string) int {
+	n := 0
+	for _, c := range sc.cs {
+		n += c.DeleteMatching(pattern)
+	}
+	return n
+}
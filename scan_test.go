@@ -0,0 +1,82 @@
+package cache
+
+import (
+	"fmt"
+	"slices"
+	"testing"
+	"time"
+)
+
+func testScan(t *testing.T, tc *Cache) {
+	t.Helper()
+	for i := 0; i < 20; i++ {
+		tc.Set(fmt.Sprintf("user:%d:profile", i), i, NoExpiration)
+		tc.Set(fmt.Sprintf("user:%d:settings", i), i, NoExpiration)
+	}
+	tc.Set("product:1", 1, NoExpiration)
+	tc.Set("user:1:expired", 1, time.Millisecond)
+	<-time.After(5 * time.Millisecond)
+	if keys := CollectKeys(keys(tc.ScanPrefix("user:1:"))); !slices.Equal(keys, []string{"user:1:profile", "user:1:settings"}) {
+		t.Error("unexpected ScanPrefix keys:", keys)
+	}
+	if keys := CollectKeys(keys(tc.ScanMatch("user:1?:profile"))); len(keys) != 10 {
+		t.Error("unexpected ScanMatch keys:", keys)
+	}
+	if keys := CollectKeys(keys(tc.ScanMatch("*:1"))); !slices.Equal(keys, []string{"product:1"}) {
+		t.Error("unexpected ScanMatch keys:", keys)
+	}
+	var evicted []string
+	tc.OnEvicted(func(k string, _ any) {
+		evicted = append(evicted, k)
+	})
+	if n := tc.DeletePrefix("user:1:"); n != 2 || len(evicted) != 2 {
+		t.Error("unexpected DeletePrefix result:", n, evicted)
+	}
+	if n := tc.DeleteMatching("user:*:settings"); n != 19 {
+		t.Error("unexpected DeleteMatching result:", n)
+	}
+	if n := tc.DeleteMatching("user:*"); n != 19 || tc.ItemCount() != 2 {
+		t.Error("unexpected DeleteMatching result:", n, tc.ItemCount())
+	}
+	if _, found := tc.Get("product:1"); !found {
+		t.Error("product:1 was deleted")
+	}
+}
+
+func TestScan(t *testing.T) {
+	tc := New(DefaultExpiration, 0, true)
+	defer tc.Close()
+	testScan(t, tc)
+}
+
+func TestScanWithPrefixIndex(t *testing.T) {
+	tc := NewWithOptions(DefaultExpiration, 0, WithPreciseTime(), WithPrefixIndex())
+	defer tc.Close()
+	testScan(t, tc)
+	tc.Set("b", 1, NoExpiration)
+	tc.Set("a", 1, NoExpiration)
+	if keys := slices.Collect(keys(tc.ScanPrefix(""))); !slices.Equal(keys, []string{"a", "b", "product:1"}) {
+		t.Error("keys are not sorted:", keys)
+	}
+	tc.Flush()
+	if keys := tc.index.keys(""); keys != nil {
+		t.Error("index was not flushed:", keys)
+	}
+}
+
+func TestShardedScan(t *testing.T) {
+	tc := unexportedNewSharded(DefaultExpiration, 0, 4)
+	for i := 0; i < 10; i++ {
+		tc.Set(fmt.Sprintf("a:%d", i), i, DefaultExpiration)
+		tc.Set(fmt.Sprintf("b:%d", i), i, DefaultExpiration)
+	}
+	if keys := CollectKeys(keys(tc.ScanPrefix("a:"))); len(keys) != 10 {
+		t.Error("unexpected ScanPrefix keys:", keys)
+	}
+	if n := tc.DeleteMatching("?:[0-4]"); n != 10 {
+		t.Error("unexpected DeleteMatching result:", n)
+	}
+	if n := tc.DeletePrefix("b:"); n != 5 {
+		t.Error("unexpected DeletePrefix result:", n)
+	}
+}
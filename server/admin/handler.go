@@ -0,0 +1,219 @@
+// Package admin provides a read-only web page for inspecting the contents of
+// a cache.Cache, for use during incidents:
+//
+//	GET /             item count, operation counters and TTL histogram
+//	GET /keys         key list with remaining TTL and value type, searchable
+//	                  with the q query parameter (substring of the key) and
+//	                  paginated with the page query parameter
+//	GET /keys/{key}   value of the key
+//
+// Values are printed with fmt (%#v) unless Handler.Render is set, and are not
+// shown at all if Handler.Redact is set. The handler never modifies the cache.
+package admin
+
+import (
+	"bytes"
+	"cmp"
+	"fmt"
+	"html/template"
+	"net/http"
+	"net/url"
+	"reflect"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/sot-tech/go-cache"
+)
+
+// DefaultPageSize is the default number of keys on a page of the key list.
+const DefaultPageSize = 100
+
+// Handler Read-only HTTP handler of a cache.
+type Handler struct {
+	c   *cache.Cache
+	mux *http.ServeMux
+	// PageSize is the number of keys on a page of the key list,
+	// DefaultPageSize if zero.
+	PageSize int
+	// Render, if set, returns the text shown for the value x of the key k,
+	// instead of fmt's %#v.
+	Render func(k string, x any) string
+	// Redact hides values, only their types are shown.
+	Redact bool
+}
+
+// New Returns a handler of the cache c. The handler expects paths relative to
+// its root, use http.StripPrefix to mount it under another path.
+func New(c *cache.Cache) *Handler {
+	h := &Handler{c: c, mux: http.NewServeMux()}
+	h.mux.HandleFunc("GET /{$}", h.overview)
+	h.mux.HandleFunc("GET /keys", h.keys)
+	h.mux.HandleFunc("GET /keys/{key}", h.value)
+	return h
+}
+
+func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	h.mux.ServeHTTP(w, r)
+}
+
+type ttlBucket struct {
+	limit time.Duration
+	label string
+}
+
+// ttlBuckets are the upper bounds of the TTL histogram buckets.
+var ttlBuckets = []ttlBucket{
+	{time.Second, "1s"},
+	{10 * time.Second, "10s"},
+	{time.Minute, "1m"},
+	{10 * time.Minute, "10m"},
+	{time.Hour, "1h"},
+	{24 * time.Hour, "1d"},
+}
+
+type bucket struct {
+	Label string
+	Count int
+	// Percent is the share of the bucket in all items, for bar widths.
+	Percent int
+}
+
+// histogram groups items by remaining TTL.
+func histogram(items map[string]cache.Item, now time.Time) []bucket {
+	counts := make([]int, len(ttlBuckets)+2)
+	for _, v := range items {
+		if v.Expiration <= 0 {
+			counts[len(counts)-1]++
+			continue
+		}
+		ttl := time.Unix(0, v.Expiration).Sub(now)
+		i, _ := slices.BinarySearchFunc(ttlBuckets, ttl, func(b ttlBucket, ttl time.Duration) int {
+			return cmp.Compare(b.limit, ttl)
+		})
+		counts[i]++
+	}
+	buckets := make([]bucket, len(counts))
+	for i, n := range counts {
+		switch {
+		case i < len(ttlBuckets):
+			buckets[i].Label = "< " + ttlBuckets[i].label
+		case i == len(ttlBuckets):
+			buckets[i].Label = "≥ " + ttlBuckets[i-1].label
+		default:
+			buckets[i].Label = "never"
+		}
+		buckets[i].Count = n
+		if len(items) > 0 {
+			buckets[i].Percent = n * 100 / len(items)
+		}
+	}
+	return buckets
+}
+
+func (h *Handler) overview(w http.ResponseWriter, _ *http.Request) {
+	items := h.c.Items()
+	render(w, overviewTemplate, struct {
+		Root      string
+		Items     int
+		Stats     cache.Stats
+		Histogram []bucket
+	}{"./", len(items), h.c.Stats(), histogram(items, time.Now())})
+}
+
+type keyInfo struct {
+	Key  string
+	TTL  string
+	Type string
+}
+
+func ttlString(exp int64, now time.Time) string {
+	if exp <= 0 {
+		return "never"
+	}
+	return time.Unix(0, exp).Sub(now).Truncate(time.Millisecond).String()
+}
+
+func typeName(x any) string {
+	if x == nil {
+		return "nil"
+	}
+	return reflect.TypeOf(x).String()
+}
+
+func (h *Handler) keys(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query().Get("q")
+	page, err := strconv.Atoi(r.URL.Query().Get("page"))
+	if err != nil || page < 1 {
+		page = 1
+	}
+	size := h.PageSize
+	if size <= 0 {
+		size = DefaultPageSize
+	}
+	items := h.c.Items()
+	keys := make([]string, 0, len(items))
+	for k := range items {
+		if strings.Contains(k, q) {
+			keys = append(keys, k)
+		}
+	}
+	slices.Sort(keys)
+	pages := max((len(keys)+size-1)/size, 1)
+	page = min(page, pages)
+	now := time.Now()
+	list := make([]keyInfo, 0, size)
+	for _, k := range keys[min((page-1)*size, len(keys)):min(page*size, len(keys))] {
+		v := items[k]
+		list = append(list, keyInfo{Key: k, TTL: ttlString(v.Expiration, now), Type: typeName(v.Object)})
+	}
+	pageURL := func(p int) string {
+		if p < 1 || p > pages {
+			return ""
+		}
+		return "?" + url.Values{"q": {q}, "page": {strconv.Itoa(p)}}.Encode()
+	}
+	render(w, keysTemplate, struct {
+		Root        string
+		Query       string
+		Total       int
+		Page, Pages int
+		Prev, Next  string
+		Keys        []keyInfo
+	}{"./", q, len(keys), page, pages, pageURL(page - 1), pageURL(page + 1), list})
+}
+
+func (h *Handler) value(w http.ResponseWriter, r *http.Request) {
+	k := r.PathValue("key")
+	item, found := h.c.Peek(k)
+	if !found {
+		http.Error(w, cache.ErrNotExists.Error(), http.StatusNotFound)
+		return
+	}
+	x := item.Object
+	var dump string
+	switch {
+	case h.Redact:
+		dump = "[redacted]"
+	case h.Render != nil:
+		dump = h.Render(k, x)
+	default:
+		dump = fmt.Sprintf("%#v", x)
+	}
+	render(w, valueTemplate, struct {
+		Root string
+		Key  keyInfo
+		Dump string
+	}{"../", keyInfo{Key: k, TTL: ttlString(item.Expiration, time.Now()), Type: typeName(x)}, dump})
+}
+
+func render(w http.ResponseWriter, t *template.Template, data any) {
+	var buf bytes.Buffer
+	if err := t.Execute(&buf, data); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	_, _ = buf.WriteTo(w)
+}
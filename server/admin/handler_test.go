@@ -0,0 +1,101 @@
+package admin
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/sot-tech/go-cache"
+)
+
+func get(t *testing.T, h http.Handler, target string) (int, string) {
+	t.Helper()
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest("GET", target, nil))
+	return w.Code, w.Body.String()
+}
+
+func TestOverview(t *testing.T) {
+	c := cache.New(cache.NoExpiration, 0)
+	defer c.Close()
+	c.Set("a", 1, cache.NoExpiration)
+	c.Set("b", 2, 30*time.Second)
+	c.Set("c", 3, 2*time.Hour)
+	c.Get("a")
+	h := New(c)
+	code, body := get(t, h, "/")
+	if code != http.StatusOK {
+		t.Fatal("unexpected status:", code)
+	}
+	for _, s := range []string{
+		"<th>Items</th><td>3</td>",
+		"<th>Hits</th><td>1</td>",
+		"<th>&lt; 1m</th><td>1</td>",
+		"<th>&lt; 1d</th><td>1</td>",
+		"<th>never</th><td>1</td>",
+	} {
+		if !strings.Contains(body, s) {
+			t.Errorf("overview doesn't contain %q", s)
+		}
+	}
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest("DELETE", "/keys/a", nil))
+	if w.Code != http.StatusMethodNotAllowed {
+		t.Error("DELETE was allowed:", w.Code)
+	}
+}
+
+func TestKeys(t *testing.T) {
+	c := cache.New(cache.NoExpiration, 0)
+	defer c.Close()
+	for i := 0; i < 25; i++ {
+		c.Set(fmt.Sprintf("user:%02d", i), i, cache.NoExpiration)
+	}
+	c.Set("other", "x", time.Minute)
+	h := New(c)
+	h.PageSize = 10
+	_, body := get(t, h, "/keys?q=user&page=3")
+	if !strings.Contains(body, "25 keys, page 3 of 3") {
+		t.Error("unexpected pagination:", body)
+	}
+	if !strings.Contains(body, "user:24") || strings.Contains(body, "user:19") || strings.Contains(body, "other") {
+		t.Error("unexpected keys on page 3:", body)
+	}
+	if !strings.Contains(body, `href="?page=2&amp;q=user"`) {
+		t.Error("no link to the previous page:", body)
+	}
+	_, body = get(t, h, "/keys?q=oth")
+	if !strings.Contains(body, "<td>string</td>") || !strings.Contains(body, "<td>59") {
+		t.Error("unexpected TTL or type:", body)
+	}
+}
+
+func TestValue(t *testing.T) {
+	c := cache.New(cache.NoExpiration, 0)
+	defer c.Close()
+	c.Set("a/b", map[string]int{"x": 1}, cache.NoExpiration)
+	h := New(c)
+	if code, _ := get(t, h, "/keys/missing"); code != http.StatusNotFound {
+		t.Error("unexpected status for missing key:", code)
+	}
+	_, body := get(t, h, "/keys/a%2Fb")
+	if !strings.Contains(body, "map[string]int{&#34;x&#34;:1}") {
+		t.Error("unexpected value dump:", body)
+	}
+	h.Render = func(k string, x any) string {
+		return k + " rendered"
+	}
+	if _, body = get(t, h, "/keys/a%2Fb"); !strings.Contains(body, "a/b rendered") {
+		t.Error("Render was not used:", body)
+	}
+	h.Redact = true
+	if _, body = get(t, h, "/keys/a%2Fb"); strings.Contains(body, "rendered") || !strings.Contains(body, "[redacted]") {
+		t.Error("value was not redacted:", body)
+	}
+	if s := c.Stats(); s.Hits != 0 || s.Misses != 0 {
+		t.Errorf("lookups were counted: %d hits, %d misses", s.Hits, s.Misses)
+	}
+}
@@ -0,0 +1,58 @@
+package admin
+
+import (
+	"html/template"
+	"net/url"
+)
+
+// header links to the overview and the key list relative to the page, so
+// the handler works under any prefix. Root is "./" or "../".
+const header = `<!DOCTYPE html>
+<html><head><meta charset="utf-8"><title>cache</title>
+<style>
+body{font-family:sans-serif;margin:2em}
+table{border-collapse:collapse}
+td,th{padding:2px 8px;text-align:left;border-bottom:1px solid #ddd}
+.bar{background:#69c;height:1em}
+pre{background:#f4f4f4;padding:1em;overflow:auto}
+</style></head><body>
+<p><a href="{{.Root}}">overview</a> | <a href="{{.Root}}keys">keys</a></p>
+`
+
+const footer = `</body></html>
+`
+
+var overviewTemplate = template.Must(template.New("overview").Parse(header + `
+<h1>Cache</h1>
+<table>
+<tr><th>Items</th><td>{{.Items}}</td></tr>
+<tr><th>Hits</th><td>{{.Stats.Hits}}</td></tr>
+<tr><th>Misses</th><td>{{.Stats.Misses}}</td></tr>
+<tr><th>Sets</th><td>{{.Stats.Sets}}</td></tr>
+<tr><th>Deletes</th><td>{{.Stats.Deletes}}</td></tr>
+<tr><th>Expirations</th><td>{{.Stats.Expirations}}</td></tr>
+<tr><th>Flushes</th><td>{{.Stats.Flushes}}</td></tr>
+</table>
+<h2>TTL distribution</h2>
+<table>
+{{range .Histogram}}<tr><th>{{.Label}}</th><td>{{.Count}}</td><td style="width:300px"><div class="bar" style="width:{{.Percent}}%"></div></td></tr>
+{{end}}</table>
+` + footer))
+
+var keysTemplate = template.Must(template.New("keys").Funcs(template.FuncMap{"pathEscape": url.PathEscape}).Parse(header + `
+<h1>Keys</h1>
+<form method="get"><input name="q" value="{{.Query}}" placeholder="key substring"> <input type="submit" value="search"></form>
+<p>{{.Total}} keys, page {{.Page}} of {{.Pages}}
+{{with .Prev}}<a href="{{.}}">previous</a>{{end}}
+{{with .Next}}<a href="{{.}}">next</a>{{end}}</p>
+<table>
+<tr><th>Key</th><th>TTL</th><th>Type</th></tr>
+{{range .Keys}}<tr><td><a href="{{$.Root}}keys/{{pathEscape .Key}}">{{.Key}}</a></td><td>{{.TTL}}</td><td>{{.Type}}</td></tr>
+{{end}}</table>
+` + footer))
+
+var valueTemplate = template.Must(template.New("value").Parse(header + `
+<h1>{{.Key.Key}}</h1>
+<p>TTL: {{.Key.TTL}}, type: {{.Key.Type}}</p>
+<pre>{{.Dump}}</pre>
+` + footer))
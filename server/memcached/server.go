@@ -0,0 +1,676 @@
+// Package memcached serves a cache.Cache over TCP using the memcached text
+// protocol, so clients in other languages can share an in-process cache.
+//
+// Supported commands are get, gets, set, add, replace, delete, incr, decr,
+// touch, flush_all, stats, version and quit. Values stored by the server are
+// []byte if the client sets no flags, and Value otherwise. Values stored by Go
+// code are served if they are []byte, string, Value or numbers, other values
+// are reported as missing. Writes to a cache which follows a leader (see
+// cache.Cache.Follow) are rejected with a SERVER_ERROR.
+package memcached
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"hash/fnv"
+	"io"
+	"net"
+	"os"
+	"reflect"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/sot-tech/go-cache"
+)
+
+// Value Item value with non-zero memcached flags.
+type Value struct {
+	Flags uint32
+	Data  []byte
+}
+
+const (
+	// DefaultMaxItemSize is the default limit of value size.
+	DefaultMaxItemSize = 1 << 20
+	// maxLineSize is the limit of command line length.
+	maxLineSize = 2048
+	// maxKeySize is the limit of key length, as in memcached.
+	maxKeySize = 250
+	// maxRelativeExptime is the largest exptime which is treated as an offset
+	// from the current time, larger values are unix timestamps.
+	maxRelativeExptime = 60 * 60 * 24 * 30
+	// errReadOnly is the reply to writes to a cache which follows a leader.
+	errReadOnly = "SERVER_ERROR cache is read-only\r\n"
+)
+
+var (
+	ErrServerClosed = errors.New("memcached: server closed")
+
+	errLineTooLong = errors.New("line too long")
+	errBadChunk    = errors.New("bad data chunk")
+	errNonNumeric  = errors.New("cannot increment or decrement non-numeric value")
+	errBadFormat   = errors.New("bad command line format")
+)
+
+// Server Memcached protocol server of a cache.
+type Server struct {
+	c *cache.Cache
+	// MaxItemSize is the limit of value size, DefaultMaxItemSize if zero.
+	MaxItemSize int
+
+	started time.Time
+	stats   stats
+
+	mu        sync.Mutex
+	closed    bool
+	flushes   *time.Timer // delayed flush_all
+	listeners map[net.Listener]struct{}
+	conns     map[net.Conn]struct{}
+	wg        sync.WaitGroup
+}
+
+type stats struct {
+	currConns, totalConns                      atomic.Int64
+	cmdGet, cmdSet, cmdTouch, cmdFlush         atomic.Uint64
+	getHits, getMisses                         atomic.Uint64
+	deleteHits, deleteMisses                   atomic.Uint64
+	incrHits, incrMisses, decrHits, decrMisses atomic.Uint64
+	touchHits, touchMisses                     atomic.Uint64
+}
+
+// New Returns a server of the cache c.
+func New(c *cache.Cache) *Server {
+	return &Server{
+		c:         c,
+		started:   time.Now(),
+		listeners: make(map[net.Listener]struct{}),
+		conns:     make(map[net.Conn]struct{}),
+	}
+}
+
+// ListenAndServe Listens on the TCP address and serves connections, see Serve.
+func (s *Server) ListenAndServe(addr string) error {
+	l, err := net.Listen("tcp", addr)
+	if err != nil {
+		return err
+	}
+	return s.Serve(l)
+}
+
+// Serve Accepts connections on l and serves each of them in a new goroutine.
+// It blocks until l fails or the server is closed, in which case it returns
+// ErrServerClosed.
+func (s *Server) Serve(l net.Listener) error {
+	s.mu.Lock()
+	if s.closed {
+		s.mu.Unlock()
+		_ = l.Close()
+		return ErrServerClosed
+	}
+	s.listeners[l] = struct{}{}
+	s.mu.Unlock()
+	defer func() {
+		s.mu.Lock()
+		delete(s.listeners, l)
+		s.mu.Unlock()
+	}()
+	for {
+		conn, err := l.Accept()
+		if err != nil {
+			s.mu.Lock()
+			closed := s.closed
+			s.mu.Unlock()
+			if closed {
+				return ErrServerClosed
+			}
+			return err
+		}
+		s.mu.Lock()
+		if s.closed {
+			s.mu.Unlock()
+			_ = conn.Close()
+			return ErrServerClosed
+		}
+		s.conns[conn] = struct{}{}
+		s.wg.Add(1)
+		s.mu.Unlock()
+		go s.serveConn(conn)
+	}
+}
+
+// Close Closes all listeners and connections of the server, cancels a
+// delayed flush_all and waits until connection goroutines exit. The cache is
+// not closed.
+func (s *Server) Close() error {
+	s.mu.Lock()
+	s.closed = true
+	if s.flushes != nil {
+		s.flushes.Stop()
+	}
+	var err error
+	for l := range s.listeners {
+		err = errors.Join(err, l.Close())
+	}
+	for conn := range s.conns {
+		_ = conn.Close()
+	}
+	s.mu.Unlock()
+	s.wg.Wait()
+	return err
+}
+
+func (s *Server) serveConn(conn net.Conn) {
+	defer s.wg.Done()
+	defer func() {
+		s.mu.Lock()
+		delete(s.conns, conn)
+		s.mu.Unlock()
+		_ = conn.Close()
+		s.stats.currConns.Add(-1)
+	}()
+	s.stats.currConns.Add(1)
+	s.stats.totalConns.Add(1)
+	r := bufio.NewReader(conn)
+	w := bufio.NewWriter(conn)
+	for {
+		line, err := readLine(r)
+		if err != nil {
+			if errors.Is(err, errLineTooLong) {
+				writeError(w, err)
+				_ = w.Flush()
+			}
+			return
+		}
+		if quit := s.handle(r, w, line); quit {
+			_ = w.Flush()
+			return
+		}
+		// Replies to pipelined commands are sent together.
+		if r.Buffered() == 0 {
+			if err = w.Flush(); err != nil {
+				return
+			}
+		}
+	}
+}
+
+func readLine(r *bufio.Reader) ([]byte, error) {
+	line, err := r.ReadSlice('\n')
+	if errors.Is(err, bufio.ErrBufferFull) || len(line) > maxLineSize {
+		return nil, errLineTooLong
+	}
+	if err != nil {
+		return nil, err
+	}
+	return bytes.TrimRight(line, "\r\n"), nil
+}
+
+func writeError(w *bufio.Writer, err error) {
+	_, _ = w.WriteString("CLIENT_ERROR " + err.Error() + "\r\n")
+}
+
+// handle executes the command line and writes its reply to w. It returns
+// true if the connection should be closed.
+func (s *Server) handle(r *bufio.Reader, w *bufio.Writer, line []byte) bool {
+	fields := bytes.Fields(line)
+	if len(fields) == 0 {
+		_, _ = w.WriteString("ERROR\r\n")
+		return false
+	}
+	cmd, args := string(fields[0]), fields[1:]
+	noreply := len(args) > 0 && string(args[len(args)-1]) == "noreply"
+	reply := func(msg string) {
+		if !noreply {
+			_, _ = w.WriteString(msg)
+		}
+	}
+	var err error
+	switch cmd {
+	case "delete", "incr", "decr", "touch", "flush_all":
+		if s.c.ReadOnly() {
+			reply(errReadOnly)
+			return false
+		}
+	}
+	switch cmd {
+	case "get", "gets":
+		err = s.get(w, args, cmd == "gets")
+	case "set", "add", "replace":
+		var msg string
+		if msg, err = s.store(r, cmd, args); err == nil {
+			reply(msg)
+		} else if errors.Is(err, errBadChunk) || errors.Is(err, io.ErrUnexpectedEOF) {
+			writeError(w, errBadChunk)
+			return true
+		}
+	case "delete":
+		err = s.delete(args, reply)
+	case "incr", "decr":
+		err = s.incr(args, cmd == "decr", reply)
+	case "touch":
+		err = s.touch(args, reply)
+	case "flush_all":
+		err = s.flush(args, reply)
+	case "stats":
+		s.writeStats(w)
+	case "version":
+		_, _ = w.WriteString("VERSION go-cache\r\n")
+	case "quit":
+		return true
+	default:
+		_, _ = w.WriteString("ERROR\r\n")
+	}
+	switch {
+	case errors.Is(err, cache.ErrReadOnly):
+		// The cache started following a leader since it was checked.
+		reply(errReadOnly)
+	case err != nil:
+		writeError(w, err)
+	}
+	return false
+}
+
+func validKey(k []byte) bool {
+	if len(k) == 0 || len(k) > maxKeySize {
+		return false
+	}
+	for _, b := range k {
+		if b <= ' ' || b == 0x7f {
+			return false
+		}
+	}
+	return true
+}
+
+// expiration converts memcached exptime into cache duration. The second
+// result is false if the item is expired already.
+func expiration(exptime int64) (time.Duration, bool) {
+	switch {
+	case exptime == 0:
+		return cache.NoExpiration, true
+	case exptime < 0:
+		return 0, false
+	case exptime <= maxRelativeExptime:
+		return time.Duration(exptime) * time.Second, true
+	default:
+		d := time.Until(time.Unix(exptime, 0))
+		return d, d > 0
+	}
+}
+
+// encode returns flags and data of a cache value, and false if the value
+// can't be represented in the protocol.
+func encode(x any) (uint32, []byte, bool) {
+	switch v := x.(type) {
+	case []byte:
+		return 0, v, true
+	case string:
+		return 0, []byte(v), true
+	case Value:
+		return v.Flags, v.Data, true
+	case *Value:
+		return v.Flags, v.Data, true
+	}
+	rv := reflect.ValueOf(x)
+	switch rv.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return 0, strconv.AppendInt(nil, rv.Int(), 10), true
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		return 0, strconv.AppendUint(nil, rv.Uint(), 10), true
+	case reflect.Float32, reflect.Float64:
+		return 0, strconv.AppendFloat(nil, rv.Float(), 'g', -1, rv.Type().Bits()), true
+	}
+	return 0, nil, false
+}
+
+// casUnique derives the value reported by gets from the item content. The
+// cas command is not supported, the value only lets clients detect changes.
+func casUnique(flags uint32, data []byte) uint64 {
+	h := fnv.New64a()
+	_, _ = h.Write(strconv.AppendUint(nil, uint64(flags), 10))
+	_, _ = h.Write(data)
+	return h.Sum64()
+}
+
+func (s *Server) get(w *bufio.Writer, keys [][]byte, withCas bool) error {
+	if len(keys) == 0 {
+		return errBadFormat
+	}
+	for _, k := range keys {
+		s.stats.cmdGet.Add(1)
+		x, found := s.c.Get(string(k))
+		var flags uint32
+		var data []byte
+		if found {
+			flags, data, found = encode(x)
+		}
+		if !found {
+			s.stats.getMisses.Add(1)
+			continue
+		}
+		s.stats.getHits.Add(1)
+		b := make([]byte, 0, len(k)+len(data)+64)
+		b = append(b, "VALUE "...)
+		b = append(b, k...)
+		b = append(b, ' ')
+		b = strconv.AppendUint(b, uint64(flags), 10)
+		b = append(b, ' ')
+		b = strconv.AppendInt(b, int64(len(data)), 10)
+		if withCas {
+			b = append(b, ' ')
+			b = strconv.AppendUint(b, casUnique(flags, data), 10)
+		}
+		b = append(b, "\r\n"...)
+		b = append(b, data...)
+		b = append(b, "\r\n"...)
+		_, _ = w.Write(b)
+	}
+	_, _ = w.WriteString("END\r\n")
+	return nil
+}
+
+func (s *Server) store(r *bufio.Reader, cmd string, args [][]byte) (string, error) {
+	if len(args) < 4 || len(args) > 5 {
+		return "", errBadFormat
+	}
+	flags, err := strconv.ParseUint(string(args[1]), 10, 32)
+	if err != nil {
+		return "", errBadFormat
+	}
+	exptime, err := strconv.ParseInt(string(args[2]), 10, 64)
+	if err != nil {
+		return "", errBadFormat
+	}
+	size, err := strconv.Atoi(string(args[3]))
+	if err != nil || size < 0 {
+		return "", errBadFormat
+	}
+	maxSize := s.MaxItemSize
+	if maxSize <= 0 {
+		maxSize = DefaultMaxItemSize
+	}
+	if size > maxSize {
+		if _, err = r.Discard(size + 2); err != nil {
+			return "", io.ErrUnexpectedEOF
+		}
+		return "SERVER_ERROR object too large for cache\r\n", nil
+	}
+	data := make([]byte, size+2)
+	if _, err = io.ReadFull(r, data); err != nil {
+		return "", io.ErrUnexpectedEOF
+	}
+	if !bytes.HasSuffix(data, []byte("\r\n")) {
+		return "", errBadChunk
+	}
+	data = data[:size]
+	k := args[0]
+	if !validKey(k) {
+		return "", errBadFormat
+	}
+	if s.c.ReadOnly() {
+		return errReadOnly, nil
+	}
+	s.stats.cmdSet.Add(1)
+
+	var x any = data
+	if flags != 0 {
+		x = Value{Flags: uint32(flags), Data: data}
+	}
+	d, alive := expiration(exptime)
+	key := string(k)
+	switch cmd {
+	case "set":
+		if !alive {
+			_, err = s.c.TryDelete(key)
+		} else {
+			err = s.c.TrySet(key, x, d)
+		}
+		if err != nil {
+			return "", err
+		}
+	case "add":
+		if !alive {
+			if _, found := s.c.Get(key); found {
+				return "NOT_STORED\r\n", nil
+			}
+		} else if err = s.c.Add(key, x, d); errors.Is(err, cache.ErrReadOnly) {
+			return "", err
+		} else if err != nil {
+			return "NOT_STORED\r\n", nil
+		}
+	case "replace":
+		if !alive {
+			if _, found := s.c.Get(key); !found {
+				return "NOT_STORED\r\n", nil
+			}
+			if _, err = s.c.TryDelete(key); err != nil {
+				return "", err
+			}
+		} else if err = s.c.Replace(key, x, d); errors.Is(err, cache.ErrReadOnly) {
+			return "", err
+		} else if err != nil {
+			return "NOT_STORED\r\n", nil
+		}
+	}
+	return "STORED\r\n", nil
+}
+
+func (s *Server) delete(args [][]byte, reply func(string)) error {
+	if len(args) < 1 || len(args) > 2 || (len(args) == 2 && string(args[1]) != "noreply") {
+		return errBadFormat
+	}
+	found, err := s.c.TryDelete(string(args[0]))
+	if err != nil {
+		return err
+	}
+	if !found {
+		s.stats.deleteMisses.Add(1)
+		reply("NOT_FOUND\r\n")
+		return nil
+	}
+	s.stats.deleteHits.Add(1)
+	reply("DELETED\r\n")
+	return nil
+}
+
+func (s *Server) incr(args [][]byte, decr bool, reply func(string)) error {
+	if len(args) < 2 || len(args) > 3 {
+		return errBadFormat
+	}
+	delta, err := strconv.ParseUint(string(args[1]), 10, 64)
+	if err != nil {
+		return errors.New("invalid numeric delta argument")
+	}
+	var result []byte
+	err = s.c.Modify(string(args[0]), func(x any) (any, error) {
+		var nx any
+		nx, result = incrValue(x, delta, decr)
+		if nx == nil {
+			return nil, errNonNumeric
+		}
+		return nx, nil
+	})
+	hits, misses := &s.stats.incrHits, &s.stats.incrMisses
+	if decr {
+		hits, misses = &s.stats.decrHits, &s.stats.decrMisses
+	}
+	switch {
+	case errors.Is(err, cache.ErrNotExists):
+		misses.Add(1)
+		reply("NOT_FOUND\r\n")
+	case err != nil:
+		return err
+	default:
+		hits.Add(1)
+		reply(string(result) + "\r\n")
+	}
+	return nil
+}
+
+// incrValue applies incr or decr to a cache value. Textual values follow
+// memcached semantics: they are unsigned 64-bit decimals, incr wraps around
+// and decr stops at zero. Numeric Go values are changed the same way as by
+// cache.Increment and cache.Decrement. It returns nil if the value is not
+// numeric.
+func incrValue(x any, delta uint64, decr bool) (any, []byte) {
+	text := func(data []byte) (uint64, bool) {
+		n, err := strconv.ParseUint(string(bytes.TrimSpace(data)), 10, 64)
+		if err != nil {
+			return 0, false
+		}
+		switch {
+		case !decr:
+			n += delta
+		case delta > n:
+			n = 0
+		default:
+			n -= delta
+		}
+		return n, true
+	}
+	switch v := x.(type) {
+	case []byte:
+		if n, ok := text(v); ok {
+			b := strconv.AppendUint(nil, n, 10)
+			return b, b
+		}
+		return nil, nil
+	case string:
+		if n, ok := text([]byte(v)); ok {
+			b := strconv.AppendUint(nil, n, 10)
+			return string(b), b
+		}
+		return nil, nil
+	case Value:
+		if n, ok := text(v.Data); ok {
+			b := strconv.AppendUint(nil, n, 10)
+			return Value{Flags: v.Flags, Data: b}, b
+		}
+		return nil, nil
+	}
+	rv := reflect.ValueOf(x)
+	if !rv.IsValid() {
+		return nil, nil
+	}
+	nv := reflect.New(rv.Type()).Elem()
+	switch rv.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		if decr {
+			nv.SetInt(rv.Int() - int64(delta))
+		} else {
+			nv.SetInt(rv.Int() + int64(delta))
+		}
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		if decr {
+			nv.SetUint(rv.Uint() - delta)
+		} else {
+			nv.SetUint(rv.Uint() + delta)
+		}
+	default:
+		return nil, nil
+	}
+	_, b, _ := encode(nv.Interface())
+	return nv.Interface(), b
+}
+
+func (s *Server) touch(args [][]byte, reply func(string)) error {
+	if len(args) < 2 || len(args) > 3 {
+		return errBadFormat
+	}
+	exptime, err := strconv.ParseInt(string(args[1]), 10, 64)
+	if err != nil {
+		return errBadFormat
+	}
+	s.stats.cmdTouch.Add(1)
+	k := string(args[0])
+	d, alive := expiration(exptime)
+	if !alive {
+		var found bool
+		if found, err = s.c.TryDelete(k); err == nil && !found {
+			err = cache.ErrNotExists
+		}
+	} else {
+		err = s.c.Touch(k, d)
+	}
+	if errors.Is(err, cache.ErrReadOnly) {
+		return err
+	}
+	if err != nil {
+		s.stats.touchMisses.Add(1)
+		reply("NOT_FOUND\r\n")
+	} else {
+		s.stats.touchHits.Add(1)
+		reply("TOUCHED\r\n")
+	}
+	return nil
+}
+
+func (s *Server) flush(args [][]byte, reply func(string)) error {
+	if len(args) > 2 {
+		return errBadFormat
+	}
+	var delay int64
+	if len(args) > 0 && string(args[0]) != "noreply" {
+		var err error
+		if delay, err = strconv.ParseInt(string(args[0]), 10, 64); err != nil {
+			return errBadFormat
+		}
+	}
+	s.stats.cmdFlush.Add(1)
+	// As in memcached, the last flush_all replaces a delayed one.
+	s.mu.Lock()
+	if s.flushes != nil {
+		s.flushes.Stop()
+		s.flushes = nil
+	}
+	if delay > 0 && !s.closed {
+		s.flushes = time.AfterFunc(time.Duration(delay)*time.Second, func() {
+			// The flush is dropped if the cache follows a leader by then.
+			_ = s.c.TryFlush()
+		})
+	}
+	s.mu.Unlock()
+	if delay <= 0 {
+		if err := s.c.TryFlush(); err != nil {
+			return err
+		}
+	}
+	reply("OK\r\n")
+	return nil
+}
+
+func (s *Server) writeStats(w *bufio.Writer) {
+	now := time.Now()
+	for _, st := range []struct {
+		name  string
+		value string
+	}{
+		{"pid", strconv.Itoa(os.Getpid())},
+		{"uptime", strconv.FormatInt(int64(now.Sub(s.started)/time.Second), 10)},
+		{"time", strconv.FormatInt(now.Unix(), 10)},
+		{"version", "go-cache"},
+		{"curr_connections", strconv.FormatInt(s.stats.currConns.Load(), 10)},
+		{"total_connections", strconv.FormatInt(s.stats.totalConns.Load(), 10)},
+		{"cmd_get", strconv.FormatUint(s.stats.cmdGet.Load(), 10)},
+		{"cmd_set", strconv.FormatUint(s.stats.cmdSet.Load(), 10)},
+		{"cmd_flush", strconv.FormatUint(s.stats.cmdFlush.Load(), 10)},
+		{"cmd_touch", strconv.FormatUint(s.stats.cmdTouch.Load(), 10)},
+		{"get_hits", strconv.FormatUint(s.stats.getHits.Load(), 10)},
+		{"get_misses", strconv.FormatUint(s.stats.getMisses.Load(), 10)},
+		{"delete_hits", strconv.FormatUint(s.stats.deleteHits.Load(), 10)},
+		{"delete_misses", strconv.FormatUint(s.stats.deleteMisses.Load(), 10)},
+		{"incr_hits", strconv.FormatUint(s.stats.incrHits.Load(), 10)},
+		{"incr_misses", strconv.FormatUint(s.stats.incrMisses.Load(), 10)},
+		{"decr_hits", strconv.FormatUint(s.stats.decrHits.Load(), 10)},
+		{"decr_misses", strconv.FormatUint(s.stats.decrMisses.Load(), 10)},
+		{"touch_hits", strconv.FormatUint(s.stats.touchHits.Load(), 10)},
+		{"touch_misses", strconv.FormatUint(s.stats.touchMisses.Load(), 10)},
+		{"curr_items", strconv.Itoa(s.c.ItemCount())},
+	} {
+		_, _ = w.WriteString("STAT " + st.name + " " + st.value + "\r\n")
+	}
+	_, _ = w.WriteString("END\r\n")
+}
@@ -0,0 +1,232 @@
+package memcached
+
+import (
+	"bufio"
+	"context"
+	"io"
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/sot-tech/go-cache"
+)
+
+func startServer(t *testing.T) (*cache.Cache, net.Conn, *bufio.Reader) {
+	t.Helper()
+	c := cache.New(cache.DefaultExpiration, 0)
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := New(c)
+	go func() {
+		_ = s.Serve(l)
+	}()
+	conn, err := net.Dial("tcp", l.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		_ = conn.Close()
+		_ = s.Close()
+		_ = c.Close()
+	})
+	return c, conn, bufio.NewReader(conn)
+}
+
+// follow makes c follow an empty leader until the end of the test.
+func follow(t *testing.T, c *cache.Cache) {
+	t.Helper()
+	leader := cache.New(cache.DefaultExpiration, 0)
+	l := leader.Lead(cache.LeaderConfig{})
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		_ = c.Follow(ctx, cache.FollowerConfig{Dial: func(ctx context.Context) (io.ReadWriteCloser, error) {
+			a, b := net.Pipe()
+			go func() {
+				_ = l.Serve(ctx, b)
+				_ = b.Close()
+			}()
+			return a, nil
+		}})
+	}()
+	t.Cleanup(func() {
+		cancel()
+		<-done
+		l.Close()
+		_ = leader.Close()
+	})
+	for !c.ReadOnly() {
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func roundTrip(t *testing.T, conn net.Conn, r *bufio.Reader, req string, lines int) string {
+	t.Helper()
+	if _, err := conn.Write([]byte(req)); err != nil {
+		t.Fatal(err)
+	}
+	var sb strings.Builder
+	_ = conn.SetReadDeadline(time.Now().Add(time.Second))
+	for i := 0; i < lines; i++ {
+		line, err := r.ReadString('\n')
+		if err != nil {
+			t.Fatalf("reply to %q: %v", req, err)
+		}
+		sb.WriteString(line)
+	}
+	return sb.String()
+}
+
+func TestStorageCommands(t *testing.T) {
+	c, conn, r := startServer(t)
+	for _, tt := range []struct {
+		req, resp string
+	}{
+		{"get foo\r\n", "END\r\n"},
+		{"set foo 0 0 3\r\nbar\r\n", "STORED\r\n"},
+		{"get foo\r\n", "VALUE foo 0 3\r\nbar\r\nEND\r\n"},
+		{"add foo 0 0 3\r\nbaz\r\n", "NOT_STORED\r\n"},
+		{"replace foo 5 0 3\r\nbaz\r\n", "STORED\r\n"},
+		{"get foo missing\r\n", "VALUE foo 5 3\r\nbaz\r\nEND\r\n"},
+		{"replace missing 0 0 1\r\nx\r\n", "NOT_STORED\r\n"},
+		{"add new 0 0 1\r\nx\r\n", "STORED\r\n"},
+		{"delete new\r\n", "DELETED\r\n"},
+		{"delete new\r\n", "NOT_FOUND\r\n"},
+		{"touch foo 100\r\n", "TOUCHED\r\n"},
+		{"touch missing 100\r\n", "NOT_FOUND\r\n"},
+		{"set expired 0 -1 1\r\nx\r\n", "STORED\r\n"},
+		{"get expired\r\n", "END\r\n"},
+		{"set gone 0 0 1\r\nx\r\n", "STORED\r\n"},
+		{"touch gone -1\r\n", "TOUCHED\r\n"},
+		{"touch gone -1\r\n", "NOT_FOUND\r\n"},
+		{"bogus\r\n", "ERROR\r\n"},
+	} {
+		if resp := roundTrip(t, conn, r, tt.req, strings.Count(tt.resp, "\n")); resp != tt.resp {
+			t.Errorf("%q: got %q, expected %q", tt.req, resp, tt.resp)
+		}
+	}
+	x, found := c.Get("foo")
+	if !found {
+		t.Fatal("foo was not found in cache")
+	}
+	if v, ok := x.(Value); !ok || v.Flags != 5 || string(v.Data) != "baz" {
+		t.Error("foo has unexpected value:", x)
+	}
+	if _, ttl, _ := c.GetWithRemainingTTL("foo"); ttl <= 0 || ttl > 100*time.Second {
+		t.Error("foo has unexpected TTL:", ttl)
+	}
+}
+
+func TestIncrDecr(t *testing.T) {
+	c, conn, r := startServer(t)
+	c.Set("int", 10, cache.DefaultExpiration)
+	c.Set("struct", struct{}{}, cache.DefaultExpiration)
+	for _, tt := range []struct {
+		req, resp string
+	}{
+		{"set n 0 0 2\r\n10\r\n", "STORED\r\n"},
+		{"incr n 5\r\n", "15\r\n"},
+		{"decr n 20\r\n", "0\r\n"},
+		{"incr int 5\r\n", "15\r\n"},
+		{"decr int 20\r\n", "-5\r\n"},
+		{"incr missing 1\r\n", "NOT_FOUND\r\n"},
+		{"set s 0 0 1\r\nx\r\n", "STORED\r\n"},
+		{"incr s 1\r\n", "CLIENT_ERROR cannot increment or decrement non-numeric value\r\n"},
+		{"incr struct 1\r\n", "CLIENT_ERROR cannot increment or decrement non-numeric value\r\n"},
+	} {
+		if resp := roundTrip(t, conn, r, tt.req, 1); resp != tt.resp {
+			t.Errorf("%q: got %q, expected %q", tt.req, resp, tt.resp)
+		}
+	}
+	if x, _ := c.Get("int"); x != -5 {
+		t.Error("int is not -5:", x)
+	}
+}
+
+func TestPipelineAndNoreply(t *testing.T) {
+	c, conn, r := startServer(t)
+	req := "set a 0 0 1 noreply\r\na\r\n" +
+		"set b 0 0 1 noreply\r\nb\r\n" +
+		"gets a b\r\n" +
+		"flush_all noreply\r\n" +
+		"get a\r\n"
+	resp := roundTrip(t, conn, r, req, 6)
+	lines := strings.Split(resp, "\r\n")
+	if !strings.HasPrefix(lines[0], "VALUE a 0 1 ") || lines[1] != "a" ||
+		!strings.HasPrefix(lines[2], "VALUE b 0 1 ") || lines[3] != "b" ||
+		lines[4] != "END" || lines[5] != "END" {
+		t.Errorf("unexpected pipelined response %q", resp)
+	}
+	if c.ItemCount() != 0 {
+		t.Error("cache was not flushed")
+	}
+}
+
+func TestStats(t *testing.T) {
+	c, conn, r := startServer(t)
+	c.Set("a", "a", cache.DefaultExpiration)
+	roundTrip(t, conn, r, "get a b\r\n", 3)
+	if _, err := conn.Write([]byte("stats\r\n")); err != nil {
+		t.Fatal(err)
+	}
+	stats := make(map[string]string)
+	for {
+		line, err := r.ReadString('\n')
+		if err != nil {
+			t.Fatal(err)
+		}
+		if line == "END\r\n" {
+			break
+		}
+		f := strings.Fields(line)
+		stats[f[1]] = f[2]
+	}
+	for k, v := range map[string]string{
+		"cmd_get":    "2",
+		"get_hits":   "1",
+		"get_misses": "1",
+		"curr_items": "1",
+	} {
+		if stats[k] != v {
+			t.Errorf("stat %s is %s, expected %s", k, stats[k], v)
+		}
+	}
+}
+
+func TestReadOnly(t *testing.T) {
+	c, conn, r := startServer(t)
+	c.Set("foo", []byte("bar"), cache.NoExpiration)
+	follow(t, c)
+	for _, tt := range []struct {
+		req, resp string
+	}{
+		{"set foo 0 0 3\r\nbaz\r\n", "SERVER_ERROR cache is read-only\r\n"},
+		{"delete foo\r\n", "SERVER_ERROR cache is read-only\r\n"},
+		{"incr foo 1\r\n", "SERVER_ERROR cache is read-only\r\n"},
+		{"flush_all\r\n", "SERVER_ERROR cache is read-only\r\n"},
+		{"get foo\r\n", "END\r\n"},
+	} {
+		if resp := roundTrip(t, conn, r, tt.req, strings.Count(tt.resp, "\n")); resp != tt.resp {
+			t.Errorf("%q: got %q, want %q", tt.req, resp, tt.resp)
+		}
+	}
+}
+
+func TestDelayedFlushStoppedByClose(t *testing.T) {
+	c := cache.New(cache.DefaultExpiration, 0)
+	defer c.Close()
+	s := New(c)
+	c.Set("a", "a", cache.DefaultExpiration)
+	if err := s.flush([][]byte{[]byte("1")}, func(string) {}); err != nil {
+		t.Fatal(err)
+	}
+	s.Close()
+	<-time.After(1100 * time.Millisecond)
+	if _, found := c.Get("a"); !found {
+		t.Error("cache was flushed after Close")
+	}
+}
@@ -0,0 +1,659 @@
+package resp
+
+import (
+	"container/heap"
+	"errors"
+	"hash/fnv"
+	"math"
+	"os"
+	"reflect"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/sot-tech/go-cache"
+)
+
+const (
+	errSyntax    = "ERR syntax error"
+	errNotInt    = "ERR value is not an integer or out of range"
+	errNotFloat  = "ERR value is not a valid float"
+	errWrongType = "WRONGTYPE Operation against a key holding the wrong kind of value"
+	errOverflow  = "ERR increment or decrement would overflow"
+	errReadOnly  = "READONLY You can't write against a read only replica."
+)
+
+var (
+	errNotInteger = errors.New(errNotInt)
+	errNotNumber  = errors.New(errNotFloat)
+	errWrong      = errors.New(errWrongType)
+)
+
+type command struct {
+	// arity is the number of arguments including the command name, negative
+	// for the minimum number of them.
+	arity int
+	f     func(s *Server, c *conn, args [][]byte)
+}
+
+var commands map[string]command
+
+// writeCommands are the commands changing the cache, which are rejected while
+// it follows a leader.
+var writeCommands = map[string]bool{
+	"set": true, "del": true, "incr": true, "decr": true, "incrby": true,
+	"decrby": true, "incrbyfloat": true, "expire": true, "persist": true,
+	"flushall": true, "flushdb": true,
+}
+
+func init() {
+	commands = map[string]command{
+		"ping":        {-1, (*Server).ping},
+		"echo":        {2, (*Server).echo},
+		"hello":       {-1, (*Server).hello},
+		"select":      {2, (*Server).selectDB},
+		"client":      {-2, (*Server).client},
+		"command":     {-1, (*Server).command},
+		"get":         {2, (*Server).get},
+		"set":         {-3, (*Server).set},
+		"del":         {-2, (*Server).del},
+		"exists":      {-2, (*Server).exists},
+		"incr":        {2, (*Server).incr},
+		"decr":        {2, (*Server).incr},
+		"incrby":      {3, (*Server).incr},
+		"decrby":      {3, (*Server).incr},
+		"incrbyfloat": {3, (*Server).incrByFloat},
+		"expire":      {3, (*Server).expire},
+		"ttl":         {2, (*Server).ttl},
+		"persist":     {2, (*Server).persist},
+		"keys":        {2, (*Server).keys},
+		"scan":        {-2, (*Server).scan},
+		"dbsize":      {1, (*Server).dbSize},
+		"flushall":    {-1, (*Server).flushAll},
+		"flushdb":     {-1, (*Server).flushAll},
+		"info":        {-1, (*Server).info},
+	}
+}
+
+// exec executes a command and writes its reply. It returns true if the
+// connection should be closed.
+func (s *Server) exec(c *conn, args [][]byte) bool {
+	name := strings.ToLower(string(args[0]))
+	if name == "quit" {
+		c.w.simple("OK")
+		return true
+	}
+	cmd, found := commands[name]
+	if !found {
+		c.w.error("ERR unknown command '" + string(args[0]) + "'")
+		return false
+	}
+	if (cmd.arity > 0 && len(args) != cmd.arity) || (cmd.arity < 0 && len(args) < -cmd.arity) {
+		c.w.error("ERR wrong number of arguments for '" + name + "' command")
+		return false
+	}
+	if writeCommands[name] && s.c.ReadOnly() {
+		c.w.error(errReadOnly)
+		return false
+	}
+	cmd.f(s, c, args)
+	return false
+}
+
+// cacheError writes the reply to an error of the cache: READONLY if the
+// cache started following a leader since exec checked it, or the message of
+// err.
+func (c *conn) cacheError(err error) {
+	if errors.Is(err, cache.ErrReadOnly) {
+		c.w.error(errReadOnly)
+		return
+	}
+	c.w.error(err.Error())
+}
+
+// toBytes returns the representation of a cache value as a string, and false
+// if the value can't be represented.
+func toBytes(x any) ([]byte, bool) {
+	switch v := x.(type) {
+	case []byte:
+		return v, true
+	case string:
+		return []byte(v), true
+	}
+	rv := reflect.ValueOf(x)
+	switch rv.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return strconv.AppendInt(nil, rv.Int(), 10), true
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		return strconv.AppendUint(nil, rv.Uint(), 10), true
+	case reflect.Float32, reflect.Float64:
+		return strconv.AppendFloat(nil, rv.Float(), 'f', -1, rv.Type().Bits()), true
+	}
+	return nil, false
+}
+
+func (s *Server) ping(c *conn, args [][]byte) {
+	switch len(args) {
+	case 1:
+		c.w.simple("PONG")
+	case 2:
+		c.w.bulk(args[1])
+	default:
+		c.w.error("ERR wrong number of arguments for 'ping' command")
+	}
+}
+
+func (s *Server) echo(c *conn, args [][]byte) {
+	c.w.bulk(args[1])
+}
+
+func (s *Server) hello(c *conn, args [][]byte) {
+	if len(args) > 1 {
+		proto, err := strconv.Atoi(string(args[1]))
+		if err != nil || proto < 2 || proto > 3 {
+			c.w.error("NOPROTO unsupported protocol version")
+			return
+		}
+		c.w.proto = proto
+	}
+	c.w.mapHeader(7)
+	c.w.bulkString("server")
+	c.w.bulkString("go-cache")
+	c.w.bulkString("version")
+	c.w.bulkString("7.0.0")
+	c.w.bulkString("proto")
+	c.w.integer(int64(c.w.proto))
+	c.w.bulkString("id")
+	c.w.integer(0)
+	c.w.bulkString("mode")
+	c.w.bulkString("standalone")
+	c.w.bulkString("role")
+	c.w.bulkString("master")
+	c.w.bulkString("modules")
+	c.w.array(0)
+}
+
+func (s *Server) selectDB(c *conn, args [][]byte) {
+	if string(args[1]) != "0" {
+		c.w.error("ERR DB index is out of range")
+		return
+	}
+	c.w.simple("OK")
+}
+
+func (s *Server) client(c *conn, _ [][]byte) {
+	// CLIENT SETNAME, SETINFO etc. are accepted for compatibility with
+	// client libraries, but ignored.
+	c.w.simple("OK")
+}
+
+func (s *Server) command(c *conn, _ [][]byte) {
+	// redis-cli requests command docs on start, an empty reply disables
+	// hints.
+	c.w.array(0)
+}
+
+func (s *Server) get(c *conn, args [][]byte) {
+	x, found := s.c.Get(string(args[1]))
+	if !found {
+		c.w.null()
+		return
+	}
+	b, ok := toBytes(x)
+	if !ok {
+		c.w.error(errWrongType)
+		return
+	}
+	c.w.bulk(b)
+}
+
+func (s *Server) set(c *conn, args [][]byte) {
+	k, v := string(args[1]), args[2]
+	d := cache.NoExpiration
+	var nx, xx, hasTTL bool
+	for i := 3; i < len(args); i++ {
+		switch strings.ToUpper(string(args[i])) {
+		case "NX":
+			nx = true
+		case "XX":
+			xx = true
+		case "EX", "PX":
+			if hasTTL || i+1 == len(args) {
+				c.w.error(errSyntax)
+				return
+			}
+			n, err := strconv.ParseInt(string(args[i+1]), 10, 64)
+			if err != nil {
+				c.w.error(errNotInt)
+				return
+			}
+			unit := time.Second
+			if strings.EqualFold(string(args[i]), "PX") {
+				unit = time.Millisecond
+			}
+			var ok bool
+			if d, ok = expireDuration(n, unit); n <= 0 || !ok {
+				c.w.error("ERR invalid expire time in 'set' command")
+				return
+			}
+			hasTTL = true
+			i++
+		default:
+			c.w.error(errSyntax)
+			return
+		}
+	}
+	if nx && xx {
+		c.w.error(errSyntax)
+		return
+	}
+	var err error
+	switch {
+	case nx:
+		err = s.c.Add(k, v, d)
+	case xx:
+		err = s.c.Replace(k, v, d)
+	default:
+		err = s.c.TrySet(k, v, d)
+	}
+	if errors.Is(err, cache.ErrReadOnly) {
+		c.cacheError(err)
+		return
+	}
+	if err != nil {
+		c.w.null()
+		return
+	}
+	c.w.simple("OK")
+}
+
+func (s *Server) del(c *conn, args [][]byte) {
+	var n int64
+	for _, k := range args[1:] {
+		found, err := s.c.TryDelete(string(k))
+		if err != nil {
+			c.cacheError(err)
+			return
+		}
+		if found {
+			n++
+		}
+	}
+	c.w.integer(n)
+}
+
+func (s *Server) exists(c *conn, args [][]byte) {
+	var n int64
+	for _, k := range args[1:] {
+		if _, found := s.c.Get(string(k)); found {
+			n++
+		}
+	}
+	c.w.integer(n)
+}
+
+// update atomically applies f to the value of k, or to nil if k doesn't
+// exist, in which case the result is added without expiration.
+func (s *Server) update(k string, f func(x any) (any, error)) error {
+	for {
+		err := s.c.Modify(k, f)
+		if !errors.Is(err, cache.ErrNotExists) {
+			return err
+		}
+		x, err := f(nil)
+		if err != nil {
+			return err
+		}
+		if err = s.c.Add(k, x, cache.NoExpiration); !errors.Is(err, cache.ErrAlreadyExists) {
+			return err
+		}
+		// Added concurrently, modify it.
+	}
+}
+
+func (s *Server) incr(c *conn, args [][]byte) {
+	name := strings.ToLower(string(args[0]))
+	delta := int64(1)
+	if len(args) == 3 {
+		var err error
+		if delta, err = strconv.ParseInt(string(args[2]), 10, 64); err != nil {
+			c.w.error(errNotInt)
+			return
+		}
+	}
+	if name == "decr" || name == "decrby" {
+		if delta == math.MinInt64 {
+			c.w.error("ERR decrement would overflow")
+			return
+		}
+		delta = -delta
+	}
+	var result int64
+	err := s.update(string(args[1]), func(x any) (any, error) {
+		var n int64
+		switch v := x.(type) {
+		case nil:
+		case []byte, string:
+			var err error
+			b, _ := toBytes(v)
+			if n, err = strconv.ParseInt(string(b), 10, 64); err != nil {
+				return nil, errNotInteger
+			}
+		default:
+			rv := reflect.ValueOf(x)
+			switch rv.Kind() {
+			case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+				nv := reflect.New(rv.Type()).Elem()
+				nv.SetInt(rv.Int() + delta)
+				if nv.Int() != rv.Int()+delta {
+					return nil, errors.New(errOverflow)
+				}
+				result = nv.Int()
+				return nv.Interface(), nil
+			case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+				u := rv.Uint()
+				if (delta < 0 && uint64(-delta) > u) || u > math.MaxInt64 {
+					return nil, errors.New(errOverflow)
+				}
+				nv := reflect.New(rv.Type()).Elem()
+				nv.SetUint(uint64(int64(u) + delta))
+				if int64(nv.Uint()) != int64(u)+delta {
+					return nil, errors.New(errOverflow)
+				}
+				result = int64(nv.Uint())
+				return nv.Interface(), nil
+			}
+			return nil, errWrong
+		}
+		if (delta > 0 && n > math.MaxInt64-delta) || (delta < 0 && n < math.MinInt64-delta) {
+			return nil, errors.New(errOverflow)
+		}
+		result = n + delta
+		return strconv.AppendInt(nil, result, 10), nil
+	})
+	if err != nil {
+		c.cacheError(err)
+		return
+	}
+	c.w.integer(result)
+}
+
+func (s *Server) incrByFloat(c *conn, args [][]byte) {
+	delta, err := strconv.ParseFloat(string(args[2]), 64)
+	if err != nil || math.IsNaN(delta) || math.IsInf(delta, 0) {
+		c.w.error(errNotFloat)
+		return
+	}
+	var result []byte
+	err = s.update(string(args[1]), func(x any) (any, error) {
+		var f float64
+		switch v := x.(type) {
+		case nil:
+		case []byte, string:
+			b, _ := toBytes(v)
+			var err error
+			if f, err = strconv.ParseFloat(string(b), 64); err != nil {
+				return nil, errNotNumber
+			}
+		case float32:
+			result = strconv.AppendFloat(nil, float64(v+float32(delta)), 'f', -1, 32)
+			return v + float32(delta), nil
+		case float64:
+			result = strconv.AppendFloat(nil, v+delta, 'f', -1, 64)
+			return v + delta, nil
+		default:
+			return nil, errWrong
+		}
+		f += delta
+		if math.IsNaN(f) || math.IsInf(f, 0) {
+			return nil, errors.New("ERR increment would produce NaN or Infinity")
+		}
+		result = strconv.AppendFloat(nil, f, 'f', -1, 64)
+		return result, nil
+	})
+	if err != nil {
+		c.cacheError(err)
+		return
+	}
+	c.w.bulk(result)
+}
+
+func (s *Server) expire(c *conn, args [][]byte) {
+	secs, err := strconv.ParseInt(string(args[2]), 10, 64)
+	if err != nil {
+		c.w.error(errNotInt)
+		return
+	}
+	k := string(args[1])
+	if secs <= 0 {
+		found, err := s.c.TryDelete(k)
+		switch {
+		case err != nil:
+			c.cacheError(err)
+		case found:
+			c.w.integer(1)
+		default:
+			c.w.integer(0)
+		}
+		return
+	}
+	d, ok := expireDuration(secs, time.Second)
+	if !ok {
+		c.w.error("ERR invalid expire time in 'expire' command")
+		return
+	}
+	err = s.c.Touch(k, d)
+	if errors.Is(err, cache.ErrReadOnly) {
+		c.cacheError(err)
+		return
+	}
+	if err != nil {
+		c.w.integer(0)
+		return
+	}
+	c.w.integer(1)
+}
+
+// expireDuration returns n units as a duration, and false if the expiration
+// it sets from now can't be represented.
+func expireDuration(n int64, unit time.Duration) (time.Duration, bool) {
+	if n > (math.MaxInt64-time.Now().UnixNano())/int64(unit) {
+		return 0, false
+	}
+	return time.Duration(n) * unit, true
+}
+
+func (s *Server) ttl(c *conn, args [][]byte) {
+	_, ttl, found := s.c.GetWithRemainingTTL(string(args[1]))
+	switch {
+	case !found:
+		c.w.integer(-2)
+	case ttl == cache.NoExpiration:
+		c.w.integer(-1)
+	default:
+		c.w.integer(int64((ttl + time.Second/2) / time.Second))
+	}
+}
+
+func (s *Server) persist(c *conn, args [][]byte) {
+	k := string(args[1])
+	_, ttl, found := s.c.GetWithRemainingTTL(k)
+	if !found || ttl == cache.NoExpiration {
+		c.w.integer(0)
+		return
+	}
+	if err := s.c.Touch(k, cache.NoExpiration); err != nil {
+		if errors.Is(err, cache.ErrReadOnly) {
+			c.cacheError(err)
+		} else {
+			c.w.integer(0)
+		}
+		return
+	}
+	c.w.integer(1)
+}
+
+func (s *Server) keys(c *conn, args [][]byte) {
+	pattern := string(args[1])
+	var keys []string
+	for k := range s.c.ScanMatch(pattern) {
+		keys = append(keys, k)
+	}
+	c.w.array(len(keys))
+	for _, k := range keys {
+		c.w.bulkString(k)
+	}
+}
+
+func keyHash(k string) uint64 {
+	h := fnv.New64a()
+	_, _ = h.Write([]byte(k))
+	// The top bit is cleared so cursors fit int64 for clients parsing them
+	// as signed.
+	return h.Sum64() >> 1
+}
+
+// hashHeap is a max-heap of key hashes.
+type hashHeap []uint64
+
+func (h hashHeap) Len() int           { return len(h) }
+func (h hashHeap) Less(i, j int) bool { return h[i] > h[j] }
+func (h hashHeap) Swap(i, j int)      { h[i], h[j] = h[j], h[i] }
+func (h *hashHeap) Push(x any)        { *h = append(*h, x.(uint64)) }
+
+func (h *hashHeap) Pop() any {
+	old := *h
+	x := old[len(old)-1]
+	*h = old[:len(old)-1]
+	return x
+}
+
+// scan iterates keys in the order of their hashes, the cursor is the hash to
+// continue from. As in Redis, keys which exist during the whole iteration
+// are returned at least once, regardless of changes of other keys.
+func (s *Server) scan(c *conn, args [][]byte) {
+	cursor, err := strconv.ParseUint(string(args[1]), 10, 64)
+	if err != nil {
+		c.w.error("ERR invalid cursor")
+		return
+	}
+	pattern, count := "*", 10
+	for i := 2; i < len(args); i += 2 {
+		if i+1 == len(args) {
+			c.w.error(errSyntax)
+			return
+		}
+		switch strings.ToUpper(string(args[i])) {
+		case "MATCH":
+			pattern = string(args[i+1])
+		case "COUNT":
+			if count, err = strconv.Atoi(string(args[i+1])); err != nil || count < 1 {
+				c.w.error(errSyntax)
+				return
+			}
+		case "TYPE":
+			if !strings.EqualFold(string(args[i+1]), "string") {
+				count = 0
+			}
+		default:
+			c.w.error(errSyntax)
+			return
+		}
+	}
+	// The count smallest hashes from the cursor are kept in a max-heap,
+	// with their keys, so memory is bounded by count rather than by the
+	// number of keys. Keys of equal hashes are returned together, so the
+	// cursor doesn't stop in between of them.
+	var hashes hashHeap
+	groups := make(map[uint64][]string)
+	var more bool
+	if count > 0 {
+		for k := range s.c.Keys() {
+			h := keyHash(k)
+			switch _, found := groups[h]; {
+			case h < cursor:
+			case found:
+				groups[h] = append(groups[h], k)
+			case len(hashes) < count:
+				heap.Push(&hashes, h)
+				groups[h] = []string{k}
+			case h < hashes[0]:
+				delete(groups, hashes[0])
+				hashes[0] = h
+				heap.Fix(&hashes, 0)
+				groups[h] = []string{k}
+				more = true
+			default:
+				more = true
+			}
+		}
+	}
+	var next uint64
+	if more {
+		next = hashes[0] + 1
+	}
+	slices.Sort(hashes)
+	var keys []string
+	for _, h := range hashes {
+		group := groups[h]
+		slices.Sort(group)
+		for _, k := range group {
+			if cache.MatchGlob(pattern, k) {
+				keys = append(keys, k)
+			}
+		}
+	}
+	c.w.array(2)
+	c.w.bulkString(strconv.FormatUint(next, 10))
+	c.w.array(len(keys))
+	for _, k := range keys {
+		c.w.bulkString(k)
+	}
+}
+
+func (s *Server) dbSize(c *conn, _ [][]byte) {
+	var n int64
+	for range s.c.Keys() {
+		n++
+	}
+	c.w.integer(n)
+}
+
+func (s *Server) flushAll(c *conn, args [][]byte) {
+	if len(args) > 2 || (len(args) == 2 && !strings.EqualFold(string(args[1]), "ASYNC") &&
+		!strings.EqualFold(string(args[1]), "SYNC")) {
+		c.w.error(errSyntax)
+		return
+	}
+	if err := s.c.TryFlush(); err != nil {
+		c.cacheError(err)
+		return
+	}
+	c.w.simple("OK")
+}
+
+func (s *Server) info(c *conn, _ [][]byte) {
+	var keys, expires int
+	for _, v := range s.c.All() {
+		keys++
+		if v.Expiration > 0 {
+			expires++
+		}
+	}
+	var sb strings.Builder
+	sb.WriteString("# Server\r\n")
+	sb.WriteString("redis_version:7.0.0\r\n")
+	sb.WriteString("redis_mode:standalone\r\n")
+	sb.WriteString("process_id:" + strconv.Itoa(os.Getpid()) + "\r\n")
+	sb.WriteString("uptime_in_seconds:" + strconv.FormatInt(int64(time.Since(s.started)/time.Second), 10) + "\r\n")
+	sb.WriteString("\r\n# Clients\r\n")
+	sb.WriteString("connected_clients:" + strconv.FormatInt(s.conns.Load(), 10) + "\r\n")
+	sb.WriteString("\r\n# Stats\r\n")
+	sb.WriteString("total_commands_processed:" + strconv.FormatUint(s.cmds.Load(), 10) + "\r\n")
+	sb.WriteString("\r\n# Keyspace\r\n")
+	if keys > 0 {
+		sb.WriteString("db0:keys=" + strconv.Itoa(keys) + ",expires=" + strconv.Itoa(expires) + ",avg_ttl=0\r\n")
+	}
+	c.w.bulkString(sb.String())
+}
@@ -0,0 +1,143 @@
+package resp
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"io"
+	"strconv"
+)
+
+// protocolError is a malformed request, the connection is closed after it
+// is reported.
+type protocolError string
+
+func (e protocolError) Error() string {
+	return string(e)
+}
+
+// readLine returns the next CRLF (or LF) terminated line without the
+// terminator.
+func readLine(r *bufio.Reader) ([]byte, error) {
+	var line []byte
+	for {
+		chunk, err := r.ReadSlice('\n')
+		if len(line)+len(chunk) > maxInlineSize {
+			return nil, protocolError("too big inline request")
+		}
+		line = append(line, chunk...)
+		if errors.Is(err, bufio.ErrBufferFull) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		return bytes.TrimRight(line, "\r\n"), nil
+	}
+}
+
+// readCommand reads a request, which is either an array of bulk strings or
+// an inline command.
+func readCommand(r *bufio.Reader, maxBulk int) ([][]byte, error) {
+	b, err := r.Peek(1)
+	if err != nil {
+		return nil, err
+	}
+	if b[0] != '*' {
+		line, err := readLine(r)
+		if err != nil {
+			return nil, err
+		}
+		return bytes.Fields(line), nil
+	}
+	line, err := readLine(r)
+	if err != nil {
+		return nil, err
+	}
+	n, err := strconv.Atoi(string(line[1:]))
+	if err != nil || n > 1024*1024 {
+		return nil, protocolError("invalid multibulk length")
+	}
+	// The length isn't trusted for the allocation, arguments which aren't
+	// sent don't take memory.
+	args := make([][]byte, 0, min(max(n, 0), maxPreallocArgs))
+	for i := 0; i < n; i++ {
+		if line, err = readLine(r); err != nil {
+			return nil, err
+		}
+		if len(line) == 0 || line[0] != '$' {
+			return nil, protocolError("expected '$', got '" + string(line[:min(len(line), 1)]) + "'")
+		}
+		size, err := strconv.Atoi(string(line[1:]))
+		if err != nil || size < 0 || size > maxBulk {
+			return nil, protocolError("invalid bulk length")
+		}
+		arg := make([]byte, size+2)
+		if _, err = io.ReadFull(r, arg); err != nil {
+			return nil, err
+		}
+		if !bytes.HasSuffix(arg, []byte("\r\n")) {
+			return nil, protocolError("bulk string is not terminated")
+		}
+		args = append(args, arg[:size])
+	}
+	return args, nil
+}
+
+// writer encodes replies in the protocol version negotiated by the client.
+type writer struct {
+	*bufio.Writer
+	proto int
+}
+
+func (w *writer) simple(s string) {
+	_, _ = w.WriteString("+" + s + "\r\n")
+}
+
+func (w *writer) error(s string) {
+	_, _ = w.WriteString("-" + s + "\r\n")
+}
+
+func (w *writer) integer(n int64) {
+	b := append(w.AvailableBuffer(), ':')
+	b = strconv.AppendInt(b, n, 10)
+	_, _ = w.Write(append(b, "\r\n"...))
+}
+
+func (w *writer) bulk(data []byte) {
+	b := append(w.AvailableBuffer(), '$')
+	b = strconv.AppendInt(b, int64(len(data)), 10)
+	_, _ = w.Write(append(b, "\r\n"...))
+	_, _ = w.Write(data)
+	_, _ = w.WriteString("\r\n")
+}
+
+func (w *writer) bulkString(s string) {
+	w.bulk([]byte(s))
+}
+
+func (w *writer) null() {
+	if w.proto >= 3 {
+		_, _ = w.WriteString("_\r\n")
+	} else {
+		_, _ = w.WriteString("$-1\r\n")
+	}
+}
+
+func (w *writer) array(n int) {
+	b := append(w.AvailableBuffer(), '*')
+	b = strconv.AppendInt(b, int64(n), 10)
+	_, _ = w.Write(append(b, "\r\n"...))
+}
+
+// mapHeader starts a map of n pairs, which is a flat array of 2n elements in
+// RESP2.
+func (w *writer) mapHeader(n int) {
+	if w.proto < 3 {
+		w.array(2 * n)
+		return
+	}
+	b := append(w.AvailableBuffer(), '%')
+	b = strconv.AppendInt(b, int64(n), 10)
+	_, _ = w.Write(append(b, "\r\n"...))
+}
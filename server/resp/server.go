@@ -0,0 +1,184 @@
+// Package resp serves a cache.Cache over TCP using the Redis serialization
+// protocol (RESP2, and RESP3 after HELLO 3), so redis-cli and Redis client
+// libraries can talk to an in-process cache.
+//
+// Supported commands are GET, SET (with EX, PX, NX and XX), DEL, EXISTS,
+// INCR, INCRBY, DECR, DECRBY, INCRBYFLOAT, EXPIRE, TTL, PERSIST, KEYS, SCAN,
+// DBSIZE, FLUSHALL, INFO, and connection commands PING, ECHO, HELLO, SELECT
+// (database 0 only), CLIENT, COMMAND and QUIT. Commands may be pipelined.
+//
+// Values stored by the server are []byte. Values stored by Go code are served
+// if they are []byte, string or numbers, other values are reported as being of
+// the wrong type. Writes to a cache which follows a leader (see
+// cache.Cache.Follow) are rejected with a READONLY error, as by Redis
+// replicas.
+package resp
+
+import (
+	"bufio"
+	"errors"
+	"net"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/sot-tech/go-cache"
+)
+
+// DefaultMaxBulkSize is the default limit of a single bulk string of
+// a request.
+const DefaultMaxBulkSize = 64 << 20
+
+// maxInlineSize is the limit of an inline command or a RESP header line.
+const maxInlineSize = 64 << 10
+
+// maxPreallocArgs is the most arguments of a request allocated up front.
+const maxPreallocArgs = 1024
+
+var ErrServerClosed = errors.New("resp: server closed")
+
+// Server RESP server of a cache.
+type Server struct {
+	c *cache.Cache
+	// MaxBulkSize is the limit of a single bulk string of a request,
+	// DefaultMaxBulkSize if zero.
+	MaxBulkSize int
+
+	started time.Time
+	cmds    atomic.Uint64
+	conns   atomic.Int64
+
+	mu        sync.Mutex
+	closed    bool
+	listeners map[net.Listener]struct{}
+	active    map[net.Conn]struct{}
+	wg        sync.WaitGroup
+}
+
+// New Returns a server of the cache c.
+func New(c *cache.Cache) *Server {
+	return &Server{
+		c:         c,
+		started:   time.Now(),
+		listeners: make(map[net.Listener]struct{}),
+		active:    make(map[net.Conn]struct{}),
+	}
+}
+
+// ListenAndServe Listens on the TCP address and serves connections, see Serve.
+func (s *Server) ListenAndServe(addr string) error {
+	l, err := net.Listen("tcp", addr)
+	if err != nil {
+		return err
+	}
+	return s.Serve(l)
+}
+
+// Serve Accepts connections on l and serves each of them in a new goroutine.
+// It blocks until l fails or the server is closed, in which case it returns
+// ErrServerClosed.
+func (s *Server) Serve(l net.Listener) error {
+	s.mu.Lock()
+	if s.closed {
+		s.mu.Unlock()
+		_ = l.Close()
+		return ErrServerClosed
+	}
+	s.listeners[l] = struct{}{}
+	s.mu.Unlock()
+	defer func() {
+		s.mu.Lock()
+		delete(s.listeners, l)
+		s.mu.Unlock()
+	}()
+	for {
+		conn, err := l.Accept()
+		if err != nil {
+			s.mu.Lock()
+			closed := s.closed
+			s.mu.Unlock()
+			if closed {
+				return ErrServerClosed
+			}
+			return err
+		}
+		s.mu.Lock()
+		if s.closed {
+			s.mu.Unlock()
+			_ = conn.Close()
+			return ErrServerClosed
+		}
+		s.active[conn] = struct{}{}
+		s.wg.Add(1)
+		s.mu.Unlock()
+		go s.serveConn(conn)
+	}
+}
+
+// Close Closes all listeners and connections of the server and waits until
+// connection goroutines exit. The cache is not closed.
+func (s *Server) Close() error {
+	s.mu.Lock()
+	s.closed = true
+	var err error
+	for l := range s.listeners {
+		err = errors.Join(err, l.Close())
+	}
+	for conn := range s.active {
+		_ = conn.Close()
+	}
+	s.mu.Unlock()
+	s.wg.Wait()
+	return err
+}
+
+// conn is the state of a client connection.
+type conn struct {
+	r *bufio.Reader
+	w *writer
+}
+
+func (s *Server) serveConn(nc net.Conn) {
+	defer s.wg.Done()
+	defer func() {
+		s.mu.Lock()
+		delete(s.active, nc)
+		s.mu.Unlock()
+		_ = nc.Close()
+		s.conns.Add(-1)
+	}()
+	s.conns.Add(1)
+	maxBulk := s.MaxBulkSize
+	if maxBulk <= 0 {
+		maxBulk = DefaultMaxBulkSize
+	}
+	c := &conn{
+		r: bufio.NewReader(nc),
+		w: &writer{Writer: bufio.NewWriter(nc), proto: 2},
+	}
+	for {
+		args, err := readCommand(c.r, maxBulk)
+		if err != nil {
+			var perr protocolError
+			if errors.As(err, &perr) {
+				c.w.error("ERR Protocol error: " + perr.Error())
+				_ = c.w.Flush()
+			}
+			return
+		}
+		if len(args) == 0 {
+			continue
+		}
+		s.cmds.Add(1)
+		if quit := s.exec(c, args); quit {
+			_ = c.w.Flush()
+			return
+		}
+		// Replies to pipelined commands are sent together.
+		if c.r.Buffered() == 0 {
+			if err = c.w.Flush(); err != nil {
+				return
+			}
+		}
+	}
+}
@@ -0,0 +1,286 @@
+package resp
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"runtime"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/sot-tech/go-cache"
+)
+
+type client struct {
+	t    *testing.T
+	conn net.Conn
+	r    *bufio.Reader
+}
+
+func startServer(t *testing.T) (*cache.Cache, *client) {
+	t.Helper()
+	c := cache.New(cache.DefaultExpiration, 0, true)
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := New(c)
+	go func() {
+		_ = s.Serve(l)
+	}()
+	conn, err := net.Dial("tcp", l.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		_ = conn.Close()
+		_ = s.Close()
+		_ = c.Close()
+	})
+	return c, &client{t: t, conn: conn, r: bufio.NewReader(conn)}
+}
+
+// follow makes c follow an empty leader until the end of the test.
+func follow(t *testing.T, c *cache.Cache) {
+	t.Helper()
+	leader := cache.New(cache.DefaultExpiration, 0)
+	l := leader.Lead(cache.LeaderConfig{})
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		_ = c.Follow(ctx, cache.FollowerConfig{Dial: func(ctx context.Context) (io.ReadWriteCloser, error) {
+			a, b := net.Pipe()
+			go func() {
+				_ = l.Serve(ctx, b)
+				_ = b.Close()
+			}()
+			return a, nil
+		}})
+	}()
+	t.Cleanup(func() {
+		cancel()
+		<-done
+		l.Close()
+		_ = leader.Close()
+	})
+	for !c.ReadOnly() {
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func encodeCommand(args ...string) string {
+	var sb strings.Builder
+	sb.WriteString("*" + strconv.Itoa(len(args)) + "\r\n")
+	for _, a := range args {
+		sb.WriteString("$" + strconv.Itoa(len(a)) + "\r\n" + a + "\r\n")
+	}
+	return sb.String()
+}
+
+// readReply returns a compact textual form of the next reply.
+func (cl *client) readReply() string {
+	cl.t.Helper()
+	_ = cl.conn.SetReadDeadline(time.Now().Add(time.Second))
+	line, err := cl.r.ReadString('\n')
+	if err != nil {
+		cl.t.Fatal(err)
+	}
+	line = strings.TrimSuffix(line, "\r\n")
+	switch line[0] {
+	case '+', '-', ':', '_':
+		return line
+	case '$':
+		n, _ := strconv.Atoi(line[1:])
+		if n < 0 {
+			return "nil"
+		}
+		b := make([]byte, n+2)
+		if _, err = io.ReadFull(cl.r, b); err != nil {
+			cl.t.Fatal(err)
+		}
+		return string(b[:n])
+	case '*', '%':
+		n, _ := strconv.Atoi(line[1:])
+		if line[0] == '%' {
+			n *= 2
+		}
+		parts := make([]string, n)
+		for i := range parts {
+			parts[i] = cl.readReply()
+		}
+		return "[" + strings.Join(parts, " ") + "]"
+	}
+	cl.t.Fatalf("unexpected reply %q", line)
+	return ""
+}
+
+func (cl *client) do(args ...string) string {
+	cl.t.Helper()
+	if _, err := cl.conn.Write([]byte(encodeCommand(args...))); err != nil {
+		cl.t.Fatal(err)
+	}
+	return cl.readReply()
+}
+
+func TestStringCommands(t *testing.T) {
+	c, cl := startServer(t)
+	c.Set("go", 5, cache.NoExpiration)
+	for _, tt := range []struct {
+		cmd  []string
+		resp string
+	}{
+		{[]string{"PING"}, "+PONG"},
+		{[]string{"GET", "foo"}, "nil"},
+		{[]string{"SET", "foo", "bar"}, "+OK"},
+		{[]string{"GET", "foo"}, "bar"},
+		{[]string{"SET", "foo", "baz", "NX"}, "nil"},
+		{[]string{"SET", "new", "v", "XX"}, "nil"},
+		{[]string{"SET", "foo", "baz", "XX", "EX", "100"}, "+OK"},
+		{[]string{"TTL", "foo"}, ":100"},
+		{[]string{"PERSIST", "foo"}, ":1"},
+		{[]string{"TTL", "foo"}, ":-1"},
+		{[]string{"TTL", "missing"}, ":-2"},
+		{[]string{"EXPIRE", "foo", "10"}, ":1"},
+		{[]string{"TTL", "foo"}, ":10"},
+		{[]string{"EXISTS", "foo", "go", "missing"}, ":2"},
+		{[]string{"INCR", "n"}, ":1"},
+		{[]string{"INCRBY", "n", "41"}, ":42"},
+		{[]string{"DECRBY", "n", "2"}, ":40"},
+		{[]string{"INCRBY", "go", "5"}, ":10"},
+		{[]string{"INCRBY", "foo", "1"}, "-" + errNotInt},
+		{[]string{"INCRBYFLOAT", "f", "1.5"}, "1.5"},
+		{[]string{"INCRBYFLOAT", "f", "0.25"}, "1.75"},
+		{[]string{"DEL", "foo", "n", "missing"}, ":2"},
+		{[]string{"SET", "p", "v", "PX", "1"}, "+OK"},
+		{[]string{"SET", "foo", "bar", "EX"}, "-" + errSyntax},
+		{[]string{"SET", "foo", "bar", "EX", "9223372036854775807"}, "-ERR invalid expire time in 'set' command"},
+		{[]string{"SET", "foo", "bar", "PX", "9223372036854"}, "-ERR invalid expire time in 'set' command"},
+		{[]string{"SET", "e", "v"}, "+OK"},
+		{[]string{"EXPIRE", "e", "9223372036854775807"}, "-ERR invalid expire time in 'expire' command"},
+		{[]string{"EXPIRE", "e", "0"}, ":1"},
+		{[]string{"EXPIRE", "e", "0"}, ":0"},
+		{[]string{"GETX"}, "-ERR unknown command 'GETX'"},
+		{[]string{"GET"}, "-ERR wrong number of arguments for 'get' command"},
+	} {
+		if resp := cl.do(tt.cmd...); resp != tt.resp {
+			t.Errorf("%v: got %q, expected %q", tt.cmd, resp, tt.resp)
+		}
+	}
+	if x, _ := c.Get("go"); x != 10 {
+		t.Error("go is not 10:", x)
+	}
+	<-time.After(10 * time.Millisecond)
+	if resp := cl.do("GET", "p"); resp != "nil" {
+		t.Error("p has not expired:", resp)
+	}
+}
+
+func TestKeysAndScan(t *testing.T) {
+	c, cl := startServer(t)
+	want := make(map[string]bool)
+	for i := 0; i < 50; i++ {
+		k := fmt.Sprintf("user:%d", i)
+		c.Set(k, "x", cache.NoExpiration)
+		want[k] = true
+	}
+	c.Set("other", "x", cache.NoExpiration)
+	if resp := cl.do("KEYS", "user:1?"); len(strings.Fields(resp)) != 10 {
+		t.Error("unexpected KEYS reply:", resp)
+	}
+	if resp := cl.do("DBSIZE"); resp != ":51" {
+		t.Error("unexpected DBSIZE reply:", resp)
+	}
+	cursor := "0"
+	got := make(map[string]bool)
+	for i := 0; ; i++ {
+		if i > 100 {
+			t.Fatal("SCAN didn't finish")
+		}
+		resp := cl.do("SCAN", cursor, "MATCH", "user:*", "COUNT", "7")
+		fields := strings.Fields(strings.NewReplacer("[", " ", "]", " ").Replace(resp))
+		cursor = fields[0]
+		if len(fields) > 8 {
+			t.Error("SCAN returned more keys than COUNT:", resp)
+		}
+		for _, k := range fields[1:] {
+			if got[k] {
+				t.Error("SCAN returned a key twice:", k)
+			}
+			got[k] = true
+		}
+		if cursor == "0" {
+			break
+		}
+	}
+	if len(got) != len(want) {
+		t.Errorf("SCAN returned %d keys, expected %d", len(got), len(want))
+	}
+	if resp := cl.do("FLUSHALL"); resp != "+OK" || c.ItemCount() != 0 {
+		t.Error("cache was not flushed:", resp)
+	}
+	if resp := cl.do("INFO"); !strings.Contains(resp, "# Keyspace") {
+		t.Error("unexpected INFO reply:", resp)
+	}
+}
+
+func TestPipelineAndRESP3(t *testing.T) {
+	_, cl := startServer(t)
+	req := encodeCommand("SET", "a", "1") + encodeCommand("INCR", "a") + encodeCommand("GET", "missing")
+	if _, err := cl.conn.Write([]byte(req)); err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{"+OK", ":2", "nil"} {
+		if resp := cl.readReply(); resp != want {
+			t.Errorf("got %q, expected %q", resp, want)
+		}
+	}
+	if resp := cl.do("HELLO", "3"); !strings.Contains(resp, "proto :3") {
+		t.Error("unexpected HELLO reply:", resp)
+	}
+	if resp := cl.do("GET", "missing"); resp != "_" {
+		t.Error("RESP3 null was not used:", resp)
+	}
+	if _, err := cl.conn.Write([]byte("PING\r\n")); err != nil {
+		t.Fatal(err)
+	}
+	if resp := cl.readReply(); resp != "+PONG" {
+		t.Error("inline command failed:", resp)
+	}
+}
+
+func TestReadOnly(t *testing.T) {
+	c, cl := startServer(t)
+	follow(t, c)
+	for _, args := range [][]string{
+		{"SET", "foo", "bar"},
+		{"DEL", "foo"},
+		{"INCR", "n"},
+		{"FLUSHALL"},
+	} {
+		if resp := cl.do(args...); !strings.HasPrefix(resp, "-READONLY ") {
+			t.Errorf("%v: unexpected reply %q", args, resp)
+		}
+	}
+	if resp := cl.do("GET", "foo"); resp != "nil" {
+		t.Error("unexpected reply to GET:", resp)
+	}
+}
+
+func TestReadCommandHugeLength(t *testing.T) {
+	r := bufio.NewReader(strings.NewReader("*1048576\r\n$1\r\na\r\n"))
+	var ms runtime.MemStats
+	runtime.ReadMemStats(&ms)
+	before := ms.TotalAlloc
+	if _, err := readCommand(r, DefaultMaxBulkSize); err == nil {
+		t.Fatal("truncated request was read")
+	}
+	runtime.ReadMemStats(&ms)
+	if n := ms.TotalAlloc - before; n > 1<<20 {
+		t.Errorf("%d bytes were allocated for a request of one argument", n)
+	}
+}
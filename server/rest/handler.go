@@ -0,0 +1,326 @@
+// Package rest exposes a cache.Cache as an HTTP REST API, for debugging and
+// for access from other languages:
+//
+//	GET    /keys/{key}       value of the key
+//	PUT    /keys/{key}       store the request body as the value of the key
+//	DELETE /keys/{key}       delete the key
+//	POST   /keys/{key}/incr  increment the value of the key by the by query
+//	                         parameter (1 by default), returns the new value
+//	GET    /keys?prefix=     JSON array of keys, optionally only those with
+//	                         the prefix
+//	DELETE /keys             flush the cache
+//
+// PUT stores the body as []byte, or, if the Content-Type is application/json,
+// as the decoded JSON value, with numbers decoded as int64 or float64. The
+// expiration is taken from the ttl query parameter or the TTL header (Go
+// duration like 1m30s, or number of seconds), the default expiration of the
+// cache is used if neither is set. "If-None-Match: *" makes PUT store the value
+// only if the key doesn't exist (cache.Add), "If-Match: *" only if it does
+// (cache.Replace).
+//
+// GET returns []byte values as application/octet-stream, strings as
+// text/plain and other values as JSON. The TTL header of the response holds
+// the number of seconds until the item expires, if it expires.
+//
+// Errors are reported with status codes: 404 for cache.ErrNotExists, 409 for
+// cache.ErrAlreadyExists, 422 for cache.ErrInvalidType and 403 for
+// cache.ErrReadOnly, which is returned for writes while the cache follows a
+// leader.
+package rest
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"io"
+	"math"
+	"mime"
+	"net/http"
+	"reflect"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/sot-tech/go-cache"
+)
+
+// TTLHeader is the name of the header with item TTL.
+const TTLHeader = "TTL"
+
+// DefaultMaxBodySize is the default limit of PUT request body size.
+const DefaultMaxBodySize = 1 << 20
+
+// Handler HTTP handler of a cache.
+type Handler struct {
+	c   *cache.Cache
+	mux *http.ServeMux
+	// MaxBodySize is the limit of PUT request body size, DefaultMaxBodySize
+	// if zero.
+	MaxBodySize int64
+}
+
+var errBadTTL = errors.New("invalid ttl")
+
+// New Returns a handler of the cache c. The handler expects paths starting
+// with /keys, use http.StripPrefix to mount it under another path.
+func New(c *cache.Cache) *Handler {
+	h := &Handler{c: c, mux: http.NewServeMux()}
+	h.mux.HandleFunc("GET /keys/{key}", h.get)
+	h.mux.HandleFunc("PUT /keys/{key}", h.writable(h.put))
+	h.mux.HandleFunc("DELETE /keys/{key}", h.writable(h.delete))
+	h.mux.HandleFunc("POST /keys/{key}/incr", h.writable(h.incr))
+	h.mux.HandleFunc("GET /keys", h.list)
+	h.mux.HandleFunc("DELETE /keys", h.writable(h.flush))
+	return h
+}
+
+func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	h.mux.ServeHTTP(w, r)
+}
+
+// writable rejects the requests of f while the cache follows a leader.
+func (h *Handler) writable(f http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if h.c.ReadOnly() {
+			writeError(w, cache.ErrReadOnly)
+			return
+		}
+		f(w, r)
+	}
+}
+
+func writeError(w http.ResponseWriter, err error) {
+	code := http.StatusInternalServerError
+	switch {
+	case errors.Is(err, cache.ErrNotExists):
+		code = http.StatusNotFound
+	case errors.Is(err, cache.ErrAlreadyExists):
+		code = http.StatusConflict
+	case errors.Is(err, cache.ErrInvalidType):
+		code = http.StatusUnprocessableEntity
+	case errors.Is(err, cache.ErrReadOnly):
+		code = http.StatusForbidden
+	case errors.Is(err, errBadTTL):
+		code = http.StatusBadRequest
+	}
+	var maxErr *http.MaxBytesError
+	if errors.As(err, &maxErr) {
+		code = http.StatusRequestEntityTooLarge
+	}
+	http.Error(w, err.Error(), code)
+}
+
+func writeJSON(w http.ResponseWriter, v any) {
+	b, err := json.Marshal(v)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	_, _ = w.Write(append(b, '\n'))
+}
+
+func (h *Handler) get(w http.ResponseWriter, r *http.Request) {
+	x, ttl, found := h.c.GetWithRemainingTTL(r.PathValue("key"))
+	if !found {
+		writeError(w, cache.ErrNotExists)
+		return
+	}
+	if ttl != cache.NoExpiration {
+		w.Header().Set(TTLHeader, strconv.FormatInt(int64(math.Ceil(ttl.Seconds())), 10))
+	}
+	switch v := x.(type) {
+	case []byte:
+		w.Header().Set("Content-Type", "application/octet-stream")
+		_, _ = w.Write(v)
+	case string:
+		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+		_, _ = io.WriteString(w, v)
+	default:
+		writeJSON(w, v)
+	}
+}
+
+// parseTTL returns the expiration requested by the ttl query parameter or the
+// TTL header.
+func parseTTL(r *http.Request) (time.Duration, error) {
+	s := r.URL.Query().Get("ttl")
+	if s == "" {
+		s = r.Header.Get(TTLHeader)
+	}
+	if s == "" {
+		return cache.DefaultExpiration, nil
+	}
+	if n, err := strconv.ParseInt(s, 10, 64); err == nil && n > 0 {
+		return time.Duration(n) * time.Second, nil
+	}
+	if d, err := time.ParseDuration(s); err == nil && d > 0 {
+		return d, nil
+	}
+	return 0, errBadTTL
+}
+
+func (h *Handler) put(w http.ResponseWriter, r *http.Request) {
+	d, err := parseTTL(r)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	maxSize := h.MaxBodySize
+	if maxSize <= 0 {
+		maxSize = DefaultMaxBodySize
+	}
+	body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maxSize))
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	var x any = body
+	if mt, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type")); mt == "application/json" {
+		if x, err = decodeJSON(body); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+	}
+	k := r.PathValue("key")
+	switch {
+	case r.Header.Get("If-None-Match") == "*":
+		err = h.c.Add(k, x, d)
+	case r.Header.Get("If-Match") == "*":
+		err = h.c.Replace(k, x, d)
+	default:
+		err = h.c.TrySet(k, x, d)
+	}
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// decodeJSON decodes a JSON value, numbers are decoded as int64 if possible,
+// and as float64 otherwise.
+func decodeJSON(data []byte) (any, error) {
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+	var v any
+	if err := dec.Decode(&v); err != nil {
+		return nil, err
+	}
+	if dec.More() {
+		return nil, errors.New("invalid JSON: multiple values")
+	}
+	return normalizeNumbers(v), nil
+}
+
+func normalizeNumbers(v any) any {
+	switch x := v.(type) {
+	case json.Number:
+		if n, err := x.Int64(); err == nil {
+			return n
+		}
+		f, _ := x.Float64()
+		return f
+	case []any:
+		for i := range x {
+			x[i] = normalizeNumbers(x[i])
+		}
+	case map[string]any:
+		for k := range x {
+			x[k] = normalizeNumbers(x[k])
+		}
+	}
+	return v
+}
+
+func (h *Handler) delete(w http.ResponseWriter, r *http.Request) {
+	found, err := h.c.TryDelete(r.PathValue("key"))
+	if err == nil && !found {
+		err = cache.ErrNotExists
+	}
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (h *Handler) incr(w http.ResponseWriter, r *http.Request) {
+	by := r.URL.Query().Get("by")
+	if by == "" {
+		by = "1"
+	}
+	n, intErr := strconv.ParseInt(by, 10, 64)
+	f, err := strconv.ParseFloat(by, 64)
+	if err != nil {
+		http.Error(w, "invalid increment", http.StatusBadRequest)
+		return
+	}
+	var result any
+	err = h.c.Modify(r.PathValue("key"), func(x any) (any, error) {
+		switch v := x.(type) {
+		case []byte:
+			cur, err := strconv.ParseInt(string(bytes.TrimSpace(v)), 10, 64)
+			if err != nil || intErr != nil {
+				return nil, cache.ErrInvalidType
+			}
+			result = cur + n
+			return strconv.AppendInt(nil, cur+n, 10), nil
+		case string:
+			cur, err := strconv.ParseInt(strings.TrimSpace(v), 10, 64)
+			if err != nil || intErr != nil {
+				return nil, cache.ErrInvalidType
+			}
+			result = cur + n
+			return strconv.FormatInt(cur+n, 10), nil
+		}
+		rv := reflect.ValueOf(x)
+		if !rv.IsValid() {
+			return nil, cache.ErrInvalidType
+		}
+		nv := reflect.New(rv.Type()).Elem()
+		switch rv.Kind() {
+		case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+			if intErr != nil {
+				return nil, cache.ErrInvalidType
+			}
+			nv.SetInt(rv.Int() + n)
+		case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+			if intErr != nil {
+				return nil, cache.ErrInvalidType
+			}
+			nv.SetUint(rv.Uint() + uint64(n))
+		case reflect.Float32, reflect.Float64:
+			nv.SetFloat(rv.Float() + f)
+		default:
+			return nil, cache.ErrInvalidType
+		}
+		result = nv.Interface()
+		return result, nil
+	})
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	writeJSON(w, result)
+}
+
+func (h *Handler) list(w http.ResponseWriter, r *http.Request) {
+	prefix := r.URL.Query().Get("prefix")
+	keys := []string{}
+	for k := range h.c.ScanPrefix(prefix) {
+		keys = append(keys, k)
+	}
+	// Keys are only sorted by ScanPrefix with a prefix index.
+	slices.Sort(keys)
+	writeJSON(w, keys)
+}
+
+func (h *Handler) flush(w http.ResponseWriter, _ *http.Request) {
+	if err := h.c.TryFlush(); err != nil {
+		writeError(w, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,160 @@
+package rest
+
+import (
+	"context"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/sot-tech/go-cache"
+)
+
+func do(t *testing.T, h http.Handler, method, target, body string, header map[string]string) *httptest.ResponseRecorder {
+	t.Helper()
+	var rb io.Reader
+	if body != "" {
+		rb = strings.NewReader(body)
+	}
+	r := httptest.NewRequest(method, target, rb)
+	for k, v := range header {
+		r.Header.Set(k, v)
+	}
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, r)
+	return w
+}
+
+// follow makes c follow an empty leader until the end of the test.
+func follow(t *testing.T, c *cache.Cache) {
+	t.Helper()
+	leader := cache.New(cache.DefaultExpiration, 0)
+	l := leader.Lead(cache.LeaderConfig{})
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		_ = c.Follow(ctx, cache.FollowerConfig{Dial: func(ctx context.Context) (io.ReadWriteCloser, error) {
+			a, b := net.Pipe()
+			go func() {
+				_ = l.Serve(ctx, b)
+				_ = b.Close()
+			}()
+			return a, nil
+		}})
+	}()
+	t.Cleanup(func() {
+		cancel()
+		<-done
+		l.Close()
+		_ = leader.Close()
+	})
+	for !c.ReadOnly() {
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func TestHandler(t *testing.T) {
+	c := cache.New(cache.NoExpiration, 0)
+	defer c.Close()
+	h := New(c)
+	json := map[string]string{"Content-Type": "application/json"}
+	for _, tt := range []struct {
+		method, target, body string
+		header               map[string]string
+		code                 int
+		resp                 string
+	}{
+		{"GET", "/keys/foo", "", nil, http.StatusNotFound, ""},
+		{"PUT", "/keys/foo?ttl=1m", "bar", nil, http.StatusNoContent, ""},
+		{"GET", "/keys/foo", "", nil, http.StatusOK, "bar"},
+		{"PUT", "/keys/foo", "baz", map[string]string{"If-None-Match": "*"}, http.StatusConflict, ""},
+		{"PUT", "/keys/new", "baz", map[string]string{"If-Match": "*"}, http.StatusNotFound, ""},
+		{"PUT", "/keys/foo", "x", map[string]string{"TTL": "soon"}, http.StatusBadRequest, ""},
+		{"PUT", "/keys/obj", `{"a":1,"b":[1.5]}`, json, http.StatusNoContent, ""},
+		{"GET", "/keys/obj", "", nil, http.StatusOK, `{"a":1,"b":[1.5]}` + "\n"},
+		{"PUT", "/keys/n", "41", json, http.StatusNoContent, ""},
+		{"POST", "/keys/n/incr", "", nil, http.StatusOK, "42\n"},
+		{"PUT", "/keys/raw", "10", nil, http.StatusNoContent, ""},
+		{"POST", "/keys/raw/incr?by=-3", "", nil, http.StatusOK, "7\n"},
+		{"GET", "/keys/raw", "", nil, http.StatusOK, "7"},
+		{"POST", "/keys/foo/incr", "", nil, http.StatusUnprocessableEntity, ""},
+		{"POST", "/keys/missing/incr", "", nil, http.StatusNotFound, ""},
+		{"GET", "/keys?prefix=n", "", nil, http.StatusOK, `["n","new"]` + "\n"},
+		{"DELETE", "/keys/foo", "", nil, http.StatusNoContent, ""},
+		{"DELETE", "/keys/foo", "", nil, http.StatusNotFound, ""},
+		{"GET", "/keys", "", nil, http.StatusOK, `["n","obj","raw"]` + "\n"},
+		{"DELETE", "/keys", "", nil, http.StatusNoContent, ""},
+		{"GET", "/keys", "", nil, http.StatusOK, "[]\n"},
+		{"PATCH", "/keys/foo", "", nil, http.StatusMethodNotAllowed, ""},
+	} {
+		if tt.target == "/keys?prefix=n" {
+			c.Set("new", "x", cache.DefaultExpiration)
+		}
+		if tt.target == "/keys" && tt.method == "GET" && tt.resp != "[]\n" {
+			c.Delete("new")
+		}
+		w := do(t, h, tt.method, tt.target, tt.body, tt.header)
+		if w.Code != tt.code {
+			t.Errorf("%s %s: status %d, expected %d: %s", tt.method, tt.target, w.Code, tt.code, w.Body)
+			continue
+		}
+		if tt.resp != "" && w.Body.String() != tt.resp {
+			t.Errorf("%s %s: body %q, expected %q", tt.method, tt.target, w.Body, tt.resp)
+		}
+	}
+}
+
+func TestHandlerTTL(t *testing.T) {
+	c := cache.New(cache.NoExpiration, 0)
+	defer c.Close()
+	h := New(c)
+	do(t, h, "PUT", "/keys/foo", "bar", map[string]string{TTLHeader: "30"})
+	w := do(t, h, "GET", "/keys/foo", "", nil)
+	if ttl := w.Header().Get(TTLHeader); ttl != "30" {
+		t.Error("unexpected TTL header:", ttl)
+	}
+	if ct := w.Header().Get("Content-Type"); ct != "application/octet-stream" {
+		t.Error("unexpected Content-Type:", ct)
+	}
+	c.Set("str", "s", cache.NoExpiration)
+	w = do(t, h, "GET", "/keys/str", "", nil)
+	if w.Header().Get(TTLHeader) != "" || !strings.HasPrefix(w.Header().Get("Content-Type"), "text/plain") {
+		t.Error("unexpected headers for string value:", w.Header())
+	}
+}
+
+func TestHandlerReadOnly(t *testing.T) {
+	c := cache.New(cache.NoExpiration, 0)
+	defer c.Close()
+	h := New(c)
+	follow(t, c)
+	for _, tt := range []struct{ method, target string }{
+		{"PUT", "/keys/foo"},
+		{"DELETE", "/keys/foo"},
+		{"POST", "/keys/foo/incr"},
+		{"DELETE", "/keys"},
+	} {
+		if w := do(t, h, tt.method, tt.target, "1", nil); w.Code != http.StatusForbidden {
+			t.Errorf("%s %s: unexpected status %d", tt.method, tt.target, w.Code)
+		}
+	}
+	if w := do(t, h, "GET", "/keys/foo", "", nil); w.Code != http.StatusNotFound {
+		t.Error("unexpected status of GET:", w.Code)
+	}
+}
+
+func TestHandlerListPrefixIndex(t *testing.T) {
+	c := cache.NewWithOptions(cache.DefaultExpiration, 0, cache.WithPrefixIndex())
+	defer c.Close()
+	for _, k := range []string{"user:2", "other", "user:1", "user"} {
+		c.Set(k, 1, cache.DefaultExpiration)
+	}
+	w := do(t, New(c), "GET", "/keys?prefix=user:", "", nil)
+	if body := w.Body.String(); w.Code != http.StatusOK || body != `["user:1","user:2"]`+"\n" {
+		t.Errorf("unexpected response: %d %s", w.Code, body)
+	}
+}
@@ -0,0 +1,255 @@
+package cache
+
+import (
+	"bytes"
+	"encoding/gob"
+	"encoding/json"
+	"maps"
+	"slices"
+)
+
+// StringSet A set of strings stored by SAdd. A StringSet stored in the cache
+// is never changed: set operations store a new StringSet, so a StringSet
+// returned by Get can be read while other goroutines change the set.
+type StringSet struct {
+	m map[string]struct{}
+}
+
+// NewStringSet Returns a set of the members.
+func NewStringSet(members ...string) *StringSet {
+	s := &StringSet{m: make(map[string]struct{}, len(members))}
+	s.add(members)
+	return s
+}
+
+// clone returns a copy of the set.
+func (s *StringSet) clone() *StringSet {
+	m := maps.Clone(s.m)
+	if m == nil {
+		m = make(map[string]struct{})
+	}
+	return &StringSet{m: m}
+}
+
+func (s *StringSet) add(members []string) int {
+	n := len(s.m)
+	for _, m := range members {
+		s.m[m] = struct{}{}
+	}
+	return len(s.m) - n
+}
+
+func (s *StringSet) remove(members []string) (int, int) {
+	n := len(s.m)
+	for _, m := range members {
+		delete(s.m, m)
+	}
+	return n - len(s.m), len(s.m)
+}
+
+// Len Returns the number of members of the set.
+func (s *StringSet) Len() int {
+	return len(s.m)
+}
+
+// Contains Reports whether m is a member of the set.
+func (s *StringSet) Contains(m string) bool {
+	_, found := s.m[m]
+	return found
+}
+
+// Members Returns the members of the set, sorted.
+func (s *StringSet) Members() []string {
+	members := slices.Sorted(maps.Keys(s.m))
+	if members == nil {
+		members = []string{}
+	}
+	return members
+}
+
+// GobEncode Encodes the members of the set with Gob.
+func (s *StringSet) GobEncode() ([]byte, error) {
+	var buf bytes.Buffer
+	if err := gob.NewEncoder(&buf).Encode(s.Members()); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// GobDecode Decodes the set encoded by GobEncode.
+func (s *StringSet) GobDecode(data []byte) error {
+	var members []string
+	if err := gob.NewDecoder(bytes.NewReader(data)).Decode(&members); err != nil {
+		return err
+	}
+	*s = StringSet{m: make(map[string]struct{}, len(members))}
+	s.add(members)
+	return nil
+}
+
+// MarshalJSON Encodes the set as a sorted JSON array.
+func (s *StringSet) MarshalJSON() ([]byte, error) {
+	return json.Marshal(s.Members())
+}
+
+// UnmarshalJSON Decodes the set from a JSON array.
+func (s *StringSet) UnmarshalJSON(data []byte) error {
+	var members []string
+	if err := json.Unmarshal(data, &members); err != nil {
+		return err
+	}
+	*s = StringSet{m: make(map[string]struct{}, len(members))}
+	s.add(members)
+	return nil
+}
+
+// getSet returns the set of k, nil if the key doesn't exist, or
+// ErrInvalidType if its value isn't a *StringSet.
+func (c *cache) getSet(k string) (*StringSet, error) {
+	x, found := c.get(k)
+	if !found {
+		return nil, nil
+	}
+	s, ok := x.(*StringSet)
+	if !ok {
+		return nil, ErrInvalidType
+	}
+	return s, nil
+}
+
+// SAdd Adds the members to the set of k and returns the number of members
+// which weren't in the set. A new set with the default expiration is created
+// if the key doesn't exist, otherwise the expiration is kept. Returns
+// ErrInvalidType if the value of k isn't a *StringSet.
+func (c *cache) SAdd(k string, members ...string) (int, error) {
+	var n int
+	err := c.modifyValue(k, func() any {
+		return NewStringSet()
+	}, func(x any) (any, error) {
+		s, ok := x.(*StringSet)
+		if !ok {
+			return nil, ErrInvalidType
+		}
+		s = s.clone()
+		if n = s.add(members); s.Len() == 0 {
+			return nil, nil
+		}
+		return s, nil
+	})
+	return n, err
+}
+
+// SRem Removes the members from the set of k and returns the number of
+// removed members. The key is deleted when its last member is removed.
+// Returns ErrInvalidType if the value of k isn't a *StringSet.
+func (c *cache) SRem(k string, members ...string) (int, error) {
+	var n int
+	err := c.modifyValue(k, nil, func(x any) (any, error) {
+		s, ok := x.(*StringSet)
+		if !ok {
+			return nil, ErrInvalidType
+		}
+		s = s.clone()
+		var left int
+		if n, left = s.remove(members); left == 0 {
+			return nil, nil
+		}
+		return s, nil
+	})
+	if err == ErrNotExists {
+		return 0, nil
+	}
+	return n, err
+}
+
+// SIsMember Reports whether m is a member of the set of k. Returns
+// ErrInvalidType if the value of k isn't a *StringSet.
+func (c *cache) SIsMember(k, m string) (bool, error) {
+	s, err := c.getSet(k)
+	if s == nil {
+		return false, err
+	}
+	return s.Contains(m), nil
+}
+
+// SMembers Returns the members of the set of k, sorted, or an empty slice if
+// the key doesn't exist. Returns ErrInvalidType if the value of k isn't a
+// *StringSet.
+func (c *cache) SMembers(k string) ([]string, error) {
+	s, err := c.getSet(k)
+	if s == nil {
+		if err != nil {
+			return nil, err
+		}
+		return []string{}, nil
+	}
+	return s.Members(), nil
+}
+
+// SCard Returns the number of members of the set of k, zero if the key
+// doesn't exist. Returns ErrInvalidType if the value of k isn't a *StringSet.
+func (c *cache) SCard(k string) (int, error) {
+	s, err := c.getSet(k)
+	if s == nil {
+		return 0, err
+	}
+	return s.Len(), nil
+}
+
+// SInter Returns the members of all sets of keys, sorted. Missing keys are
+// treated as empty sets. The sets are read one by one, use Txn with
+// StringSet.Members for a consistent view of several sets. Returns
+// ErrInvalidType if the value of any of the keys isn't a *StringSet.
+func (c *cache) SInter(keys ...string) ([]string, error) {
+	var result map[string]struct{}
+	for i, k := range keys {
+		s, err := c.getSet(k)
+		if err != nil {
+			return nil, err
+		}
+		var members []string
+		if s != nil {
+			members = s.Members()
+		}
+		if i == 0 {
+			result = make(map[string]struct{}, len(members))
+			for _, m := range members {
+				result[m] = struct{}{}
+			}
+			continue
+		}
+		next := make(map[string]struct{})
+		for _, m := range members {
+			if _, found := result[m]; found {
+				next[m] = struct{}{}
+			}
+		}
+		result = next
+	}
+	members := slices.Sorted(maps.Keys(result))
+	if members == nil {
+		members = []string{}
+	}
+	return members, nil
+}
+
+// SUnion Returns the members of any of the sets of keys, sorted, see SInter.
+func (c *cache) SUnion(keys ...string) ([]string, error) {
+	result := make(map[string]struct{})
+	for _, k := range keys {
+		s, err := c.getSet(k)
+		if err != nil {
+			return nil, err
+		}
+		if s != nil {
+			for _, m := range s.Members() {
+				result[m] = struct{}{}
+			}
+		}
+	}
+	members := slices.Sorted(maps.Keys(result))
+	if members == nil {
+		members = []string{}
+	}
+	return members, nil
+}
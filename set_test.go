@@ -0,0 +1,162 @@
+package cache
+
+import (
+	"encoding/json"
+	"slices"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestStringSet(t *testing.T) {
+	tc := New(DefaultExpiration, 0)
+	defer tc.Close()
+	if n, err := tc.SAdd("s", "a", "b", "a"); n != 2 || err != nil {
+		t.Fatal(n, err)
+	}
+	if n, err := tc.SAdd("s", "b", "c"); n != 1 || err != nil {
+		t.Fatal(n, err)
+	}
+	if ok, _ := tc.SIsMember("s", "c"); !ok {
+		t.Error("c is not a member")
+	}
+	if ok, _ := tc.SIsMember("s", "d"); ok {
+		t.Error("d is a member")
+	}
+	if members, _ := tc.SMembers("s"); !slices.Equal(members, []string{"a", "b", "c"}) {
+		t.Error("unexpected members:", members)
+	}
+	if n, _ := tc.SCard("s"); n != 3 {
+		t.Error("unexpected cardinality:", n)
+	}
+	tc.SAdd("t", "b", "c", "d")
+	if members, _ := tc.SInter("s", "t"); !slices.Equal(members, []string{"b", "c"}) {
+		t.Error("unexpected intersection:", members)
+	}
+	if members, _ := tc.SInter("s", "t", "missing"); len(members) != 0 {
+		t.Error("unexpected intersection with a missing key:", members)
+	}
+	if members, _ := tc.SUnion("s", "t", "missing"); !slices.Equal(members, []string{"a", "b", "c", "d"}) {
+		t.Error("unexpected union:", members)
+	}
+	if n, err := tc.SRem("s", "a", "z"); n != 1 || err != nil {
+		t.Error("unexpected SRem result:", n, err)
+	}
+	if n, err := tc.SRem("s", "b", "c"); n != 2 || err != nil {
+		t.Error("unexpected SRem result:", n, err)
+	}
+	if _, found := tc.Get("s"); found {
+		t.Error("empty set was not deleted")
+	}
+	if n, err := tc.SRem("s", "a"); n != 0 || err != nil {
+		t.Error("unexpected SRem result for a missing key:", n, err)
+	}
+	if members, err := tc.SMembers("s"); members == nil || len(members) != 0 || err != nil {
+		t.Error("unexpected members of a missing key:", members, err)
+	}
+}
+
+func TestStringSetSnapshot(t *testing.T) {
+	tc := New(DefaultExpiration, 0)
+	defer tc.Close()
+	tc.SAdd("s", "a", "b")
+	x, _ := tc.Get("s")
+	s := x.(*StringSet)
+	tc.SAdd("s", "c")
+	tc.SRem("s", "a")
+	if members := s.Members(); !slices.Equal(members, []string{"a", "b"}) {
+		t.Error("set returned by Get was changed:", members)
+	}
+	if members, _ := tc.SMembers("s"); !slices.Equal(members, []string{"b", "c"}) {
+		t.Error("unexpected members:", members)
+	}
+}
+
+func TestStringSetInvalidType(t *testing.T) {
+	tc := New(DefaultExpiration, 0)
+	defer tc.Close()
+	tc.Set("x", 1, DefaultExpiration)
+	if _, err := tc.SAdd("x", "a"); err != ErrInvalidType {
+		t.Error("unexpected SAdd error:", err)
+	}
+	if _, err := tc.SRem("x", "a"); err != ErrInvalidType {
+		t.Error("unexpected SRem error:", err)
+	}
+	if _, err := tc.SIsMember("x", "a"); err != ErrInvalidType {
+		t.Error("unexpected SIsMember error:", err)
+	}
+	if _, err := tc.SUnion("s", "x"); err != ErrInvalidType {
+		t.Error("unexpected SUnion error:", err)
+	}
+	if x, _ := tc.Get("x"); x != 1 {
+		t.Error("value was changed:", x)
+	}
+}
+
+func TestStringSetExpiration(t *testing.T) {
+	tc := New(50*time.Millisecond, time.Millisecond)
+	defer tc.Close()
+	tc.SAdd("s", "a")
+	_, exp1, _ := tc.GetWithExpiration("s")
+	tc.SAdd("s", "b")
+	_, exp2, _ := tc.GetWithExpiration("s")
+	if !exp1.Equal(exp2) {
+		t.Error("SAdd changed the expiration:", exp1, exp2)
+	}
+	<-time.After(100 * time.Millisecond)
+	if n, _ := tc.SCard("s"); n != 0 {
+		t.Error("expired set has members:", n)
+	}
+	if n, _ := tc.SAdd("s", "c"); n != 1 {
+		t.Error("expired set was not replaced:", n)
+	}
+}
+
+func TestStringSetEncoding(t *testing.T) {
+	s := NewStringSet("b", "a")
+	data, err := json.Marshal(s)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(data) != `["a","b"]` {
+		t.Error("unexpected JSON:", string(data))
+	}
+	var s2 StringSet
+	if err := json.Unmarshal(data, &s2); err != nil {
+		t.Fatal(err)
+	}
+	if !s2.Contains("a") || s2.Len() != 2 {
+		t.Error("unexpected decoded set:", s2.Members())
+	}
+	data, err = s.GobEncode()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var s3 StringSet
+	if err := s3.GobDecode(data); err != nil {
+		t.Fatal(err)
+	}
+	if !slices.Equal(s3.Members(), []string{"a", "b"}) {
+		t.Error("unexpected decoded set:", s3.Members())
+	}
+}
+
+func TestStringSetConcurrent(t *testing.T) {
+	tc := New(DefaultExpiration, 0)
+	defer tc.Close()
+	var wg sync.WaitGroup
+	for i := range 8 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := range 100 {
+				tc.SAdd("s", string(rune('a'+i)), string(rune('A'+j%26)))
+				tc.SMembers("s")
+			}
+		}()
+	}
+	wg.Wait()
+	if n, _ := tc.SCard("s"); n != 8+26 {
+		t.Error("unexpected cardinality:", n)
+	}
+}
@@ -26,6 +26,8 @@ type shardedCache struct {
 	m       uint32
 	cs      []*cache
 	janitor *shardedJanitor
+	// stopClock stops the goroutine updating the clocks of the shards.
+	stopClock chan any
 }
 
 // djb2 with better shuffling. 5x faster than FNV with the hash.Hash overhead.
@@ -127,7 +129,6 @@ type shardedJanitor struct {
 }
 
 func (j *shardedJanitor) Run(sc *shardedCache) {
-	j.stop = make(chan bool)
 	tick := time.Tick(j.Interval)
 	for {
 		select {
@@ -140,17 +141,41 @@ func (j *shardedJanitor) Run(sc *shardedCache) {
 }
 
 func stopShardedJanitor(sc *unexportedShardedCache) {
-	sc.janitor.stop <- true
+	if sc.janitor != nil {
+		sc.janitor.stop <- true
+	}
+	close(sc.stopClock)
 }
 
 func runShardedJanitor(sc *shardedCache, ci time.Duration) {
 	j := &shardedJanitor{
 		Interval: ci,
+		stop:     make(chan bool),
 	}
 	sc.janitor = j
 	go j.Run(sc)
 }
 
+// runShardedClock updates the clocks of the shards every clockTick, the
+// same as a cache does, until sc.stopClock is closed.
+func runShardedClock(sc *shardedCache) {
+	sc.stopClock = make(chan any)
+	go func() {
+		tick := time.NewTicker(sc.cs[0].clockTick)
+		defer tick.Stop()
+		for {
+			select {
+			case now := <-tick.C:
+				for _, c := range sc.cs {
+					c.timeCache.Store(now.UnixNano())
+				}
+			case <-sc.stopClock:
+				return
+			}
+		}
+	}()
+}
+
 func newShardedCache(n int, de time.Duration) *shardedCache {
 	rndBytes := make([]byte, 4)
 	if _, err := rand.Read(rndBytes); err != nil {
@@ -162,11 +187,14 @@ func newShardedCache(n int, de time.Duration) *shardedCache {
 		m:    uint32(n),
 		cs:   make([]*cache, n),
 	}
+	now := time.Now().UnixNano()
 	for i := 0; i < n; i++ {
 		c := &cache{
 			defaultExpiration: de,
 			items:             sync.Map{},
+			clockTick:         time.Second,
 		}
+		c.timeCache.Store(now)
 		sc.cs[i] = c
 	}
 	return sc
@@ -178,9 +206,10 @@ func unexportedNewSharded(defaultExpiration, cleanupInterval time.Duration, shar
 	}
 	sc := newShardedCache(shards, defaultExpiration)
 	SC := &unexportedShardedCache{sc}
+	runShardedClock(sc)
 	if cleanupInterval > 0 {
 		runShardedJanitor(sc, cleanupInterval)
-		runtime.SetFinalizer(SC, stopShardedJanitor)
 	}
+	runtime.SetFinalizer(SC, stopShardedJanitor)
 	return SC
 }
@@ -0,0 +1,248 @@
+package cache
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"io"
+)
+
+// Snapshots written by Save have the following layout:
+//
+//	magic "GOCACHE1"
+//	int64 time of the save in unix nanoseconds, little endian
+//	records, each starting with a tag byte:
+//		recCodec: uvarint codec id, string codec name
+//		recItem:  string key, varint expiration, uvarint codec id, bytes value
+//		recEnd:   end of the snapshot
+//
+// Strings and bytes are prefixed with their uvarint length. A codec record
+// precedes the first item encoded with that codec.
+var snapshotMagic = []byte("GOCACHE1")
+
+const (
+	recEnd byte = iota
+	recItem
+	recCodec
+)
+
+// maxFieldSize is the upper bound of a single encoded field, anything larger
+// is treated as corrupted data.
+const maxFieldSize = 1 << 30
+
+var errCorruptSnapshot = errors.New("corrupt snapshot")
+
+type byteReader interface {
+	io.Reader
+	io.ByteReader
+}
+
+func appendBytes(b, v []byte) []byte {
+	b = binary.AppendUvarint(b, uint64(len(v)))
+	return append(b, v...)
+}
+
+func appendString(b []byte, s string) []byte {
+	b = binary.AppendUvarint(b, uint64(len(s)))
+	return append(b, s...)
+}
+
+func readBytes(r byteReader) ([]byte, error) {
+	n, err := binary.ReadUvarint(r)
+	if err != nil {
+		return nil, err
+	}
+	if n > maxFieldSize {
+		return nil, errCorruptSnapshot
+	}
+	b := make([]byte, n)
+	_, err = io.ReadFull(r, b)
+	return b, err
+}
+
+func readString(r byteReader) (string, error) {
+	b, err := readBytes(r)
+	return string(b), err
+}
+
+// writeSnapshot writes all items of the cache, including expired ones,
+// to w in the snapshot format.
+func (c *cache) writeSnapshot(w io.Writer) (err error) {
+	bw := bufio.NewWriter(w)
+	b := binary.LittleEndian.AppendUint64(append([]byte{}, snapshotMagic...), uint64(c.timeCache.Load()))
+	if _, err = bw.Write(b); err != nil {
+		return
+	}
+	ids := make(map[string]uint64)
+	c.items.Range(func(key, value any) bool {
+		item := value.(Item)
+		codec := c.codecFor(item.Object)
+		var data []byte
+		if data, err = codec.Marshal(item.Object); err != nil {
+			return false
+		}
+		b = b[:0]
+		id, found := ids[codec.Name()]
+		if !found {
+			id = uint64(len(ids))
+			ids[codec.Name()] = id
+			b = append(b, recCodec)
+			b = binary.AppendUvarint(b, id)
+			b = appendString(b, codec.Name())
+		}
+		b = append(b, recItem)
+		b = appendString(b, key.(string))
+		b = binary.AppendVarint(b, item.Expiration)
+		b = binary.AppendUvarint(b, id)
+		b = appendBytes(b, data)
+		_, err = bw.Write(b)
+		return err == nil
+	})
+	if err != nil {
+		return
+	}
+	if err = bw.WriteByte(recEnd); err != nil {
+		return
+	}
+	return bw.Flush()
+}
+
+// isSnapshot reports whether r starts with the snapshot magic, as opposed
+// to the legacy Gob-encoded items map.
+func isSnapshot(r *bufio.Reader) bool {
+	b, _ := r.Peek(len(snapshotMagic))
+	return bytes.Equal(b, snapshotMagic)
+}
+
+// readSnapshotHeader reads the header of a snapshot and returns the time the
+// snapshot was taken at.
+func readSnapshotHeader(r io.Reader) (int64, error) {
+	hdr := make([]byte, len(snapshotMagic)+8)
+	if _, err := io.ReadFull(r, hdr); err != nil {
+		return 0, noEOF(err)
+	}
+	if !bytes.Equal(hdr[:len(snapshotMagic)], snapshotMagic) {
+		return 0, errCorruptSnapshot
+	}
+	return int64(binary.LittleEndian.Uint64(hdr[len(snapshotMagic):])), nil
+}
+
+// readSnapshotItems decodes items of a snapshot written by writeSnapshot,
+// calling f for each of them. The header must have been read already.
+func (c *cache) readSnapshotItems(r *bufio.Reader, f func(k string, item Item)) error {
+	var codecs []Codec
+	for {
+		tag, err := r.ReadByte()
+		if err != nil {
+			return noEOF(err)
+		}
+		switch tag {
+		case recEnd:
+			return nil
+		case recCodec:
+			id, err := binary.ReadUvarint(r)
+			if err != nil {
+				return noEOF(err)
+			}
+			name, err := readString(r)
+			if err != nil {
+				return noEOF(err)
+			}
+			if id != uint64(len(codecs)) {
+				return errCorruptSnapshot
+			}
+			codec, err := c.codecByName(name)
+			if err != nil {
+				return err
+			}
+			codecs = append(codecs, codec)
+		case recItem:
+			k, err := readString(r)
+			if err != nil {
+				return noEOF(err)
+			}
+			exp, err := binary.ReadVarint(r)
+			if err != nil {
+				return noEOF(err)
+			}
+			id, err := binary.ReadUvarint(r)
+			if err != nil {
+				return noEOF(err)
+			}
+			if id >= uint64(len(codecs)) {
+				return errCorruptSnapshot
+			}
+			data, err := readBytes(r)
+			if err != nil {
+				return noEOF(err)
+			}
+			v, err := codecs[id].Unmarshal(data)
+			if err != nil {
+				return err
+			}
+			f(k, Item{Object: v, Expiration: exp})
+		default:
+			return errCorruptSnapshot
+		}
+	}
+}
+
+// noEOF converts io.EOF in the middle of data into io.ErrUnexpectedEOF.
+func noEOF(err error) error {
+	if errors.Is(err, io.EOF) {
+		return io.ErrUnexpectedEOF
+	}
+	return err
+}
+
+// appendLogRecord encodes rec for the append-only log: op byte, varint
+// time, key, varint expiration, codec name and value. Codec name and value
+// are empty if the record has no item.
+func (c *cache) appendLogRecord(b []byte, rec logRecord) ([]byte, error) {
+	b = append(b, byte(rec.Op))
+	b = binary.AppendVarint(b, rec.Time)
+	b = appendString(b, rec.Key)
+	b = binary.AppendVarint(b, rec.Item.Expiration)
+	if !rec.Op.stores() {
+		b = appendString(b, "")
+		return appendBytes(b, nil), nil
+	}
+	codec := c.codecFor(rec.Item.Object)
+	data, err := codec.Marshal(rec.Item.Object)
+	if err != nil {
+		return nil, err
+	}
+	b = appendString(b, codec.Name())
+	return appendBytes(b, data), nil
+}
+
+func (c *cache) readLogRecord(r byteReader) (rec logRecord, err error) {
+	var op byte
+	if op, err = r.ReadByte(); err != nil {
+		return
+	}
+	rec.Op = mutationOp(op)
+	if rec.Time, err = binary.ReadVarint(r); err != nil {
+		return
+	}
+	if rec.Key, err = readString(r); err != nil {
+		return
+	}
+	if rec.Item.Expiration, err = binary.ReadVarint(r); err != nil {
+		return
+	}
+	var name string
+	var data []byte
+	if name, err = readString(r); err != nil {
+		return
+	}
+	if data, err = readBytes(r); err != nil || name == "" {
+		return
+	}
+	var codec Codec
+	if codec, err = c.codecByName(name); err == nil {
+		rec.Item.Object, err = codec.Unmarshal(data)
+	}
+	return
+}
@@ -0,0 +1,421 @@
+package cache
+
+import (
+	"bytes"
+	"encoding/gob"
+	"encoding/json"
+	"errors"
+	"math"
+	"math/rand/v2"
+)
+
+// ErrNaN Returned by sorted set operations which would set a score to NaN.
+var ErrNaN = errors.New("score is not a number")
+
+// ScoredMember A member of a sorted set with its score.
+type ScoredMember struct {
+	Member string
+	Score  float64
+}
+
+// SortedSet A set of strings ordered by score, then by member, stored by
+// ZAdd. A SortedSet stored in the cache is never changed: sorted set
+// operations store a new SortedSet, so a SortedSet returned by Get can be
+// read while other goroutines change the set.
+type SortedSet struct {
+	scores map[string]float64
+	sl     zSkiplist
+}
+
+const zMaxLevel = 32
+
+// zSkiplist is a skiplist of the members of a sorted set. Each link stores
+// the number of nodes it skips, so the rank of a member is the sum of the
+// spans of the links followed to reach it.
+type zSkiplist struct {
+	head   *zNode
+	level  int
+	length int
+}
+
+type zNode struct {
+	ScoredMember
+	next []zLink
+}
+
+type zLink struct {
+	node *zNode
+	span int
+}
+
+// before reports whether n is ordered before the member with the score.
+func (n *zNode) before(score float64, member string) bool {
+	return n.Score < score || n.Score == score && n.Member < member
+}
+
+func zRandomLevel() int {
+	level := 1
+	for level < zMaxLevel && rand.IntN(4) == 0 {
+		level++
+	}
+	return level
+}
+
+func (sl *zSkiplist) init() {
+	if sl.head == nil {
+		sl.head = &zNode{next: make([]zLink, zMaxLevel)}
+		sl.level = 1
+	}
+}
+
+// insert adds a member which must not be in the skiplist.
+func (sl *zSkiplist) insert(member string, score float64) {
+	sl.init()
+	var update [zMaxLevel]*zNode
+	var rank [zMaxLevel]int
+	x := sl.head
+	for i := sl.level - 1; i >= 0; i-- {
+		if i < sl.level-1 {
+			rank[i] = rank[i+1]
+		}
+		for x.next[i].node != nil && x.next[i].node.before(score, member) {
+			rank[i] += x.next[i].span
+			x = x.next[i].node
+		}
+		update[i] = x
+	}
+	level := zRandomLevel()
+	for i := sl.level; i < level; i++ {
+		update[i] = sl.head
+		sl.head.next[i].span = sl.length
+	}
+	sl.level = max(sl.level, level)
+	n := &zNode{ScoredMember: ScoredMember{member, score}, next: make([]zLink, level)}
+	for i := range level {
+		prev := &update[i].next[i]
+		n.next[i] = zLink{node: prev.node, span: prev.span - (rank[0] - rank[i])}
+		*prev = zLink{node: n, span: rank[0] - rank[i] + 1}
+	}
+	for i := level; i < sl.level; i++ {
+		update[i].next[i].span++
+	}
+	sl.length++
+}
+
+// remove deletes a member which must be in the skiplist with the score.
+func (sl *zSkiplist) remove(member string, score float64) {
+	var update [zMaxLevel]*zNode
+	x := sl.head
+	for i := sl.level - 1; i >= 0; i-- {
+		for x.next[i].node != nil && x.next[i].node.before(score, member) {
+			x = x.next[i].node
+		}
+		update[i] = x
+	}
+	n := update[0].next[0].node
+	for i := range sl.level {
+		prev := &update[i].next[i]
+		if prev.node == n {
+			*prev = zLink{node: n.next[i].node, span: prev.span + n.next[i].span - 1}
+		} else {
+			prev.span--
+		}
+	}
+	for sl.level > 1 && sl.head.next[sl.level-1].node == nil {
+		sl.level--
+	}
+	sl.length--
+}
+
+// rank returns the zero-based rank of a member which must be in the
+// skiplist with the score.
+func (sl *zSkiplist) rank(member string, score float64) int {
+	var r int
+	x := sl.head
+	for i := sl.level - 1; i >= 0; i-- {
+		for x.next[i].node != nil && !(score < x.next[i].node.Score ||
+			score == x.next[i].node.Score && member < x.next[i].node.Member) {
+			r += x.next[i].span
+			x = x.next[i].node
+		}
+		if x != sl.head && x.Member == member {
+			break
+		}
+	}
+	return r - 1
+}
+
+// first returns the first node with a score of at least min, or nil.
+func (sl *zSkiplist) first(min float64) *zNode {
+	if sl.head == nil {
+		return nil
+	}
+	x := sl.head
+	for i := sl.level - 1; i >= 0; i-- {
+		for x.next[i].node != nil && x.next[i].node.Score < min {
+			x = x.next[i].node
+		}
+	}
+	return x.next[0].node
+}
+
+// NewSortedSet Returns a sorted set of the members. If a member is given
+// several times, the last score is kept.
+func NewSortedSet(members ...ScoredMember) *SortedSet {
+	z := &SortedSet{scores: make(map[string]float64, len(members))}
+	for _, m := range members {
+		z.set(m.Member, m.Score)
+	}
+	return z
+}
+
+// clone returns a copy of the sorted set.
+func (z *SortedSet) clone() *SortedSet {
+	return NewSortedSet(z.Members()...)
+}
+
+// set sets the score of the member, and reports whether it is new.
+func (z *SortedSet) set(member string, score float64) bool {
+	if z.scores == nil {
+		z.scores = make(map[string]float64)
+	}
+	old, found := z.scores[member]
+	if found {
+		if old == score {
+			return false
+		}
+		z.sl.remove(member, old)
+	}
+	z.scores[member] = score
+	z.sl.insert(member, score)
+	return !found
+}
+
+// removeRangeByScore deletes the members with a score in [min, max], and
+// returns their number.
+func (z *SortedSet) removeRangeByScore(min, max float64) int {
+	var n int
+	for x := z.sl.first(min); x != nil && x.Score <= max; {
+		next := x.next[0].node
+		delete(z.scores, x.Member)
+		z.sl.remove(x.Member, x.Score)
+		x = next
+		n++
+	}
+	return n
+}
+
+// Len Returns the number of members of the sorted set.
+func (z *SortedSet) Len() int {
+	return len(z.scores)
+}
+
+// Score Returns the score of the member, and a bool indicating whether it
+// was found.
+func (z *SortedSet) Score(member string) (float64, bool) {
+	score, found := z.scores[member]
+	return score, found
+}
+
+// Rank Returns the zero-based rank of the member by ascending score, and a
+// bool indicating whether it was found.
+func (z *SortedSet) Rank(member string) (int, bool) {
+	score, found := z.scores[member]
+	if !found {
+		return 0, false
+	}
+	return z.sl.rank(member, score), true
+}
+
+// RangeByScore Returns the members with a score in [min, max], ordered by
+// score.
+func (z *SortedSet) RangeByScore(min, max float64) []ScoredMember {
+	members := []ScoredMember{}
+	for x := z.sl.first(min); x != nil && x.Score <= max; x = x.next[0].node {
+		members = append(members, x.ScoredMember)
+	}
+	return members
+}
+
+// Members Returns all members of the sorted set, ordered by score.
+func (z *SortedSet) Members() []ScoredMember {
+	return z.RangeByScore(math.Inf(-1), math.Inf(1))
+}
+
+// GobEncode Encodes the members of the sorted set with Gob.
+func (z *SortedSet) GobEncode() ([]byte, error) {
+	var buf bytes.Buffer
+	if err := gob.NewEncoder(&buf).Encode(z.Members()); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// GobDecode Decodes the sorted set encoded by GobEncode.
+func (z *SortedSet) GobDecode(data []byte) error {
+	var members []ScoredMember
+	if err := gob.NewDecoder(bytes.NewReader(data)).Decode(&members); err != nil {
+		return err
+	}
+	*z = SortedSet{}
+	for _, m := range members {
+		z.set(m.Member, m.Score)
+	}
+	return nil
+}
+
+// MarshalJSON Encodes the sorted set as a JSON array of objects with Member
+// and Score fields, ordered by score.
+func (z *SortedSet) MarshalJSON() ([]byte, error) {
+	return json.Marshal(z.Members())
+}
+
+// UnmarshalJSON Decodes the sorted set from a JSON array.
+func (z *SortedSet) UnmarshalJSON(data []byte) error {
+	var members []ScoredMember
+	if err := json.Unmarshal(data, &members); err != nil {
+		return err
+	}
+	*z = SortedSet{}
+	for _, m := range members {
+		z.set(m.Member, m.Score)
+	}
+	return nil
+}
+
+// getSortedSet returns the sorted set of k, nil if the key doesn't exist,
+// or ErrInvalidType if its value isn't a *SortedSet.
+func (c *cache) getSortedSet(k string) (*SortedSet, error) {
+	x, found := c.get(k)
+	if !found {
+		return nil, nil
+	}
+	z, ok := x.(*SortedSet)
+	if !ok {
+		return nil, ErrInvalidType
+	}
+	return z, nil
+}
+
+// modifySortedSet calls f with a copy of the sorted set of k under the lock
+// of k, creating it with the default expiration if the key doesn't exist and
+// create is true, see modifyValue, and stores the copy. The key is deleted if
+// the sorted set is empty after f.
+func (c *cache) modifySortedSet(k string, create bool, f func(z *SortedSet) error) error {
+	var newSortedSet func() any
+	if create {
+		newSortedSet = func() any {
+			return NewSortedSet()
+		}
+	}
+	return c.modifyValue(k, newSortedSet, func(x any) (any, error) {
+		z, ok := x.(*SortedSet)
+		if !ok {
+			return nil, ErrInvalidType
+		}
+		z = z.clone()
+		if err := f(z); err != nil || len(z.scores) == 0 {
+			return nil, err
+		}
+		return z, nil
+	})
+}
+
+// ZAdd Sets the scores of the members of the sorted set of k, and returns
+// the number of members which weren't in the set. A new sorted set with the
+// default expiration is created if the key doesn't exist, otherwise the
+// expiration is kept. Returns ErrNaN if any score is NaN, and ErrInvalidType
+// if the value of k isn't a *SortedSet.
+func (c *cache) ZAdd(k string, members ...ScoredMember) (int, error) {
+	for _, m := range members {
+		if math.IsNaN(m.Score) {
+			return 0, ErrNaN
+		}
+	}
+	var n int
+	err := c.modifySortedSet(k, true, func(z *SortedSet) error {
+		for _, m := range members {
+			if z.set(m.Member, m.Score) {
+				n++
+			}
+		}
+		return nil
+	})
+	return n, err
+}
+
+// ZIncrBy Increments the score of the member of the sorted set of k by n,
+// and returns the new score. A missing member is added with a score of n,
+// and a missing key is created as by ZAdd. Returns ErrNaN if the new score
+// would be NaN, and ErrInvalidType if the value of k isn't a *SortedSet.
+func (c *cache) ZIncrBy(k, member string, n float64) (float64, error) {
+	var score float64
+	err := c.modifySortedSet(k, true, func(z *SortedSet) error {
+		score = z.scores[member] + n
+		if math.IsNaN(score) {
+			return ErrNaN
+		}
+		z.set(member, score)
+		return nil
+	})
+	return score, err
+}
+
+// ZRangeByScore Returns the members of the sorted set of k with a score in
+// [min, max], ordered by score, or an empty slice if the key doesn't exist.
+// Returns ErrInvalidType if the value of k isn't a *SortedSet.
+func (c *cache) ZRangeByScore(k string, min, max float64) ([]ScoredMember, error) {
+	z, err := c.getSortedSet(k)
+	if z == nil {
+		if err != nil {
+			return nil, err
+		}
+		return []ScoredMember{}, nil
+	}
+	return z.RangeByScore(min, max), nil
+}
+
+// ZRank Returns the zero-based rank of the member of the sorted set of k by
+// ascending score. Returns ErrNotExists if the key or the member doesn't
+// exist, and ErrInvalidType if the value of k isn't a *SortedSet.
+func (c *cache) ZRank(k, member string) (int, error) {
+	z, err := c.getSortedSet(k)
+	if z == nil {
+		if err == nil {
+			err = ErrNotExists
+		}
+		return 0, err
+	}
+	r, found := z.Rank(member)
+	if !found {
+		return 0, ErrNotExists
+	}
+	return r, nil
+}
+
+// ZRemRangeByScore Removes the members of the sorted set of k with a score
+// in [min, max], and returns their number. The key is deleted when its last
+// member is removed. Returns ErrInvalidType if the value of k isn't a
+// *SortedSet.
+func (c *cache) ZRemRangeByScore(k string, min, max float64) (int, error) {
+	var n int
+	err := c.modifySortedSet(k, false, func(z *SortedSet) error {
+		n = z.removeRangeByScore(min, max)
+		return nil
+	})
+	if err == ErrNotExists {
+		return 0, nil
+	}
+	return n, err
+}
+
+// ZCard Returns the number of members of the sorted set of k, zero if the
+// key doesn't exist. Returns ErrInvalidType if the value of k isn't a
+// *SortedSet.
+func (c *cache) ZCard(k string) (int, error) {
+	z, err := c.getSortedSet(k)
+	if z == nil {
+		return 0, err
+	}
+	return z.Len(), nil
+}
@@ -0,0 +1,183 @@
+package cache
+
+import (
+	"cmp"
+	"encoding/json"
+	"math"
+	"math/rand/v2"
+	"slices"
+	"strconv"
+	"sync"
+	"testing"
+)
+
+func TestSortedSet(t *testing.T) {
+	tc := New(DefaultExpiration, 0)
+	defer tc.Close()
+	n, err := tc.ZAdd("z", ScoredMember{"a", 3}, ScoredMember{"b", 1}, ScoredMember{"c", 2})
+	if n != 3 || err != nil {
+		t.Fatal(n, err)
+	}
+	if n, _ := tc.ZAdd("z", ScoredMember{"a", 0}, ScoredMember{"d", 2}); n != 1 {
+		t.Error("unexpected number of new members:", n)
+	}
+	want := []ScoredMember{{"a", 0}, {"b", 1}, {"c", 2}, {"d", 2}}
+	if members, _ := tc.ZRangeByScore("z", math.Inf(-1), math.Inf(1)); !slices.Equal(members, want) {
+		t.Error("unexpected members:", members)
+	}
+	if members, _ := tc.ZRangeByScore("z", 0.5, 2); !slices.Equal(members, want[1:]) {
+		t.Error("unexpected range:", members)
+	}
+	if r, err := tc.ZRank("z", "c"); r != 2 || err != nil {
+		t.Error("unexpected rank:", r, err)
+	}
+	if _, err := tc.ZRank("z", "x"); err != ErrNotExists {
+		t.Error("unexpected error for a missing member:", err)
+	}
+	if score, err := tc.ZIncrBy("z", "a", 5); score != 5 || err != nil {
+		t.Error("unexpected ZIncrBy result:", score, err)
+	}
+	if r, _ := tc.ZRank("z", "a"); r != 3 {
+		t.Error("unexpected rank after ZIncrBy:", r)
+	}
+	if score, _ := tc.ZIncrBy("z", "e", -1); score != -1 {
+		t.Error("unexpected ZIncrBy result for a new member:", score)
+	}
+	if n, _ := tc.ZCard("z"); n != 5 {
+		t.Error("unexpected cardinality:", n)
+	}
+	if n, err := tc.ZRemRangeByScore("z", 1, 2); n != 3 || err != nil {
+		t.Error("unexpected ZRemRangeByScore result:", n, err)
+	}
+	if members, _ := tc.ZRangeByScore("z", math.Inf(-1), math.Inf(1)); !slices.Equal(members, []ScoredMember{{"e", -1}, {"a", 5}}) {
+		t.Error("unexpected members after ZRemRangeByScore:", members)
+	}
+	tc.ZRemRangeByScore("z", math.Inf(-1), math.Inf(1))
+	if _, found := tc.Get("z"); found {
+		t.Error("empty sorted set was not deleted")
+	}
+	if members, err := tc.ZRangeByScore("z", 0, 1); members == nil || len(members) != 0 || err != nil {
+		t.Error("unexpected range of a missing key:", members, err)
+	}
+}
+
+func TestSortedSetErrors(t *testing.T) {
+	tc := New(DefaultExpiration, 0)
+	defer tc.Close()
+	if _, err := tc.ZAdd("z", ScoredMember{"a", math.NaN()}); err != ErrNaN {
+		t.Error("unexpected ZAdd error:", err)
+	}
+	tc.ZAdd("z", ScoredMember{"a", math.Inf(1)})
+	if _, err := tc.ZIncrBy("z", "a", math.Inf(-1)); err != ErrNaN {
+		t.Error("unexpected ZIncrBy error:", err)
+	}
+	if score, _ := tc.ZIncrBy("z", "a", 0); !math.IsInf(score, 1) {
+		t.Error("score was changed:", score)
+	}
+	tc.Set("x", 1, DefaultExpiration)
+	if _, err := tc.ZAdd("x", ScoredMember{"a", 1}); err != ErrInvalidType {
+		t.Error("unexpected ZAdd error:", err)
+	}
+	if _, err := tc.ZRank("x", "a"); err != ErrInvalidType {
+		t.Error("unexpected ZRank error:", err)
+	}
+}
+
+func TestSortedSetRandom(t *testing.T) {
+	z := NewSortedSet()
+	scores := make(map[string]float64)
+	for range 2000 {
+		m := strconv.Itoa(rand.IntN(300))
+		if rand.IntN(3) == 0 {
+			s := scores[m]
+			z.removeRangeByScore(s, s)
+			for k := range scores {
+				if scores[k] == s {
+					delete(scores, k)
+				}
+			}
+			continue
+		}
+		s := float64(rand.IntN(50))
+		z.set(m, s)
+		scores[m] = s
+	}
+	var want []ScoredMember
+	for m, s := range scores {
+		want = append(want, ScoredMember{m, s})
+	}
+	slices.SortFunc(want, func(a, b ScoredMember) int {
+		return cmp.Or(cmp.Compare(a.Score, b.Score), cmp.Compare(a.Member, b.Member))
+	})
+	if got := z.Members(); !slices.Equal(got, want) {
+		t.Fatal("unexpected members:", got)
+	}
+	for i, m := range want {
+		if r, _ := z.Rank(m.Member); r != i {
+			t.Fatalf("unexpected rank of %s: %d, want %d", m.Member, r, i)
+		}
+	}
+}
+
+func TestSortedSetEncoding(t *testing.T) {
+	z := NewSortedSet(ScoredMember{"b", 2}, ScoredMember{"a", 1})
+	data, err := json.Marshal(z)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var z2 SortedSet
+	if err := json.Unmarshal(data, &z2); err != nil {
+		t.Fatal(err)
+	}
+	if !slices.Equal(z2.Members(), z.Members()) {
+		t.Error("unexpected decoded sorted set:", z2.Members())
+	}
+	data, err = z.GobEncode()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var z3 SortedSet
+	if err := z3.GobDecode(data); err != nil {
+		t.Fatal(err)
+	}
+	if r, _ := z3.Rank("b"); r != 1 {
+		t.Error("unexpected rank in decoded sorted set:", r)
+	}
+}
+
+func TestSortedSetSnapshot(t *testing.T) {
+	tc := New(DefaultExpiration, 0)
+	defer tc.Close()
+	tc.ZAdd("z", ScoredMember{"a", 1}, ScoredMember{"b", 2})
+	x, _ := tc.Get("z")
+	z := x.(*SortedSet)
+	tc.ZAdd("z", ScoredMember{"c", 3})
+	tc.ZIncrBy("z", "b", 10)
+	tc.ZRemRangeByScore("z", 0, 1)
+	if members := z.Members(); !slices.Equal(members, []ScoredMember{{"a", 1}, {"b", 2}}) {
+		t.Error("sorted set returned by Get was changed:", members)
+	}
+	if members, _ := tc.ZRangeByScore("z", 0, math.Inf(1)); !slices.Equal(members, []ScoredMember{{"c", 3}, {"b", 12}}) {
+		t.Error("unexpected members:", members)
+	}
+}
+
+func TestSortedSetConcurrentIncrBy(t *testing.T) {
+	tc := New(DefaultExpiration, 0)
+	defer tc.Close()
+	var wg sync.WaitGroup
+	for i := range 8 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for range 100 {
+				tc.ZIncrBy("z", strconv.Itoa(i%2), 1)
+				tc.ZRangeByScore("z", 0, math.Inf(1))
+			}
+		}()
+	}
+	wg.Wait()
+	if members, _ := tc.ZRangeByScore("z", 0, math.Inf(1)); !slices.Equal(members, []ScoredMember{{"0", 400}, {"1", 400}}) {
+		t.Error("unexpected members:", members)
+	}
+}
@@ -0,0 +1,52 @@
+package cache
+
+import "sync/atomic"
+
+// Stats Counters of cache operations since the cache was created, see
+// Cache.Stats.
+type Stats struct {
+	// Hits is the number of lookups which found an unexpired item.
+	Hits uint64
+	// Misses is the number of lookups which found no item, or an expired one.
+	Misses uint64
+	// Sets is the number of items stored by Set, Add, Replace, Touch,
+	// Modify and Increment*/Decrement*.
+	Sets uint64
+	// Deletes is the number of items deleted by Delete.
+	Deletes uint64
+	// Expirations is the number of expired items deleted by the janitor or
+	// DeleteExpired.
+	Expirations uint64
+	// Flushes is the number of Flush calls.
+	Flushes uint64
+}
+
+type stats struct {
+	hits, misses, sets, deletes, expirations, flushes atomic.Uint64
+}
+
+// lookup counts a lookup of an item and returns found.
+func (s *stats) lookup(found bool) bool {
+	if found {
+		s.hits.Add(1)
+	} else {
+		s.misses.Add(1)
+	}
+	return found
+}
+
+func (s *stats) snapshot() Stats {
+	return Stats{
+		Hits:        s.hits.Load(),
+		Misses:      s.misses.Load(),
+		Sets:        s.sets.Load(),
+		Deletes:     s.deletes.Load(),
+		Expirations: s.expirations.Load(),
+		Flushes:     s.flushes.Load(),
+	}
+}
+
+// Stats Returns the operation counters of the cache.
+func (c *cache) Stats() Stats {
+	return c.stats.snapshot()
+}
@@ -0,0 +1,29 @@
+package cache
+
+import (
+	"testing"
+	"time"
+)
+
+func TestStats(t *testing.T) {
+	tc := New(DefaultExpiration, 0, true)
+	defer tc.Close()
+	tc.Set("a", 1, NoExpiration)
+	tc.Set("b", 1, time.Millisecond)
+	if err := tc.Increment("a", 1); err != nil {
+		t.Fatal(err)
+	}
+	tc.Get("a")
+	tc.Get("missing")
+	tc.GetWithExpiration("a")
+	<-time.After(5 * time.Millisecond)
+	tc.Get("b")
+	tc.DeleteExpired()
+	tc.Delete("a")
+	tc.Delete("a")
+	tc.Flush()
+	want := Stats{Hits: 2, Misses: 2, Sets: 3, Deletes: 1, Expirations: 1, Flushes: 1}
+	if s := tc.Stats(); s != want {
+		t.Errorf("unexpected stats %+v, expected %+v", s, want)
+	}
+}
@@ -0,0 +1,146 @@
+package cache
+
+import (
+	"maps"
+	"slices"
+	"sync"
+	"time"
+)
+
+// tagIndex maps tags to the keys of the items carrying them. It is created
+// by the first SetWithTags and kept up to date by an observer, so caches not
+// using tags don't pay for it.
+type tagIndex struct {
+	mu   sync.Mutex
+	keys map[string]map[string]struct{}
+	// tags are the tags of every tagged key, to find the sets to clean up
+	// when the item is replaced or removed.
+	tags map[string][]string
+}
+
+func (x *tagIndex) observe(m mutation) {
+	x.mu.Lock()
+	defer x.mu.Unlock()
+	if m.op == opFlush {
+		clear(x.keys)
+		clear(x.tags)
+		return
+	}
+	var tags []string
+	if m.op.stores() && m.item.tags != nil {
+		tags = *m.item.tags
+	}
+	old := x.tags[m.key]
+	if slices.Equal(old, tags) {
+		return
+	}
+	for _, t := range old {
+		if ks := x.keys[t]; ks != nil {
+			delete(ks, m.key)
+			if len(ks) == 0 {
+				delete(x.keys, t)
+			}
+		}
+	}
+	if len(tags) == 0 {
+		delete(x.tags, m.key)
+		return
+	}
+	x.tags[m.key] = tags
+	for _, t := range tags {
+		ks := x.keys[t]
+		if ks == nil {
+			ks = make(map[string]struct{})
+			x.keys[t] = ks
+		}
+		ks[m.key] = struct{}{}
+	}
+}
+
+// tagged returns the keys carrying the tag.
+func (x *tagIndex) tagged(tag string) []string {
+	x.mu.Lock()
+	defer x.mu.Unlock()
+	return slices.Collect(maps.Keys(x.keys[tag]))
+}
+
+// initTags creates the tag index of the cache, if it doesn't exist yet.
+func (c *cache) initTags() {
+	if c.tags.Load() != nil {
+		return
+	}
+	x := &tagIndex{
+		keys: make(map[string]map[string]struct{}),
+		tags: make(map[string][]string),
+	}
+	// The observer is added first, so no tagged item is stored unseen once
+	// the index is visible.
+	o := c.addObserver(x.observe)
+	if !c.tags.CompareAndSwap(nil, x) {
+		c.removeObserver(o)
+	}
+}
+
+// SetWithTags Same as Set, but attaches the tags to the item, so it is
+// deleted by InvalidateTag of any of them. The tags are kept while the item's
+// value or expiration is changed by Modify, Touch or Increment*/Decrement*,
+// and dropped when the item is replaced by Set, Add or Replace. Tags aren't
+// saved by Save.
+func (c *cache) SetWithTags(k string, x any, d time.Duration, tags ...string) {
+	item := c.newItem(x, d)
+	if tags = normalizeTags(tags); len(tags) > 0 {
+		c.initTags()
+		item.tags = &tags
+	}
+	mu := c.lock(k)
+	c.store(opSet, k, item)
+	mu.Unlock()
+}
+
+// normalizeTags returns a sorted copy of tags without duplicates.
+func normalizeTags(tags []string) []string {
+	tags = slices.Clone(tags)
+	slices.Sort(tags)
+	return slices.Compact(tags)
+}
+
+// Tags Returns the tags of an unexpired item, and a bool indicating whether
+// the key was found.
+func (c *cache) Tags(k string) ([]string, bool) {
+	item, found := c.getItem(k)
+	if !found || item.expired(c.timeCache.Load()) {
+		return nil, false
+	}
+	if item.tags == nil {
+		return nil, true
+	}
+	return slices.Clone(*item.tags), true
+}
+
+// InvalidateTag Deletes all items carrying the tag, as if by Delete, and
+// returns the number of deleted items.
+func (c *cache) InvalidateTag(tag string) int {
+	x := c.tags.Load()
+	if x == nil {
+		return 0
+	}
+	return c.deleteAll(slices.Values(x.tagged(tag)), func(item Item) bool {
+		// The item may have been replaced since the keys were collected.
+		return item.tags != nil && slices.Contains(*item.tags, tag)
+	})
+}
+
+// SetWithTags Same as cache.SetWithTags.
+func (sc *shardedCache) SetWithTags(k string, x any, d time.Duration, tags ...string) {
+	sc.bucket(k).SetWithTags(k, x, d, tags...)
+}
+
+// InvalidateTag Deletes all items of all shards carrying the tag, see
+// cache.InvalidateTag.
+func (sc *shardedCache) InvalidateTag(tag string) int {
+	n := 0
+	for _, c := range sc.cs {
+		n += c.InvalidateTag(tag)
+	}
+	return n
+}
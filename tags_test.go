@@ -0,0 +1,84 @@
+package cache
+
+import (
+	"slices"
+	"testing"
+	"time"
+)
+
+func TestTags(t *testing.T) {
+	tc := New(DefaultExpiration, 0, true)
+	defer tc.Close()
+	if n := tc.InvalidateTag("product:1"); n != 0 {
+		t.Error("unexpected InvalidateTag result without tags:", n)
+	}
+	tc.SetWithTags("page:1", "p1", NoExpiration, "product:1", "price:1", "product:1")
+	tc.SetWithTags("page:2", "p2", NoExpiration, "product:2", "price:1")
+	tc.SetWithTags("page:3", 3, NoExpiration, "product:3")
+	tc.Set("other", "x", NoExpiration)
+	if tags, found := tc.Tags("page:1"); !found || !slices.Equal(tags, []string{"price:1", "product:1"}) {
+		t.Error("unexpected tags:", tags, found)
+	}
+	if tags, found := tc.Tags("other"); !found || tags != nil {
+		t.Error("unexpected tags of untagged item:", tags, found)
+	}
+	if err := tc.Increment("page:3", 1); err != nil {
+		t.Fatal(err)
+	}
+	if err := tc.Touch("page:3", time.Hour); err != nil {
+		t.Fatal(err)
+	}
+	if tags, _ := tc.Tags("page:3"); !slices.Equal(tags, []string{"product:3"}) {
+		t.Error("tags were not kept:", tags)
+	}
+	var evicted []string
+	tc.OnEvicted(func(k string, _ any) {
+		evicted = append(evicted, k)
+	})
+	if n := tc.InvalidateTag("price:1"); n != 2 || len(evicted) != 2 {
+		t.Error("unexpected InvalidateTag result:", n, evicted)
+	}
+	if _, found := tc.Get("page:1"); found {
+		t.Error("page:1 was not deleted")
+	}
+	if n := tc.InvalidateTag("product:1"); n != 0 {
+		t.Error("deleted item was invalidated again:", n)
+	}
+	tc.Set("page:3", 3, NoExpiration)
+	if n := tc.InvalidateTag("product:3"); n != 0 {
+		t.Error("item replaced by Set was invalidated:", n)
+	}
+}
+
+func TestTagIndexCleanup(t *testing.T) {
+	tc := New(DefaultExpiration, 0, true)
+	defer tc.Close()
+	tc.SetWithTags("a", 1, NoExpiration, "x", "y")
+	tc.SetWithTags("b", 1, time.Millisecond, "x")
+	tc.SetWithTags("c", 1, NoExpiration, "z")
+	tc.Delete("a")
+	<-time.After(5 * time.Millisecond)
+	tc.DeleteExpired()
+	x := tc.tags.Load()
+	if len(x.keys) != 1 || len(x.tags) != 1 {
+		t.Error("tag index was not cleaned up:", x.keys, x.tags)
+	}
+	tc.Flush()
+	if len(x.keys) != 0 || len(x.tags) != 0 {
+		t.Error("tag index was not flushed:", x.keys, x.tags)
+	}
+}
+
+func TestShardedTags(t *testing.T) {
+	tc := unexportedNewSharded(DefaultExpiration, 0, 4)
+	for _, k := range []string{"a", "b", "c", "d"} {
+		tc.SetWithTags(k, k, DefaultExpiration, "t")
+	}
+	tc.Set("e", "e", DefaultExpiration)
+	if n := tc.InvalidateTag("t"); n != 4 {
+		t.Error("unexpected InvalidateTag result:", n)
+	}
+	if _, found := tc.Get("e"); !found {
+		t.Error("untagged item was deleted")
+	}
+}
@@ -0,0 +1,217 @@
+package cache
+
+import (
+	"cmp"
+	"slices"
+	"time"
+)
+
+// Tx A transaction over several keys of a cache, see Cache.Txn. Writes are
+// buffered and visible to later reads of the same transaction only, until the
+// transaction commits. A Tx must not be used outside of the function passed to
+// Txn, nor by several goroutines.
+type Tx struct {
+	bucket func(string) (*cache, int)
+	now    int64
+	reads  map[string]txRead
+	writes map[string]txWrite
+}
+
+// txRead is the version of the lock stripe of a key read by a transaction,
+// taken before the key was read.
+type txRead struct {
+	c       *cache
+	shard   int
+	stripe  uint32
+	version uint64
+}
+
+// txWrite is a buffered write of a transaction. An op of opDelete deletes
+// the key, otherwise item is stored.
+type txWrite struct {
+	op   mutationOp
+	item Item
+}
+
+// Get Returns the value of an unexpired item, and a bool indicating whether
+// the key was found. If another writer changes the key before the transaction
+// commits, the transaction is retried.
+func (tx *Tx) Get(k string) (any, bool) {
+	v, found := tx.getItem(k)
+	return v.Object, found
+}
+
+func (tx *Tx) getItem(k string) (Item, bool) {
+	if w, ok := tx.writes[k]; ok {
+		return w.item, w.op != opDelete
+	}
+	c, shard := tx.bucket(k)
+	if _, ok := tx.reads[k]; !ok {
+		i := stripe(k)
+		tx.reads[k] = txRead{c: c, shard: shard, stripe: i, version: c.versions[i].Load()}
+	}
+	v, found := c.getItem(k)
+	if !found || v.expired(tx.now) {
+		return Item{}, false
+	}
+	return v, true
+}
+
+// Set Stores an item when the transaction commits, see Cache.Set.
+func (tx *Tx) Set(k string, x any, d time.Duration) {
+	c, _ := tx.bucket(k)
+	tx.writes[k] = txWrite{op: opSet, item: c.newItem(x, d)}
+}
+
+// Delete Deletes an item when the transaction commits, see Cache.Delete.
+func (tx *Tx) Delete(k string) {
+	tx.writes[k] = txWrite{op: opDelete}
+}
+
+// Increment Increments a numeric item by n when the transaction commits, see
+// Cache.Increment. Returns ErrNotExists if the item doesn't exist and
+// ErrInvalidType if it isn't a number.
+func (tx *Tx) Increment(k string, n int64) error {
+	v, found := tx.getItem(k)
+	if !found {
+		return ErrNotExists
+	}
+	x, err := incrementValue(v.Object, n)
+	if err != nil {
+		return err
+	}
+	v.Object = x
+	op := opIncrement
+	if w, ok := tx.writes[k]; ok {
+		op = w.op
+	}
+	tx.writes[k] = txWrite{op: op, item: v}
+	return nil
+}
+
+// txLock is a lock stripe of a cache, ordered by shard and stripe index.
+type txLock struct {
+	c      *cache
+	shard  int
+	stripe uint32
+}
+
+// txEvicted is an item deleted by a transaction.
+type txEvicted struct {
+	c *cache
+	kv
+}
+
+// valid reports whether no key the transaction has read was changed since it
+// was read.
+func (tx *Tx) valid() bool {
+	for _, r := range tx.reads {
+		if r.c.versions[r.stripe].Load() != r.version {
+			return false
+		}
+	}
+	return true
+}
+
+// commit applies the writes of the transaction if no key it has read was
+// changed since it was read, and returns false otherwise. Returns
+// ErrReadOnly if the transaction writes to a cache which follows a leader.
+func (tx *Tx) commit() (bool, error) {
+	locks := make([]txLock, 0, len(tx.reads)+len(tx.writes))
+	for _, r := range tx.reads {
+		locks = append(locks, txLock{r.c, r.shard, r.stripe})
+	}
+	for k := range tx.writes {
+		c, shard := tx.bucket(k)
+		if err := c.writable(); err != nil {
+			return false, err
+		}
+		locks = append(locks, txLock{c, shard, stripe(k)})
+	}
+	// Locks are always taken in the same order, so transactions don't
+	// deadlock.
+	cmpLocks := func(a, b txLock) int {
+		return cmp.Or(cmp.Compare(a.shard, b.shard), cmp.Compare(a.stripe, b.stripe))
+	}
+	slices.SortFunc(locks, cmpLocks)
+	locks = slices.CompactFunc(locks, func(a, b txLock) bool {
+		return cmpLocks(a, b) == 0
+	})
+	for _, l := range locks {
+		l.c.locks[l.stripe].Lock()
+	}
+	var evictedItems []txEvicted
+	ok := tx.valid()
+	if ok {
+		for k, w := range tx.writes {
+			c, _ := tx.bucket(k)
+			if w.op != opDelete {
+				c.store(w.op, k, w.item)
+				continue
+			}
+			if tmp, found := c.items.LoadAndDelete(k); found {
+				v := tmp.(Item)
+				c.stats.deletes.Add(1)
+				c.emit(mutation{op: opDelete, key: k, item: v})
+				if c.notifiesEvictions() {
+					evictedItems = append(evictedItems, txEvicted{c, kv{k, v.Object}})
+				}
+			}
+		}
+	}
+	for _, l := range locks {
+		l.c.locks[l.stripe].Unlock()
+	}
+	for _, v := range evictedItems {
+		v.c.evicted(v.key, v.value)
+	}
+	return ok, nil
+}
+
+// txn runs f in transactions until one commits or f fails with reads which
+// are still valid.
+func txn(bucket func(string) (*cache, int), now func() int64, f func(tx *Tx) error) error {
+	for {
+		tx := &Tx{
+			bucket: bucket,
+			now:    now(),
+			reads:  make(map[string]txRead),
+			writes: make(map[string]txWrite),
+		}
+		if err := f(tx); err != nil {
+			// The error may be due to reads of keys changed since, in which
+			// case f is run again.
+			if tx.valid() {
+				return err
+			}
+			continue
+		}
+		if ok, err := tx.commit(); ok || err != nil {
+			return err
+		}
+	}
+}
+
+// Txn Runs f in a transaction: the writes f makes through tx are applied
+// all together, and only if no key f has read through tx was changed by
+// another writer in the meantime, in which case f is called again with a new
+// transaction, so f must not have side effects other than on tx. Concurrent
+// readers of the cache see either none or all of the writes of a
+// transaction, as long as they read through transactions as well. If f
+// returns an error, no writes are applied and Txn returns the error, unless a
+// key f has read was changed in the meantime, in which case f is called
+// again. Txn returns ErrReadOnly if f writes to a cache which follows a
+// leader.
+func (c *cache) Txn(f func(tx *Tx) error) error {
+	return txn(func(string) (*cache, int) {
+		return c, 0
+	}, c.timeCache.Load, f)
+}
+
+// Txn Same as cache.Txn, the keys may belong to different shards.
+func (sc *shardedCache) Txn(f func(tx *Tx) error) error {
+	return txn(func(k string) (*cache, int) {
+		i := djb33(sc.seed, k) % sc.m
+		return sc.cs[i], int(i)
+	}, sc.cs[0].timeCache.Load, f)
+}
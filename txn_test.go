@@ -0,0 +1,150 @@
+package cache
+
+import (
+	"errors"
+	"sync"
+	"testing"
+)
+
+func TestTxn(t *testing.T) {
+	tc := New(DefaultExpiration, 0)
+	defer tc.Close()
+	tc.Set("from", 10, NoExpiration)
+	tc.Set("to", 0, NoExpiration)
+	err := tc.Txn(func(tx *Tx) error {
+		x, _ := tx.Get("from")
+		tx.Delete("from")
+		if _, found := tx.Get("from"); found {
+			t.Error("deleted key is visible in the transaction")
+		}
+		if err := tx.Increment("to", int64(x.(int))); err != nil {
+			return err
+		}
+		if y, _ := tx.Get("to"); y != 10 {
+			t.Error("write is not visible in the transaction:", y)
+		}
+		if y, _ := tc.Get("to"); y != 0 {
+			t.Error("write is visible before commit:", y)
+		}
+		tx.Set("log", "moved", NoExpiration)
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, found := tc.Get("from"); found {
+		t.Error("from was not deleted")
+	}
+	if x, _ := tc.Get("to"); x != 10 {
+		t.Error("to was not incremented:", x)
+	}
+	errAbort := errors.New("abort")
+	err = tc.Txn(func(tx *Tx) error {
+		tx.Set("to", 0, NoExpiration)
+		return errAbort
+	})
+	if err != errAbort {
+		t.Error("unexpected error:", err)
+	}
+	if x, _ := tc.Get("to"); x != 10 {
+		t.Error("aborted transaction was applied:", x)
+	}
+	err = tc.Txn(func(tx *Tx) error {
+		return tx.Increment("log", 1)
+	})
+	if err != ErrInvalidType {
+		t.Error("unexpected error:", err)
+	}
+}
+
+func TestTxnErrorRetried(t *testing.T) {
+	tc := New(DefaultExpiration, 0)
+	defer tc.Close()
+	tc.Set("k", 0, NoExpiration)
+	errSmall := errors.New("too small")
+	runs := 0
+	err := tc.Txn(func(tx *Tx) error {
+		runs++
+		x, _ := tx.Get("k")
+		if runs == 1 {
+			// The error is due to a read changed before Txn returns it.
+			tc.Set("k", 1, NoExpiration)
+		}
+		if x.(int) < 1 {
+			return errSmall
+		}
+		tx.Set("k", 2, NoExpiration)
+		return nil
+	})
+	if err != nil || runs != 2 {
+		t.Error("transaction which failed on a changed read was not retried:", err, runs)
+	}
+	if x, _ := tc.Get("k"); x != 2 {
+		t.Error("unexpected value:", x)
+	}
+}
+
+// testTxnTransfers moves units between accounts concurrently, the total must
+// stay the same for every reader.
+func testTxnTransfers(t *testing.T, txn func(func(tx *Tx) error) error, set func(string, any)) {
+	accounts := []string{"a", "b", "c", "d", "e", "f", "g", "h"}
+	for _, k := range accounts {
+		set(k, 100)
+	}
+	var wg sync.WaitGroup
+	for w := 0; w < 8; w++ {
+		wg.Add(1)
+		go func(w int) {
+			defer wg.Done()
+			for i := 0; i < 200; i++ {
+				from, to := accounts[(w+i)%len(accounts)], accounts[(w+2*i+1)%len(accounts)]
+				if from == to {
+					continue
+				}
+				err := txn(func(tx *Tx) error {
+					if err := tx.Increment(from, -1); err != nil {
+						return err
+					}
+					return tx.Increment(to, 1)
+				})
+				if err != nil {
+					t.Error(err)
+					return
+				}
+			}
+		}(w)
+	}
+	for r := 0; r < 100; r++ {
+		var total int
+		err := txn(func(tx *Tx) error {
+			total = 0
+			for _, k := range accounts {
+				x, _ := tx.Get(k)
+				total += x.(int)
+			}
+			return nil
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if total != 100*len(accounts) {
+			t.Fatal("reader observed an intermediate state:", total)
+		}
+	}
+	wg.Wait()
+}
+
+func TestTxnConcurrent(t *testing.T) {
+	tc := New(DefaultExpiration, 0)
+	defer tc.Close()
+	testTxnTransfers(t, tc.Txn, func(k string, x any) {
+		tc.Set(k, x, NoExpiration)
+	})
+}
+
+func TestShardedTxnConcurrent(t *testing.T) {
+	tc := unexportedNewSharded(DefaultExpiration, 0, 4)
+	testTxnTransfers(t, tc.Txn, func(k string, x any) {
+		tc.Set(k, x, NoExpiration)
+	})
+}
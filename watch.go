@@ -0,0 +1,157 @@
+package cache
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+)
+
+// keyObservers are observers of single keys, used by Watch and Lock. The
+// registry is added as an observer of the cache on first use only, and
+// returns early while no key is observed.
+type keyObservers struct {
+	mu sync.RWMutex
+	m  map[string]map[*observer]struct{}
+	// n is the number of observers in m.
+	n atomic.Int64
+}
+
+// add adds an observer of the mutations of k, and of flushes, and returns a
+// function removing it. f is called while k is locked, so it must return
+// quickly.
+func (ko *keyObservers) add(k string, f func(mutation)) func() {
+	o := &observer{f: f}
+	ko.mu.Lock()
+	if ko.m[k] == nil {
+		ko.m[k] = make(map[*observer]struct{})
+	}
+	ko.m[k][o] = struct{}{}
+	ko.n.Add(1)
+	ko.mu.Unlock()
+	return func() {
+		ko.mu.Lock()
+		defer ko.mu.Unlock()
+		if _, found := ko.m[k][o]; found {
+			delete(ko.m[k], o)
+			if len(ko.m[k]) == 0 {
+				delete(ko.m, k)
+			}
+			ko.n.Add(-1)
+		}
+	}
+}
+
+func (ko *keyObservers) observe(m mutation) {
+	if ko.n.Load() == 0 {
+		return
+	}
+	ko.mu.RLock()
+	defer ko.mu.RUnlock()
+	if m.op == opFlush {
+		for _, obs := range ko.m {
+			for o := range obs {
+				o.f(m)
+			}
+		}
+		return
+	}
+	for o := range ko.m[m.key] {
+		o.f(m)
+	}
+}
+
+// initKeyObservers returns the observers of single keys, adding them on
+// first use.
+func (c *cache) initKeyObservers() *keyObservers {
+	if ko := c.keyObservers.Load(); ko != nil {
+		return ko
+	}
+	ko := &keyObservers{m: make(map[string]map[*observer]struct{})}
+	o := c.addObserver(ko.observe)
+	if !c.keyObservers.CompareAndSwap(nil, ko) {
+		c.removeObserver(o)
+	}
+	return c.keyObservers.Load()
+}
+
+// Watch Returns a channel receiving the events of the key, see OnEvent,
+// including EventFlush, until ctx is done, at which point the channel is
+// closed. Events are queued while the receiver is busy, never dropped, and
+// the cache is never blocked by a slow receiver. As for OnEvent, expired
+// items cause an EventExpire only once deleted by the janitor or
+// DeleteExpired.
+func (c *cache) Watch(ctx context.Context, k string) <-chan Event {
+	events := make(chan Event)
+	var mu sync.Mutex
+	var queue []Event
+	signal := make(chan struct{}, 1)
+	remove := c.initKeyObservers().add(k, func(m mutation) {
+		if m.silent {
+			return
+		}
+		mu.Lock()
+		queue = append(queue, Event{
+			Type:       EventType(m.op),
+			Key:        m.key,
+			Object:     m.item.Object,
+			Expiration: m.item.Expiration,
+		})
+		mu.Unlock()
+		select {
+		case signal <- struct{}{}:
+		default:
+		}
+	})
+	go func() {
+		defer close(events)
+		defer remove()
+		for {
+			select {
+			case <-signal:
+			case <-ctx.Done():
+				return
+			}
+			mu.Lock()
+			batch := queue
+			queue = nil
+			mu.Unlock()
+			for _, ev := range batch {
+				select {
+				case events <- ev:
+				case <-ctx.Done():
+					return
+				}
+			}
+		}
+	}()
+	return events
+}
+
+// WaitFor Returns the value of the key once it exists and hasn't expired,
+// immediately if it already does. Returns the error of ctx if it is done
+// first.
+func (c *cache) WaitFor(ctx context.Context, k string) (any, error) {
+	// The key is watched before it is read, so a set in between isn't
+	// missed.
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	events := c.Watch(ctx, k)
+	for {
+		if x, found := c.get(k); found {
+			return x, nil
+		}
+		if _, ok := <-events; !ok {
+			return nil, ctx.Err()
+		}
+	}
+}
+
+// Watch Same as cache.Watch.
+func (sc *shardedCache) Watch(ctx context.Context, k string) <-chan Event {
+	return sc.bucket(k).Watch(ctx, k)
+}
+
+// WaitFor Same as cache.WaitFor.
+func (sc *shardedCache) WaitFor(ctx context.Context, k string) (any, error) {
+	return sc.bucket(k).WaitFor(ctx, k)
+}
@@ -0,0 +1,101 @@
+package cache
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func nextEvent(t *testing.T, events <-chan Event) Event {
+	t.Helper()
+	select {
+	case ev := <-events:
+		return ev
+	case <-time.After(time.Second):
+		t.Fatal("no event received")
+		return Event{}
+	}
+}
+
+func TestWatch(t *testing.T) {
+	tc := New(DefaultExpiration, 0)
+	defer tc.Close()
+	ctx, cancel := context.WithCancel(context.Background())
+	events := tc.Watch(ctx, "k")
+	tc.Set("other", 1, DefaultExpiration)
+	tc.Set("k", 1, DefaultExpiration)
+	tc.Increment("k", 2)
+	tc.Replace("k", "v", DefaultExpiration)
+	tc.Delete("k")
+	tc.Flush()
+	// The receiver starts late, the events must have been queued.
+	want := []Event{
+		{Type: EventSet, Key: "k", Object: 1},
+		{Type: EventIncrement, Key: "k", Object: 3},
+		{Type: EventSet, Key: "k", Object: "v"},
+		{Type: EventDelete, Key: "k", Object: "v"},
+		{Type: EventFlush},
+	}
+	for _, w := range want {
+		if ev := nextEvent(t, events); ev != w {
+			t.Errorf("unexpected event: %+v, want %+v", ev, w)
+		}
+	}
+	cancel()
+	for range events {
+	}
+	if n := tc.keyObservers.Load().n.Load(); n != 0 {
+		t.Error("observer was not removed:", n)
+	}
+}
+
+func TestWatchExpire(t *testing.T) {
+	tc := New(DefaultExpiration, time.Millisecond, true)
+	defer tc.Close()
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	events := tc.Watch(ctx, "k")
+	tc.Set("k", 1, 5*time.Millisecond)
+	if ev := nextEvent(t, events); ev.Type != EventSet {
+		t.Error("unexpected event:", ev)
+	}
+	if ev := nextEvent(t, events); ev.Type != EventExpire || ev.Key != "k" {
+		t.Error("unexpected event:", ev)
+	}
+}
+
+func TestWaitFor(t *testing.T) {
+	tc := New(DefaultExpiration, 0)
+	defer tc.Close()
+	tc.Set("ready", 1, DefaultExpiration)
+	if x, err := tc.WaitFor(context.Background(), "ready"); x != 1 || err != nil {
+		t.Error("unexpected result for an existing key:", x, err)
+	}
+	go func() {
+		<-time.After(10 * time.Millisecond)
+		tc.Set("other", 1, DefaultExpiration)
+		tc.Set("k", "v", DefaultExpiration)
+	}()
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	if x, err := tc.WaitFor(ctx, "k"); x != "v" || err != nil {
+		t.Error("unexpected result:", x, err)
+	}
+	ctx, cancel = context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if _, err := tc.WaitFor(ctx, "missing"); err != context.DeadlineExceeded {
+		t.Error("unexpected error:", err)
+	}
+}
+
+func BenchmarkSetWithUnrelatedWatch(b *testing.B) {
+	tc := New(DefaultExpiration, 0)
+	defer tc.Close()
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	tc.Watch(ctx, "watched")
+	b.ResetTimer()
+	for range b.N {
+		tc.Set("k", 1, DefaultExpiration)
+	}
+}